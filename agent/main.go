@@ -24,6 +24,8 @@ var (
 	token               string
 	configPath          string
 	singboxBin          string
+	mieruBin            string
+	mieruConfigPath     string
 	triggerUpdate       bool
 	autoUpdate          bool
 	updateCheckInterval int
@@ -34,6 +36,8 @@ func init() {
 	flag.StringVar(&token, "token", "", "主机 Token")
 	flag.StringVar(&configPath, "config", "/etc/sing-box/config.json", "sing-box 配置文件路径")
 	flag.StringVar(&singboxBin, "singbox", "sing-box", "sing-box 可执行文件路径")
+	flag.StringVar(&mieruBin, "mita", "mita", "mieru 服务端 (mita) 可执行文件路径")
+	flag.StringVar(&mieruConfigPath, "mieru-config", "/etc/mita/config.json", "mieru 服务端配置文件路径")
 	flag.BoolVar(&triggerUpdate, "update", false, "手动触发更新")
 	flag.BoolVar(&autoUpdate, "auto-update", true, "是否启用自动更新检查")
 	flag.IntVar(&updateCheckInterval, "update-check-interval", 3600, "更新检查间隔（秒）")
@@ -41,6 +45,7 @@ func init() {
 
 type AgentConfig struct {
 	SingBoxConfig map[string]interface{} `json:"singbox_config"`
+	MieruConfig   map[string]interface{} `json:"mieru_config,omitempty"`
 	Nodes         []NodeConfig           `json:"nodes"`
 }
 
@@ -59,6 +64,9 @@ type Agent struct {
 	singboxBin          string
 	singboxCmd          *exec.Cmd
 	lastConfig          string
+	mieruBin            string                 // mita 可执行文件
+	mieruConfigPath     string                 // mita 配置文件
+	lastMieruConfig     string                 // 上次应用的 mita 配置
 	httpClient          *http.Client
 	userVersions        map[int64]int64        // 节点用户版本缓存
 	userHashes          map[int64]string       // 节点用户哈希缓存
@@ -66,6 +74,7 @@ type Agent struct {
 	nodeConfigs         []NodeConfig           // 当前节点配置
 	clashAPIPort        int                    // Clash API 端口
 	portUserMap         map[int][]string       // 端口到用户的映射（用于单端口多用户场景）
+	wireguardPeers      map[string]string      // WireGuard 隧道地址到用户的映射
 	versionManager      *VersionManager        // 版本管理告
 	updateChecker       *UpdateChecker         // 更新检查器
 	updateNotifier      *UpdateNotifier        // 更新通知告
@@ -93,6 +102,8 @@ func NewAgent(manualUpdate bool, autoUpdate bool, updateCheckInterval int) *Agen
 		token:               token,
 		configPath:          configPath,
 		singboxBin:          singboxBin,
+		mieruBin:            mieruBin,
+		mieruConfigPath:     mieruConfigPath,
 		httpClient:          &http.Client{Timeout: 30 * time.Second},
 		userVersions:        make(map[int64]int64),
 		userHashes:          make(map[int64]string),
@@ -466,6 +477,21 @@ func (a *Agent) updateConfig(config *AgentConfig) (bool, error) {
 		a.portUserMap[node.Port] = users
 	}
 
+	// WireGuard 连接没有入站用户，按隧道地址识别用户
+	a.wireguardPeers = make(map[string]string)
+	for _, node := range config.Nodes {
+		if node.Type != "wireguard" {
+			continue
+		}
+		for _, user := range node.Users {
+			name, _ := user["name"].(string)
+			address, _ := user["address"].(string)
+			if name != "" && address != "" {
+				a.wireguardPeers[address] = name
+			}
+		}
+	}
+
 	// 注入用户告inbounds
 	singboxConfig := config.SingBoxConfig
 	hasUserChange := false
@@ -594,6 +620,8 @@ func (a *Agent) getTrafficFromClashAPI() (map[string]TrafficData, error) {
 				user = u
 			} else if u, ok := metadata["inbound_user"].(string); ok && u != "" {
 				user = u
+			} else if ip, ok := metadata["sourceIP"].(string); ok {
+				user = a.wireguardPeers[ip]
 			}
 		}
 
@@ -806,6 +834,10 @@ func (a *Agent) Run() {
 		os.Exit(1)
 	}
 
+	if err := a.applyMieruConfig(config.MieruConfig); err != nil {
+		fmt.Printf("⚠️ 应用 mieru 配置失败: %v\n", err)
+	}
+
 	// 发送首次心跳（包含版本信息）
 	if err := a.sendHeartbeat(); err != nil {
 		fmt.Printf("⚠️ 心跳发送失败: %v\n", err)
@@ -861,6 +893,10 @@ func (a *Agent) Run() {
 				}
 			}
 
+			if err := a.applyMieruConfig(config.MieruConfig); err != nil {
+				fmt.Printf("⚠️ 应用 mieru 配置失败: %v\n", err)
+			}
+
 		case <-func() <-chan time.Time {
 			if updateCheckTicker != nil {
 				return updateCheckTicker.C
@@ -882,6 +918,9 @@ func (a *Agent) Run() {
 				updateCheckTicker.Stop()
 			}
 			a.stopSingbox()
+			if a.lastMieruConfig != "" {
+				a.stopMieru()
+			}
 			return
 		}
 	}
@@ -0,0 +1,70 @@
+//go:build !debug
+// +build !debug
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// applyMieruConfig 写入 mita 配置并让 mita 生效
+// mieru 不由 sing-box 承载，需要主机上运行 mita 守护进程 (mita run)
+func (a *Agent) applyMieruConfig(config map[string]interface{}) error {
+	if config == nil {
+		if a.lastMieruConfig != "" {
+			a.stopMieru()
+			a.lastMieruConfig = ""
+		}
+		return nil
+	}
+
+	configJSON, _ := json.MarshalIndent(config, "", "  ")
+	configStr := string(configJSON)
+	if configStr == a.lastMieruConfig {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.mieruConfigPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(a.mieruConfigPath, configJSON, 0600); err != nil {
+		return err
+	}
+
+	if out, err := exec.Command(a.mieruBin, "apply", "config", a.mieruConfigPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("mita apply config: %v: %s", err, out)
+	}
+
+	// 首次应用时启动，之后热重载
+	action := "reload"
+	if a.lastMieruConfig == "" {
+		action = "start"
+	}
+	if out, err := exec.Command(a.mieruBin, action).CombinedOutput(); err != nil {
+		// 已在运行时 start 会失败，尝试 reload
+		if action == "start" {
+			if out2, err2 := exec.Command(a.mieruBin, "reload").CombinedOutput(); err2 != nil {
+				return fmt.Errorf("mita start: %v: %s %s", err2, out, out2)
+			}
+		} else {
+			return fmt.Errorf("mita %s: %v: %s", action, err, out)
+		}
+	}
+
+	a.lastMieruConfig = configStr
+	fmt.Println("✅ mieru 配置已应用")
+	return nil
+}
+
+// stopMieru 停止 mita 代理服务
+func (a *Agent) stopMieru() {
+	if out, err := exec.Command(a.mieruBin, "stop").CombinedOutput(); err != nil {
+		fmt.Printf("⚠️ 停止 mita 失败: %v: %s\n", err, out)
+		return
+	}
+	fmt.Println("⏹️ mita 已停止")
+}
@@ -168,20 +168,33 @@ func autoMigrate(db *gorm.DB) {
 		&model.Plan{},
 		&model.Server{},
 		&model.Order{},
+		&model.OrderRefund{},
 		&model.Setting{},
+		&model.SubscribeTemplate{},
 		&model.Stat{},
 		&model.StatUser{},
 		&model.StatServer{},
 		&model.Ticket{},
 		&model.TicketMessage{},
 		&model.Payment{},
+		&model.PaymentCallback{},
+		&model.RenewalAttempt{},
+		&model.RedeemCode{},
+		&model.RedeemLog{},
+		&model.TrafficPack{},
+		&model.UserTrafficPack{},
+		&model.PlanWaitlist{},
 		&model.Coupon{},
 		&model.InviteCode{},
 		&model.CommissionLog{},
+		&model.CommissionWithdraw{},
+		&model.CommissionWithdrawLog{},
 		&model.Notice{},
 		&model.Knowledge{},
 		&model.Host{},
 		&model.ServerNode{},
+		&model.WireGuardPeer{},
+		&model.ServerRoute{},
 		&model.UserGroup{},
 	}
 
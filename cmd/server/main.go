@@ -71,7 +71,9 @@ func main() {
 		&model.Plan{},
 		&model.Server{},
 		&model.Order{},
+		&model.OrderRefund{},
 		&model.Setting{},
+		&model.SubscribeTemplate{},
 		&model.Stat{},
 		&model.StatUser{},
 		&model.StatServer{},
@@ -79,14 +81,25 @@ func main() {
 		&model.Ticket{},
 		&model.TicketMessage{},
 		&model.Payment{},
+		&model.PaymentCallback{},
+		&model.RenewalAttempt{},
+		&model.RedeemCode{},
+		&model.RedeemLog{},
+		&model.TrafficPack{},
+		&model.UserTrafficPack{},
+		&model.PlanWaitlist{},
 		&model.Coupon{},
 		&model.InviteCode{},
 		&model.CommissionLog{},
+		&model.CommissionWithdraw{},
+		&model.CommissionWithdrawLog{},
 		&model.Notice{},
 		&model.Knowledge{},
 		&model.Host{},
 		&model.ServerNode{},
+		&model.WireGuardPeer{},
 		&model.ServerGroup{},
+		&model.ServerRoute{},
 		&model.UserGroup{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
@@ -116,6 +116,30 @@ func AdminResetUserTraffic(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// AdminSetUserCommission 设置用户返佣类型与个人返佣比例（commission_rate 为空时使用站点比例）
+func AdminSetUserCommission(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		var req struct {
+			CommissionType int  `json:"commission_type"`
+			CommissionRate *int `json:"commission_rate"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := services.Invite.SetUserCommission(id, req.CommissionType, req.CommissionRate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
 // ==================== 节点管理 ====================
 
 // AdminListServers 获取服务器列告
@@ -163,11 +187,15 @@ func AdminCreateServer(services *service.Services) gin.HandlerFunc {
 			Type             string                 `json:"type" binding:"required"`
 			Host             string                 `json:"host" binding:"required"`
 			Port             string                 `json:"port" binding:"required"`
-			HostID           *int64                 `json:"host_id"` // 绑定的主机ID
+			HostID           *int64                 `json:"host_id"`   // 绑定的主机ID
+			ParentID         *int64                 `json:"parent_id"` // 中转节点的落地节点ID
 			Rate             float64                `json:"rate"`
+			RateTimeEnable   bool                   `json:"rate_time_enable"`
+			RateTimeRanges   []model.RateTimeRange  `json:"rate_time_ranges"`
 			Show             bool                   `json:"show"`
 			Tags             []string               `json:"tags"`
 			GroupID          []int64                `json:"group_id"`
+			RouteID          []int64                `json:"route_id"`
 			ProtocolSettings map[string]interface{} `json:"protocol_settings"`
 		}
 
@@ -196,16 +224,32 @@ func AdminCreateServer(services *service.Services) gin.HandlerFunc {
 			groupIDs[i] = g
 		}
 
+		// 转换 RouteID 为 JSONArray
+		routeIDs := make(model.JSONArray, len(req.RouteID))
+		for i, r := range req.RouteID {
+			routeIDs[i] = r
+		}
+
+		// 转换 RateTimeRanges 为 JSONArray
+		rateTimeRanges := make(model.JSONArray, len(req.RateTimeRanges))
+		for i, r := range req.RateTimeRanges {
+			rateTimeRanges[i] = map[string]interface{}{"start": r.Start, "end": r.End, "rate": r.Rate}
+		}
+
 		server := &model.Server{
 			Name:             req.Name,
 			Type:             req.Type,
 			Host:             req.Host,
 			Port:             req.Port,
 			HostID:           req.HostID,
+			ParentID:         req.ParentID,
 			Rate:             req.Rate,
+			RateTimeEnable:   req.RateTimeEnable,
+			RateTimeRanges:   rateTimeRanges,
 			Show:             req.Show,
 			Tags:             tags,
 			GroupIDs:         groupIDs,
+			RouteIDs:         routeIDs,
 			ProtocolSettings: model.JSONMap(req.ProtocolSettings),
 			CreatedAt:        time.Now().Unix(),
 			UpdatedAt:        time.Now().Unix(),
@@ -240,11 +284,15 @@ func AdminUpdateServer(services *service.Services) gin.HandlerFunc {
 			Type             string                 `json:"type"`
 			Host             string                 `json:"host"`
 			Port             string                 `json:"port"`
-			HostID           *int64                 `json:"host_id"` // 绑定的主机ID
+			HostID           *int64                 `json:"host_id"`   // 绑定的主机ID
+			ParentID         *int64                 `json:"parent_id"` // 中转节点的落地节点ID
 			Rate             float64                `json:"rate"`
+			RateTimeEnable   bool                   `json:"rate_time_enable"`
+			RateTimeRanges   []model.RateTimeRange  `json:"rate_time_ranges"`
 			Show             bool                   `json:"show"`
 			Tags             []string               `json:"tags"`
 			GroupID          []int64                `json:"group_id"`
+			RouteID          []int64                `json:"route_id"`
 			ProtocolSettings map[string]interface{} `json:"protocol_settings"`
 		}
 
@@ -273,15 +321,31 @@ func AdminUpdateServer(services *service.Services) gin.HandlerFunc {
 			groupIDs[i] = g
 		}
 
+		// 转换 RouteID 为 JSONArray
+		routeIDs := make(model.JSONArray, len(req.RouteID))
+		for i, r := range req.RouteID {
+			routeIDs[i] = r
+		}
+
+		// 转换 RateTimeRanges 为 JSONArray
+		rateTimeRanges := make(model.JSONArray, len(req.RateTimeRanges))
+		for i, r := range req.RateTimeRanges {
+			rateTimeRanges[i] = map[string]interface{}{"start": r.Start, "end": r.End, "rate": r.Rate}
+		}
+
 		server.Name = req.Name
 		server.Type = req.Type
 		server.Host = req.Host
 		server.Port = req.Port
 		server.HostID = req.HostID
+		server.ParentID = req.ParentID
 		server.Rate = req.Rate
+		server.RateTimeEnable = req.RateTimeEnable
+		server.RateTimeRanges = rateTimeRanges
 		server.Show = req.Show
 		server.Tags = tags
 		server.GroupIDs = groupIDs
+		server.RouteIDs = routeIDs
 		server.ProtocolSettings = model.JSONMap(req.ProtocolSettings)
 		server.UpdatedAt = time.Now().Unix()
 
@@ -365,6 +429,8 @@ func AdminCreatePlan(services *service.Services) gin.HandlerFunc {
 			SpeedLimit     *int             `json:"speed_limit"`
 			DeviceLimit    *int             `json:"device_limit"`
 			Prices         map[string]int64 `json:"prices"`
+			CurrencyPrices model.PriceTable `json:"currency_prices"`
+			CapacityLimit  *int             `json:"capacity_limit"`
 			Show           bool             `json:"show"`
 			Sell           bool             `json:"sell"`
 			GroupID        *int64           `json:"group_id"`
@@ -389,6 +455,8 @@ func AdminCreatePlan(services *service.Services) gin.HandlerFunc {
 			UpgradeGroupID: req.UpgradeGroupID,
 			Sort:           req.Sort,
 			Content:        req.Content,
+			CurrencyPrices: req.CurrencyPrices,
+			CapacityLimit:  req.CapacityLimit,
 			CreatedAt:      time.Now().Unix(),
 			UpdatedAt:      time.Now().Unix(),
 		}
@@ -447,6 +515,8 @@ func AdminUpdatePlan(services *service.Services) gin.HandlerFunc {
 			SpeedLimit     *int             `json:"speed_limit"`
 			DeviceLimit    *int             `json:"device_limit"`
 			Prices         map[string]int64 `json:"prices"`
+			CurrencyPrices model.PriceTable `json:"currency_prices"`
+			CapacityLimit  *int             `json:"capacity_limit"`
 			Show           bool             `json:"show"`
 			Sell           bool             `json:"sell"`
 			GroupID        *int64           `json:"group_id"`
@@ -471,6 +541,10 @@ func AdminUpdatePlan(services *service.Services) gin.HandlerFunc {
 		plan.Sort = req.Sort
 		plan.Content = req.Content
 		plan.UpdatedAt = time.Now().Unix()
+		if req.CurrencyPrices != nil {
+			plan.CurrencyPrices = req.CurrencyPrices
+		}
+		plan.CapacityLimit = req.CapacityLimit
 
 		// 更新价格
 		if req.Prices != nil {
@@ -602,6 +676,74 @@ func AdminUpdateOrderStatus(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// AdminRefundOrder 订单退款（全额或部分）
+func AdminRefundOrder(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		var req struct {
+			Amount     int64  `json:"amount"` // 为 0 时退还全部剩余金额
+			Method     string `json:"method" binding:"required"`
+			ExternalNo string `json:"external_no"`
+			Reason     string `json:"reason"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		refundReq := service.RefundRequest{
+			Amount:     req.Amount,
+			Method:     req.Method,
+			ExternalNo: req.ExternalNo,
+			Reason:     req.Reason,
+		}
+		if admin := getUserFromContext(c); admin != nil {
+			refundReq.OperatorID = admin.ID
+		}
+
+		refund, err := services.Refund.Refund(id, refundReq)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": refund})
+	}
+}
+
+// AdminListOrderRefunds 获取订单退款记录
+func AdminListOrderRefunds(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		refunds, err := services.Refund.GetRefunds(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": refunds})
+	}
+}
+
+// AdminListRefunds 获取退款记录列表
+func AdminListRefunds(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+		refunds, total, err := services.Refund.List(page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": refunds, "total": total})
+	}
+}
+
 // ==================== 工单管理 ====================
 
 // AdminListTickets 获取工单列表
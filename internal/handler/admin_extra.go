@@ -45,6 +45,23 @@ func AdminUserStats(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// AdminTrialStats 注册试用转化统计
+func AdminTrialStats(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+		endAt := time.Now().Unix()
+		startAt := endAt - int64(days*86400)
+
+		stats, err := services.Stats.GetTrialConversion(startAt, endAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": stats})
+	}
+}
+
 // AdminTrafficStats 流量统计
 func AdminTrafficStats(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -302,10 +319,200 @@ func AdminDeleteCoupon(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// AdminListTrafficPacks 流量包列表
+func AdminListTrafficPacks(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		packs, err := services.TrafficPack.GetAll()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": packs})
+	}
+}
+
+// AdminCreateTrafficPack 创建流量包
+func AdminCreateTrafficPack(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var pack model.TrafficPack
+		if err := c.ShouldBindJSON(&pack); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := services.TrafficPack.Create(&pack); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": pack})
+	}
+}
+
+// AdminUpdateTrafficPack 更新流量包
+func AdminUpdateTrafficPack(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		pack, err := services.TrafficPack.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "traffic pack not found"})
+			return
+		}
+
+		if err := c.ShouldBindJSON(pack); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		pack.ID = id
+
+		if err := services.TrafficPack.Update(pack); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": pack})
+	}
+}
+
+// AdminDeleteTrafficPack 删除流量包
+func AdminDeleteTrafficPack(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		if err := services.TrafficPack.Delete(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
+// AdminListRedeemCodes 兑换码列表
+func AdminListRedeemCodes(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+		codes, total, err := services.Redeem.List(c.Query("batch_no"), page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": codes, "total": total})
+	}
+}
+
+// AdminGenerateRedeemCodes 批量生成兑换码
+func AdminGenerateRedeemCodes(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			model.RedeemCode
+			Count int `json:"count" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		codes, err := services.Redeem.GenerateCodes(&req.RedeemCode, req.Count)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": codes})
+	}
+}
+
+// AdminExportRedeemCodes 导出批次兑换码 CSV
+func AdminExportRedeemCodes(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batchNo := c.Query("batch_no")
+		if batchNo == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "batch_no is required"})
+			return
+		}
+
+		data, err := services.Redeem.ExportCSV(batchNo)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename=redeem-"+batchNo+".csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	}
+}
+
+// AdminUpdateRedeemCode 更新兑换码
+func AdminUpdateRedeemCode(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		code, err := services.Redeem.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "redeem code not found"})
+			return
+		}
+
+		// 兑换码、批次与已用次数不允许修改
+		redeemCode, batchNo, usedCount := code.Code, code.BatchNo, code.UsedCount
+		if err := c.ShouldBindJSON(code); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		code.ID = id
+		code.Code, code.BatchNo, code.UsedCount = redeemCode, batchNo, usedCount
+
+		if err := services.Redeem.Update(code); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": code})
+	}
+}
+
+// AdminDeleteRedeemCode 删除兑换码
+func AdminDeleteRedeemCode(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		if err := services.Redeem.Delete(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
+// AdminListRedeemLogs 兑换记录
+func AdminListRedeemLogs(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		codeID, _ := strconv.ParseInt(c.Query("code_id"), 10, 64)
+		userID, _ := strconv.ParseInt(c.Query("user_id"), 10, 64)
+
+		logs, total, err := services.Redeem.GetLogs(codeID, userID, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": logs, "total": total})
+	}
+}
+
 // AdminListPayments 支付方式列表
 func AdminListPayments(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		payments, err := services.Payment.GetEnabledPayments()
+		payments, err := services.Payment.GetAllPayments()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -315,22 +522,106 @@ func AdminListPayments(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// AdminListPaymentGateways 支付网关及配置项
+func AdminListPaymentGateways(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": services.Payment.GetGateways()})
+	}
+}
+
 // AdminCreatePayment 创建支付方式
 func AdminCreatePayment(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: 实现创建支付方式
-		c.JSON(http.StatusOK, gin.H{"data": true})
+		var payment model.Payment
+		if err := c.ShouldBindJSON(&payment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := services.Payment.CreatePaymentMethod(&payment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": payment})
 	}
 }
 
 // AdminUpdatePayment 更新支付方式
 func AdminUpdatePayment(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: 实现更新支付方式
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		payment, err := services.Payment.GetPaymentMethod(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+			return
+		}
+
+		// 回调地址依赖 UUID，不允许修改
+		uuid := payment.UUID
+		if err := c.ShouldBindJSON(payment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		payment.ID = id
+		payment.UUID = uuid
+
+		if err := services.Payment.UpdatePaymentMethod(payment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": payment})
+	}
+}
+
+// AdminDeletePayment 删除支付方式
+func AdminDeletePayment(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		if err := services.Payment.DeletePaymentMethod(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{"data": true})
 	}
 }
 
+// AdminListPaymentCallbacks 支付回调日志
+func AdminListPaymentCallbacks(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+		callbacks, total, err := services.Payment.ListCallbacks(c.Query("trade_no"), page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": callbacks, "total": total})
+	}
+}
+
+// AdminReplayPaymentCallback 重放支付回调
+func AdminReplayPaymentCallback(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		callback, err := services.Payment.ReplayCallback(id)
+		if callback == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 处理失败时同样返回本次重放的日志，便于排查
+		c.JSON(http.StatusOK, gin.H{"data": callback})
+	}
+}
+
 // ==================== 用户组管告====================
 
 // AdminListServerGroups 获取用户组列告
@@ -396,3 +687,305 @@ func AdminDeleteServerGroup(services *service.Services) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"data": true})
 	}
 }
+
+// AdminListServerRoutes 获取路由规则列表
+func AdminListServerRoutes(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routes, err := services.ServerRoute.GetAll()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": routes})
+	}
+}
+
+// AdminCreateServerRoute 创建路由规则
+func AdminCreateServerRoute(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Remarks     string  `json:"remarks" binding:"required"`
+			Match       string  `json:"match" binding:"required"`
+			Action      string  `json:"action" binding:"required"`
+			ActionValue *string `json:"action_value"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		route := &model.ServerRoute{
+			Remarks:     req.Remarks,
+			Match:       req.Match,
+			Action:      req.Action,
+			ActionValue: req.ActionValue,
+		}
+		if err := services.ServerRoute.Create(route); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": route})
+	}
+}
+
+// AdminUpdateServerRoute 更新路由规则
+func AdminUpdateServerRoute(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		route, err := services.ServerRoute.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "route not found"})
+			return
+		}
+
+		var req struct {
+			Remarks     string  `json:"remarks" binding:"required"`
+			Match       string  `json:"match" binding:"required"`
+			Action      string  `json:"action" binding:"required"`
+			ActionValue *string `json:"action_value"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		route.Remarks = req.Remarks
+		route.Match = req.Match
+		route.Action = req.Action
+		route.ActionValue = req.ActionValue
+		if err := services.ServerRoute.Update(route); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": route})
+	}
+}
+
+// AdminDeleteServerRoute 删除路由规则
+func AdminDeleteServerRoute(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err := services.ServerRoute.Delete(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
+// AdminListSubscribeTemplates 获取订阅模板列表
+func AdminListSubscribeTemplates(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templates, err := services.SubscribeTemplate.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": templates})
+	}
+}
+
+// AdminGetSubscribeTemplate 获取订阅模板
+func AdminGetSubscribeTemplate(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tpl, err := services.SubscribeTemplate.Get(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": tpl})
+	}
+}
+
+// AdminSaveSubscribeTemplate 保存订阅模板
+func AdminSaveSubscribeTemplate(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Content string `json:"content" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := services.SubscribeTemplate.Save(c.Param("name"), req.Content); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
+// AdminResetSubscribeTemplate 恢复内置订阅模板
+func AdminResetSubscribeTemplate(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := services.SubscribeTemplate.Reset(c.Param("name")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
+// AdminPreviewSubscribeTemplate 预览订阅模板，可指定用户以使用其真实节点
+func AdminPreviewSubscribeTemplate(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Content string `json:"content"`
+			UserID  int64  `json:"user_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		name := c.Param("name")
+		content := req.Content
+		if content == "" {
+			tpl, err := services.SubscribeTemplate.Get(name)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			content = tpl.Content
+		}
+
+		var output string
+		var err error
+		if req.UserID > 0 {
+			user, uerr := services.User.GetByID(req.UserID)
+			if uerr != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				return
+			}
+			servers, serr := services.UserGroup.GetAvailableServersForUser(user)
+			if serr != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": serr.Error()})
+				return
+			}
+			output, err = services.SubscribeTemplate.Render(name, content, servers, user)
+		} else {
+			output, err = services.SubscribeTemplate.Preview(name, content)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": output})
+	}
+}
+
+// AdminListPlanWaitlist 获取套餐候补队列
+func AdminListPlanWaitlist(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		planID, _ := strconv.ParseInt(c.Query("plan_id"), 10, 64)
+
+		var status *int
+		if s := c.Query("status"); s != "" {
+			v, _ := strconv.Atoi(s)
+			status = &v
+		}
+
+		entries, total, err := services.Waitlist.List(planID, status, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": entries, "total": total})
+	}
+}
+
+// AdminListCommissionWithdrawals 获取佣金提现申请
+func AdminListCommissionWithdrawals(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		userID, _ := strconv.ParseInt(c.Query("user_id"), 10, 64)
+
+		var status *int
+		if s := c.Query("status"); s != "" {
+			v, _ := strconv.Atoi(s)
+			status = &v
+		}
+
+		withdrawals, total, err := services.Withdraw.List(userID, status, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": withdrawals, "total": total})
+	}
+}
+
+// AdminApproveCommissionWithdraw 审核通过佣金提现（已线下打款）
+func AdminApproveCommissionWithdraw(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		var req struct {
+			Note string `json:"note"`
+		}
+		_ = c.ShouldBindJSON(&req) // 备注可选，允许空请求体
+
+		var operatorID int64
+		if admin := getUserFromContext(c); admin != nil {
+			operatorID = admin.ID
+		}
+
+		withdraw, err := services.Withdraw.Approve(id, operatorID, req.Note)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": withdraw})
+	}
+}
+
+// AdminRejectCommissionWithdraw 拒绝佣金提现，冻结金额退回佣金余额
+func AdminRejectCommissionWithdraw(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		var req struct {
+			Note string `json:"note" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var operatorID int64
+		if admin := getUserFromContext(c); admin != nil {
+			operatorID = admin.ID
+		}
+
+		withdraw, err := services.Withdraw.Reject(id, operatorID, req.Note)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": withdraw})
+	}
+}
+
+// AdminListCommissionWithdrawLogs 获取佣金提现审计记录
+func AdminListCommissionWithdrawLogs(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		logs, err := services.Withdraw.GetLogs(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": logs})
+	}
+}
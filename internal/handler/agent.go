@@ -240,16 +240,17 @@ func AgentReportTraffic(services *service.Services) gin.HandlerFunc {
 			var serverType string = "unknown"
 			var serverID int64 = nodeData.ID
 
-			// 尝试和Server 获取
+			// 尝试和Server 获取（按时段计算生效倍率）
+			now := services.Setting.RateTime()
 			server, err := services.Server.FindServer(nodeData.ID, "")
 			if err == nil && server != nil {
-				rate = server.Rate
+				rate = server.RateAt(now)
 				serverType = server.Type
 			} else {
 				// 尝试和ServerNode 获取
 				node, err := services.Host.GetNodeByID(nodeData.ID)
 				if err == nil && node != nil {
-					rate = node.Rate
+					rate = node.RateAt(now)
 					serverType = node.Type
 				}
 			}
@@ -270,8 +271,10 @@ func AgentReportTraffic(services *service.Services) gin.HandlerFunc {
 				u := int64(float64(userData.Upload) * rate)
 				d := int64(float64(userData.Download) * rate)
 
-				// 更新用户流量
-				services.User.UpdateTraffic(user.ID, u, d)
+				// 更新用户流量，失败时不记录统计
+				if err := services.User.UpdateTraffic(user.ID, u, d); err != nil {
+					continue
+				}
 
 				// 记录用户流量统计（日统计和
 				services.NodeSync.RecordUserTrafficStat(user.ID, rate, u, d)
@@ -410,6 +413,12 @@ func AdminListNodes(services *service.Services) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+
+		// 启用时段倍率的节点显示当前倍率
+		now := services.Setting.RateTime()
+		for i := range nodes {
+			nodes[i].DisplayName = nodes[i].NameAt(now)
+		}
 		c.JSON(http.StatusOK, gin.H{"data": nodes})
 	}
 }
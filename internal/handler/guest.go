@@ -26,16 +26,18 @@ func GuestRegister(services *service.Services) gin.HandlerFunc {
 		}
 
 		// 检查是否需要邮箱验告
-		if services.Setting.GetBool(service.SettingMailVerify, false) {
-			if req.EmailCode == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "请输入邮箱验证码"})
-				return
-			}
-			// 验证邮箱验证码
+		if services.Setting.GetBool(service.SettingMailVerify, false) && req.EmailCode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入邮箱验证码"})
+			return
+		}
+		// 验证邮箱验证码（未强制验证时，填写验证码可用于领取需验证的试用）
+		emailVerified := false
+		if req.EmailCode != "" {
 			if !services.User.VerifyEmailCode(req.Email, req.EmailCode) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误或已过期"})
 				return
 			}
+			emailVerified = true
 		}
 
 		// 检查IP 注册限制
@@ -66,7 +68,7 @@ func GuestRegister(services *service.Services) gin.HandlerFunc {
 			inviteUserID = &inviteCode.UserID
 		}
 
-		user, err := services.User.RegisterWithIP(req.Email, req.Password, inviteUserID, clientIP)
+		user, err := services.User.RegisterWithIP(req.Email, req.Password, inviteUserID, clientIP, emailVerified)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
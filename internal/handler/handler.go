@@ -63,10 +63,19 @@ func RegisterRoutes(r *gin.Engine, services *service.Services, cfg *config.Confi
 			user.GET("/subscribe", UserSubscribe(services))
 			user.POST("/reset_token", UserResetToken(services))
 			user.POST("/reset_uuid", UserResetUUID(services))
+			user.GET("/wireguard/:id", UserWireGuardConfig(services))
 			user.POST("/change_password", UserChangePassword(services))
+			user.POST("/auto_renew", UserSetAutoRenew(services))
 			user.GET("/orders", UserOrders(services))
+			user.GET("/order/preview", UserPreviewOrder(services))
 			user.POST("/order/create", UserCreateOrder(services))
 			user.POST("/order/cancel", UserCancelOrder(services))
+			user.GET("/traffic_packs", UserTrafficPacks(services))
+			user.GET("/traffic_pack/mine", UserOwnedTrafficPacks(services))
+			user.POST("/traffic_pack/order", UserCreateTrafficPackOrder(services))
+			user.GET("/plan/waitlist", UserWaitlist(services))
+			user.POST("/plan/waitlist/join", UserJoinWaitlist(services))
+			user.POST("/plan/waitlist/leave", UserLeaveWaitlist(services))
 
 			// Ticket routes
 			user.GET("/tickets", UserTickets(services))
@@ -79,12 +88,16 @@ func RegisterRoutes(r *gin.Engine, services *service.Services, cfg *config.Confi
 			user.POST("/order/pay", CreatePayment(services))
 			user.GET("/order/check", CheckPaymentStatus(services))
 			user.POST("/coupon/check", CheckCoupon(services))
+			user.POST("/redeem", UserRedeem(services))
 
 			// Invite routes
 			user.GET("/invite", GetInviteInfo(services))
 			user.POST("/invite/generate", GenerateInviteCode(services))
 			user.GET("/invite/commission", GetCommissionLogs(services))
 			user.POST("/invite/withdraw", WithdrawCommission(services))
+			user.GET("/invite/withdrawals", GetCommissionWithdrawals(services))
+			user.POST("/invite/withdraw/request", RequestCommissionWithdraw(services))
+			user.POST("/invite/withdraw/cancel", CancelCommissionWithdraw(services))
 		}
 
 		// Client routes (订阅获取)
@@ -171,22 +184,38 @@ func RegisterRoutes(r *gin.Engine, services *service.Services, cfg *config.Confi
 			admin.PUT("/user/:id", AdminUpdateUser(services))
 			admin.DELETE("/user/:id", AdminDeleteUser(services))
 			admin.POST("/user/:id/reset_traffic", AdminResetUserTraffic(services))
+			admin.POST("/user/:id/commission", AdminSetUserCommission(services))
 
 			// Plan management
 			admin.GET("/plans", AdminListPlans(services))
 			admin.POST("/plan", AdminCreatePlan(services))
 			admin.PUT("/plan/:id", AdminUpdatePlan(services))
 			admin.DELETE("/plan/:id", AdminDeletePlan(services))
+			admin.GET("/plan_waitlist", AdminListPlanWaitlist(services))
+			admin.GET("/commission_withdrawals", AdminListCommissionWithdrawals(services))
+			admin.POST("/commission_withdraw/:id/approve", AdminApproveCommissionWithdraw(services))
+			admin.POST("/commission_withdraw/:id/reject", AdminRejectCommissionWithdraw(services))
+			admin.GET("/commission_withdraw/:id/logs", AdminListCommissionWithdrawLogs(services))
 
 			// Order management
 			admin.GET("/orders", AdminListOrders(services))
 			admin.GET("/order/:id", AdminGetOrder(services))
 			admin.PUT("/order/:id/status", AdminUpdateOrderStatus(services))
+			admin.POST("/order/:id/refund", AdminRefundOrder(services))
+			admin.GET("/order/:id/refunds", AdminListOrderRefunds(services))
+			admin.GET("/refunds", AdminListRefunds(services))
 
 			// Settings
 			admin.GET("/settings", AdminGetSettings(services))
 			admin.POST("/settings", AdminUpdateSettings(services))
 
+			// Subscribe templates (订阅模板)
+			admin.GET("/subscribe-templates", AdminListSubscribeTemplates(services))
+			admin.GET("/subscribe-template/:name", AdminGetSubscribeTemplate(services))
+			admin.PUT("/subscribe-template/:name", AdminSaveSubscribeTemplate(services))
+			admin.DELETE("/subscribe-template/:name", AdminResetSubscribeTemplate(services))
+			admin.POST("/subscribe-template/:name/preview", AdminPreviewSubscribeTemplate(services))
+
 			// Ticket management
 			admin.GET("/tickets", AdminListTickets(services))
 			admin.GET("/ticket/:id", AdminTicketDetail(services))
@@ -197,6 +226,7 @@ func RegisterRoutes(r *gin.Engine, services *service.Services, cfg *config.Confi
 			admin.GET("/stats/overview", AdminStatsOverview(services))
 			admin.GET("/stats/order", AdminOrderStats(services))
 			admin.GET("/stats/user", AdminUserStats(services))
+			admin.GET("/stats/trial", AdminTrialStats(services))
 			admin.GET("/stats/traffic", AdminTrafficStats(services))
 			admin.GET("/stats/server_ranking", AdminServerRanking(services))
 			admin.GET("/stats/user_ranking", AdminUserRanking(services))
@@ -219,16 +249,38 @@ func RegisterRoutes(r *gin.Engine, services *service.Services, cfg *config.Confi
 			admin.PUT("/coupon/:id", AdminUpdateCoupon(services))
 			admin.DELETE("/coupon/:id", AdminDeleteCoupon(services))
 
+			// Traffic pack management
+			admin.GET("/traffic_packs", AdminListTrafficPacks(services))
+			admin.POST("/traffic_pack", AdminCreateTrafficPack(services))
+			admin.PUT("/traffic_pack/:id", AdminUpdateTrafficPack(services))
+			admin.DELETE("/traffic_pack/:id", AdminDeleteTrafficPack(services))
+
+			// Redeem code management
+			admin.GET("/redeem_codes", AdminListRedeemCodes(services))
+			admin.POST("/redeem_code/generate", AdminGenerateRedeemCodes(services))
+			admin.GET("/redeem_code/export", AdminExportRedeemCodes(services))
+			admin.PUT("/redeem_code/:id", AdminUpdateRedeemCode(services))
+			admin.DELETE("/redeem_code/:id", AdminDeleteRedeemCode(services))
+			admin.GET("/redeem_logs", AdminListRedeemLogs(services))
+
 			// Payment management
 			admin.GET("/payments", AdminListPayments(services))
 			admin.POST("/payment", AdminCreatePayment(services))
 			admin.PUT("/payment/:id", AdminUpdatePayment(services))
+			admin.DELETE("/payment/:id", AdminDeletePayment(services))
+			admin.GET("/payment/gateways", AdminListPaymentGateways(services))
+			admin.GET("/payment/callbacks", AdminListPaymentCallbacks(services))
+			admin.POST("/payment/callback/:id/replay", AdminReplayPaymentCallback(services))
 
 			// Server Group management (用户组管和
 			admin.GET("/server_groups", AdminListServerGroups(services))
 			admin.POST("/server_group", AdminCreateServerGroup(services))
 			admin.PUT("/server_group/:id", AdminUpdateServerGroup(services))
 			admin.DELETE("/server_group/:id", AdminDeleteServerGroup(services))
+			admin.GET("/server_routes", AdminListServerRoutes(services))
+			admin.POST("/server_route", AdminCreateServerRoute(services))
+			admin.PUT("/server_route/:id", AdminUpdateServerRoute(services))
+			admin.DELETE("/server_route/:id", AdminDeleteServerRoute(services))
 
 			// Host management (主机管理)
 			admin.GET("/hosts", AdminListHosts(services))
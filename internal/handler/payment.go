@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"bytes"
+	"io"
 	"net/http"
+	"strconv"
 
+	"dashgo/internal/payment"
 	"dashgo/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -20,9 +24,11 @@ func GetPaymentMethods(services *service.Services) gin.HandlerFunc {
 		result := make([]map[string]interface{}, 0, len(payments))
 		for _, p := range payments {
 			result = append(result, map[string]interface{}{
-				"id":   p.ID,
-				"name": p.Name,
-				"icon": p.Icon,
+				"id":                   p.ID,
+				"name":                 p.Name,
+				"icon":                 p.Icon,
+				"handling_fee_fixed":   p.HandlingFeeFixed,
+				"handling_fee_percent": p.HandlingFeePercent,
 			})
 		}
 
@@ -85,6 +91,10 @@ func PaymentNotify(services *service.Services) gin.HandlerFunc {
 			}
 		}
 
+		// 保留原始请求体，部分网关需要对其校验签名
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
 		// POST 参数
 		c.Request.ParseForm()
 		for k, v := range c.Request.PostForm {
@@ -93,7 +103,12 @@ func PaymentNotify(services *service.Services) gin.HandlerFunc {
 			}
 		}
 
-		if err := services.Payment.HandleCallback(paymentUUID, params); err != nil {
+		notification := &payment.Notification{
+			Params: params,
+			Body:   body,
+			Header: c.Request.Header,
+		}
+		if err := services.Payment.HandleCallback(paymentUUID, notification); err != nil {
 			c.String(http.StatusBadRequest, "fail")
 			return
 		}
@@ -254,3 +269,115 @@ func WithdrawCommission(services *service.Services) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"data": true})
 	}
 }
+
+// GetCommissionWithdrawals 获取佣金提现申请记录及提现配置
+func GetCommissionWithdrawals(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+		withdrawals, total, err := services.Withdraw.GetUserWithdrawals(user.ID, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":   withdrawals,
+			"total":  total,
+			"config": services.Withdraw.GetConfig(),
+		})
+	}
+}
+
+// RequestCommissionWithdraw 申请佣金提现到外部账户
+func RequestCommissionWithdraw(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			Method  string `json:"method" binding:"required"`
+			Account string `json:"account" binding:"required"`
+			Amount  int64  `json:"amount" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		withdraw, err := services.Withdraw.Request(user.ID, req.Method, req.Account, req.Amount)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": withdraw})
+	}
+}
+
+// CancelCommissionWithdraw 取消待审核的佣金提现申请
+func CancelCommissionWithdraw(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			ID int64 `json:"id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		withdraw, err := services.Withdraw.Cancel(user.ID, req.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": withdraw})
+	}
+}
+
+// UserRedeem 使用兑换码
+func UserRedeem(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		log, err := services.Redeem.Redeem(user.ID, req.Code)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": log})
+	}
+}
@@ -110,11 +110,21 @@ func ServerPush(services *service.Services) gin.HandlerFunc {
 			}
 		}
 
-		if err := services.User.TrafficFetch(server, trafficData); err != nil {
+		// 按时段计算生效倍率
+		rate := server.RateAt(services.Setting.RateTime())
+		charged, err := services.User.TrafficFetch(server, rate, trafficData)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		// 仅为成功计费的用户记录流量统计与流量日志
+		for userID, traffic := range charged {
+			u, d := traffic[0], traffic[1]
+			services.NodeSync.RecordUserTrafficStat(userID, rate, u, d)
+			services.NodeSync.RecordTrafficLog(userID, server.ID, u, d, rate)
+		}
+
 		c.JSON(http.StatusOK, gin.H{"data": true})
 	}
 }
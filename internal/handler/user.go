@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
@@ -78,6 +79,12 @@ func UserResetUUID(services *service.Services) gin.HandlerFunc {
 			return
 		}
 
+		// 重置 UUID 同时轮换 WireGuard 密钥，先轮换密钥，失败时 UUID 保持不变
+		if err := services.WireGuard.RotatePeer(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		newUUID, err := services.User.ResetUUID(user.ID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -88,6 +95,49 @@ func UserResetUUID(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// UserWireGuardConfig 下载 WireGuard 节点配置文件
+func UserWireGuardConfig(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		if !user.IsActive() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "subscription expired"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		servers, err := services.UserGroup.GetAvailableServersForUser(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, server := range servers {
+			if server.ID != id || server.Type != model.ServerTypeWireGuard {
+				continue
+			}
+			conf := protocol.GenerateWireGuardConf(server, user)
+			if conf == "" {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "wireguard peer unavailable"})
+				return
+			}
+			c.Header("content-disposition", "attachment; filename=wg"+strconv.FormatInt(server.ID, 10)+".conf")
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(conf))
+			return
+		}
+
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+	}
+}
+
 // UserChangePassword 修改密码
 func UserChangePassword(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -116,6 +166,33 @@ func UserChangePassword(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// UserSetAutoRenew 开启或关闭自动续费
+func UserSetAutoRenew(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := services.User.SetAutoRenew(user.ID, req.Enabled); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
 // UserOrders 获取用户订单列表
 func UserOrders(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -148,6 +225,8 @@ func UserCreateOrder(services *service.Services) gin.HandlerFunc {
 			PlanID     int64  `json:"plan_id" binding:"required"`
 			Period     string `json:"period" binding:"required"`
 			CouponCode string `json:"coupon_code"`
+			Currency   string `json:"currency"`
+			UseBalance bool   `json:"use_balance"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -155,7 +234,7 @@ func UserCreateOrder(services *service.Services) gin.HandlerFunc {
 			return
 		}
 
-		order, err := services.Order.CreateOrderWithCoupon(user.ID, req.PlanID, req.Period, req.CouponCode)
+		order, err := services.Order.CreateOrderWithCoupon(user.ID, req.PlanID, req.Period, req.CouponCode, req.Currency, req.UseBalance)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -165,6 +244,173 @@ func UserCreateOrder(services *service.Services) gin.HandlerFunc {
 	}
 }
 
+// UserPreviewOrder 订单金额预览（含优惠券与升级折抵明细）
+func UserPreviewOrder(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			PlanID     int64  `form:"plan_id" binding:"required"`
+			Period     string `form:"period" binding:"required"`
+			CouponCode string `form:"coupon_code"`
+			Currency   string `form:"currency"`
+			UseBalance bool   `form:"use_balance"`
+		}
+
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		quote, err := services.Order.Quote(user.ID, req.PlanID, req.Period, req.CouponCode, req.Currency, req.UseBalance)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": quote})
+	}
+}
+
+// UserTrafficPacks 可购买的流量包
+func UserTrafficPacks(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		packs, err := services.TrafficPack.GetAvailable()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": packs})
+	}
+}
+
+// UserOwnedTrafficPacks 用户已购流量包
+func UserOwnedTrafficPacks(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		packs, err := services.TrafficPack.GetUserPacks(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": packs})
+	}
+}
+
+// UserCreateTrafficPackOrder 购买流量包
+func UserCreateTrafficPackOrder(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			PackID   int64  `json:"pack_id" binding:"required"`
+			Currency string `json:"currency"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := services.Order.CreateTrafficPackOrder(user.ID, req.PackID, req.Currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": order})
+	}
+}
+
+// UserWaitlist 获取我的套餐候补
+func UserWaitlist(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		entries, err := services.Waitlist.GetUserEntries(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": entries})
+	}
+}
+
+// UserJoinWaitlist 候补售罄套餐
+func UserJoinWaitlist(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			PlanID int64 `json:"plan_id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		entry, err := services.Waitlist.Join(user.ID, req.PlanID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": entry})
+	}
+}
+
+// UserLeaveWaitlist 取消套餐候补
+func UserLeaveWaitlist(services *service.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getUserFromContext(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req struct {
+			PlanID int64 `json:"plan_id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := services.Waitlist.Leave(user.ID, req.PlanID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
+
 // UserCancelOrder 取消订单
 func UserCancelOrder(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -219,9 +465,8 @@ func ClientSubscribe(services *service.Services) gin.HandlerFunc {
 			return
 		}
 
-		// 根据 User-Agent 返回不同格式
-		ua := c.GetHeader("User-Agent")
-		format := c.Query("format")
+		// 根据 ?format= 与 User-Agent 选择订阅格式
+		subFormat := protocol.ResolveSubscribeFormat(c.Query("format"), c.GetHeader("User-Agent"))
 
 		// 获取站点名称
 		siteName, _ := services.Setting.Get("app_name")
@@ -229,21 +474,20 @@ func ClientSubscribe(services *service.Services) gin.HandlerFunc {
 			siteName = "XBoard"
 		}
 
-		// 设置订阅信息告
+		// 设置订阅信息头
 		c.Header("subscription-userinfo", formatSubscriptionInfo(user))
-		c.Header("profile-update-interval", "24")
-		c.Header("profile-title", siteName)
-		c.Header("content-disposition", "attachment; filename="+siteName)
-
-		switch {
-		case format == "singbox" || containsAny(ua, "sing-box", "hiddify", "sfm"):
-			c.JSON(http.StatusOK, generateSingBoxConfig(servers, user))
-		case format == "clash" || containsAny(ua, "clash", "stash"):
-			c.String(http.StatusOK, generateClashConfig(servers, user))
-		default:
-			// 默认返回 base64 编码的链告
-			c.String(http.StatusOK, generateBase64Links(servers, user))
+		for k, v := range subFormat.ResponseHeaders(siteName) {
+			c.Header(k, v)
+		}
+
+		// 优先使用后台自定义模板，模板渲染失败时回退到内置模板
+		content, err := subFormat.Build(services.SubscribeTemplate.GetContent(subFormat.Template), servers, user)
+		if err != nil {
+			log.Printf("[Subscribe] render %s template failed: %v", subFormat.Name, err)
+			content = subFormat.Generate(servers, user)
 		}
+
+		c.Data(http.StatusOK, subFormat.ContentType, []byte(content))
 	}
 }
 
@@ -262,36 +506,10 @@ func formatSubscriptionInfo(user *model.User) string {
 	}
 	return "upload=" + strconv.FormatInt(user.U, 10) +
 		"; download=" + strconv.FormatInt(user.D, 10) +
-		"; total=" + strconv.FormatInt(user.TransferEnable, 10) +
+		"; total=" + strconv.FormatInt(user.TotalTraffic(), 10) +
 		"; expire=" + strconv.FormatInt(expiredAt, 10)
 }
 
-func containsAny(s string, substrs ...string) bool {
-	for _, substr := range substrs {
-		if len(s) >= len(substr) {
-			for i := 0; i <= len(s)-len(substr); i++ {
-				if s[i:i+len(substr)] == substr {
-					return true
-				}
-			}
-		}
-	}
-	return false
-}
-
-// 这些函数调用 protocol 告
-func generateSingBoxConfig(servers []model.ServerInfo, user *model.User) map[string]interface{} {
-	return protocol.GenerateSingBoxConfig(servers, user)
-}
-
-func generateClashConfig(servers []model.ServerInfo, user *model.User) string {
-	return protocol.GenerateClashConfig(servers, user)
-}
-
-func generateBase64Links(servers []model.ServerInfo, user *model.User) string {
-	return protocol.GenerateBase64Links(servers, user)
-}
-
 // UserTickets 获取用户工单列表
 func UserTickets(services *service.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
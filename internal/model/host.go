@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // Host 主机模型 - 运行 sing-box 的服务器
 type Host struct {
 	ID            int64   `gorm:"primaryKey;column:id" json:"id"`
@@ -34,12 +36,17 @@ type ServerNode struct {
 	Type              string    `gorm:"column:type" json:"type"` // shadowsocks, vless, trojan 等
 	ListenPort        int       `gorm:"column:listen_port" json:"listen_port"`
 	GroupIDs          JSONArray `gorm:"column:group_ids;type:json" json:"group_ids"`
+	RouteIDs          JSONArray `gorm:"column:route_ids;type:json" json:"route_ids"`
 	Rate              float64   `gorm:"column:rate;default:1" json:"rate"`
+	RateTimeEnable    bool      `gorm:"column:rate_time_enable;default:false" json:"rate_time_enable"`
+	RateTimeRanges    JSONArray `gorm:"column:rate_time_ranges;type:json" json:"rate_time_ranges"`
 	Show              bool      `gorm:"column:show;default:true" json:"show"`
 	Sort              *int      `gorm:"column:sort" json:"sort"`
 	ProtocolSettings  JSONMap   `gorm:"column:protocol_settings;type:json" json:"protocol_settings"`
 	TLSSettings       JSONMap   `gorm:"column:tls_settings;type:json" json:"tls_settings"`
 	TransportSettings JSONMap   `gorm:"column:transport_settings;type:json" json:"transport_settings"`
+	WireGuardKey      string    `gorm:"column:wireguard_private_key;size:64" json:"-"` // WireGuard 服务端私钥，不随节点信息下发
+	DisplayName       string    `gorm:"-" json:"display_name,omitempty"`               // 带当前倍率的显示名称，只读
 	CreatedAt         int64     `gorm:"column:created_at;autoCreateTime" json:"created_at"`
 	UpdatedAt         int64     `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
@@ -61,6 +68,8 @@ const (
 	NodeTypeNaive       = "naive"
 	NodeTypeSocks       = "socks"
 	NodeTypeHTTP        = "http"
+	NodeTypeMieru       = "mieru"
+	NodeTypeWireGuard   = "wireguard"
 )
 
 // GetGroupIDsAsInt64 获取 group_ids 为 int64 数组
@@ -74,3 +83,25 @@ func (n *ServerNode) GetGroupIDsAsInt64() []int64 {
 	}
 	return result
 }
+
+// RateAt 获取指定时间的生效倍率
+func (n *ServerNode) RateAt(t time.Time) float64 {
+	return rateAt(n.Rate, n.RateTimeEnable, n.RateTimeRanges, t)
+}
+
+// NameAt 获取指定时间的显示名称，启用时段倍率时附带当前倍率
+func (n *ServerNode) NameAt(t time.Time) string {
+	return rateName(n.Name, n.RateTimeEnable, n.RateAt(t))
+}
+
+// GetRouteIDsAsInt64 获取 route_ids 为 int64 数组
+func (n *ServerNode) GetRouteIDsAsInt64() []int64 {
+	result := make([]int64, 0)
+	for _, v := range n.RouteIDs {
+		switch val := v.(type) {
+		case float64:
+			result = append(result, int64(val))
+		}
+	}
+	return result
+}
@@ -1,17 +1,25 @@
 package model
 
+import "math"
+
 // Order 订单模型
 type Order struct {
 	ID                      int64     `gorm:"primaryKey;column:id" json:"id"`
 	InviteUserID            *int64    `gorm:"column:invite_user_id" json:"invite_user_id"`
 	UserID                  int64     `gorm:"column:user_id;index" json:"user_id"`
 	PlanID                  int64     `gorm:"column:plan_id" json:"plan_id"`
+	TrafficPackID           *int64    `gorm:"column:traffic_pack_id" json:"traffic_pack_id"`
 	CouponID                *int64    `gorm:"column:coupon_id" json:"coupon_id"`
 	PaymentID               *int64    `gorm:"column:payment_id" json:"payment_id"`
 	Type                    int       `gorm:"column:type" json:"type"`
 	Period                  string    `gorm:"column:period" json:"period"`
 	TradeNo                 string    `gorm:"column:trade_no;uniqueIndex;size:36" json:"trade_no"`
 	CallbackNo              *string   `gorm:"column:callback_no" json:"callback_no"`
+	Currency                string    `gorm:"column:currency;size:3" json:"currency"`                    // 下单币种，为空表示基础币种
+	CurrencyRate            float64   `gorm:"column:currency_rate;default:1" json:"currency_rate"`       // 下单时汇率：1 基础币种可兑换的下单币种金额
+	PlanAmount              *int64    `gorm:"column:plan_amount" json:"plan_amount"`                     // 套餐原价
+	GroupDiscountAmount     *int64    `gorm:"column:group_discount_amount" json:"group_discount_amount"` // 用户组价格优惠，为负表示加价
+	UserDiscountAmount      *int64    `gorm:"column:user_discount_amount" json:"user_discount_amount"`   // 用户折扣
 	TotalAmount             int64     `gorm:"column:total_amount" json:"total_amount"`
 	HandlingAmount          *int64    `gorm:"column:handling_amount" json:"handling_amount"`
 	DiscountAmount          *int64    `gorm:"column:discount_amount" json:"discount_amount"`
@@ -32,6 +40,44 @@ func (Order) TableName() string {
 	return "v2_order"
 }
 
+// DueAmount 余额抵扣后仍需支付的订单金额
+func (o *Order) DueAmount() int64 {
+	if o.BalanceAmount != nil {
+		return o.TotalAmount - *o.BalanceAmount
+	}
+	return o.TotalAmount
+}
+
+// PayAmount 实际需支付金额（余额抵扣后的订单金额 + 手续费）
+func (o *Order) PayAmount() int64 {
+	if o.HandlingAmount != nil {
+		return o.DueAmount() + *o.HandlingAmount
+	}
+	return o.DueAmount()
+}
+
+// ToBase 将订单币种金额按下单时汇率折算为基础币种金额
+func (o *Order) ToBase(amount int64) int64 {
+	if o.CurrencyRate <= 0 || o.CurrencyRate == 1 {
+		return amount
+	}
+	return int64(math.Round(float64(amount) / o.CurrencyRate))
+}
+
+// GetSurplusOrderIDsAsInt64 获取 surplus_order_ids 为 int64 数组
+func (o *Order) GetSurplusOrderIDsAsInt64() []int64 {
+	result := make([]int64, 0)
+	for _, v := range o.SurplusOrderIDs {
+		switch val := v.(type) {
+		case float64:
+			result = append(result, int64(val))
+		case int64:
+			result = append(result, val)
+		}
+	}
+	return result
+}
+
 // 订单状态
 const (
 	OrderStatusPending    = 0 // 待支付
@@ -41,12 +87,109 @@ const (
 	OrderStatusDiscounted = 4 // 已折抵
 )
 
+// 佣金状态（Order.CommissionStatus 与 CommissionLog.Status）
+// 佣金先进入待确认状态，持有期满后发放到邀请人佣金余额；期间订单取消或全额退款则作废
+const (
+	CommissionStatusPending   = 0 // 待确认
+	CommissionStatusConfirmed = 1 // 已发放
+	CommissionStatusCancelled = 2 // 已作废
+)
+
 // 订单类型
 const (
 	OrderTypeNewPurchase  = 1 // 新购
 	OrderTypeRenewal      = 2 // 续费
 	OrderTypeUpgrade      = 3 // 升级
 	OrderTypeResetTraffic = 4 // 流量重置
+	OrderTypeTrafficPack  = 5 // 流量包
+)
+
+// OrderRefund 订单退款记录
+type OrderRefund struct {
+	ID               int64   `gorm:"primaryKey;column:id" json:"id"`
+	OrderID          int64   `gorm:"column:order_id;index" json:"order_id"`
+	TradeNo          string  `gorm:"column:trade_no;size:36" json:"trade_no"`
+	UserID           int64   `gorm:"column:user_id;index" json:"user_id"`
+	Amount           int64   `gorm:"column:amount" json:"amount"`
+	Method           string  `gorm:"column:method;size:16" json:"method"`            // balance / external
+	ExternalNo       *string `gorm:"column:external_no;size:128" json:"external_no"` // 网关退款单号
+	BalanceAmount    int64   `gorm:"column:balance_amount" json:"balance_amount"`    // 退回余额的部分
+	Reason           string  `gorm:"column:reason" json:"reason"`
+	RollbackSeconds  int64   `gorm:"column:rollback_seconds" json:"rollback_seconds"`   // 回收的套餐时长
+	RollbackTraffic  int64   `gorm:"column:rollback_traffic" json:"rollback_traffic"`   // 回收的流量（字节）
+	CommissionAmount int64   `gorm:"column:commission_amount" json:"commission_amount"` // 追回的佣金
+	OperatorID       *int64  `gorm:"column:operator_id" json:"operator_id"`
+	CreatedAt        int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt        int64   `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (OrderRefund) TableName() string {
+	return "v2_order_refund"
+}
+
+// 退款方式
+const (
+	RefundMethodBalance  = "balance"  // 退回账户余额
+	RefundMethodExternal = "external" // 原路退回（支付网关）
+)
+
+// PaymentCallback 支付回调日志，记录每一次网关原始通知及处理结果
+type PaymentCallback struct {
+	ID         int64   `gorm:"primaryKey;column:id" json:"id"`
+	PaymentID  int64   `gorm:"column:payment_id;index:idx_payment_callback_no" json:"payment_id"`
+	Gateway    string  `gorm:"column:gateway;size:16" json:"gateway"`
+	TradeNo    string  `gorm:"column:trade_no;size:36;index" json:"trade_no"`
+	CallbackNo string  `gorm:"column:callback_no;size:128;index:idx_payment_callback_no" json:"callback_no"` // 网关交易号
+	Headers    string  `gorm:"column:headers;type:text" json:"headers"`
+	Params     string  `gorm:"column:params;type:text" json:"params"`
+	Body       string  `gorm:"column:body;type:text" json:"body"`
+	Verified   bool    `gorm:"column:verified;default:false" json:"verified"`
+	Outcome    string  `gorm:"column:outcome;size:16" json:"outcome"`
+	Error      *string `gorm:"column:error;type:text" json:"error"`
+	ReplayOf   *int64  `gorm:"column:replay_of" json:"replay_of"` // 重放的原始回调 ID
+	ReceivedAt int64   `gorm:"column:received_at" json:"received_at"`
+	CreatedAt  int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt  int64   `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (PaymentCallback) TableName() string {
+	return "v2_payment_callback"
+}
+
+// 回调处理结果
+const (
+	CallbackOutcomeReceived  = "received"  // 已接收，处理中
+	CallbackOutcomeRejected  = "rejected"  // 签名校验失败
+	CallbackOutcomeIgnored   = "ignored"   // 非支付成功通知
+	CallbackOutcomeDuplicate = "duplicate" // 重复通知，订单已处理
+	CallbackOutcomeCompleted = "completed" // 订单已完成
+	CallbackOutcomeFailed    = "failed"    // 处理失败
+)
+
+// RenewalAttempt 自动续费尝试记录，ExpiredAt 为本次续费针对的到期时间
+type RenewalAttempt struct {
+	ID        int64   `gorm:"primaryKey;column:id" json:"id"`
+	UserID    int64   `gorm:"column:user_id;index:idx_renewal_user_expired" json:"user_id"`
+	ExpiredAt int64   `gorm:"column:expired_at;index:idx_renewal_user_expired" json:"expired_at"`
+	PlanID    int64   `gorm:"column:plan_id" json:"plan_id"`
+	Period    string  `gorm:"column:period;size:32" json:"period"`
+	OrderID   *int64  `gorm:"column:order_id" json:"order_id"`
+	Amount    int64   `gorm:"column:amount" json:"amount"`
+	Status    string  `gorm:"column:status;size:16" json:"status"`
+	Error     *string `gorm:"column:error;type:text" json:"error"`
+	CreatedAt int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt int64   `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (RenewalAttempt) TableName() string {
+	return "v2_renewal_attempt"
+}
+
+// 自动续费结果
+const (
+	RenewalStatusPaid         = "paid"         // 已使用余额支付
+	RenewalStatusInsufficient = "insufficient" // 余额不足，已通知用户
+	RenewalStatusFailed       = "failed"       // 续费失败
 )
 
 // Payment 支付方式
@@ -70,6 +213,26 @@ func (Payment) TableName() string {
 	return "v2_payment"
 }
 
+// HandlingFee 计算手续费：按比例收取后加上固定费用
+func (p *Payment) HandlingFee(amount int64) int64 {
+	return p.HandlingFeeAt(amount, 1)
+}
+
+// HandlingFeeAt 计算外币订单的手续费，固定费用以基础币种配置，按汇率折算
+func (p *Payment) HandlingFeeAt(amount int64, rate float64) int64 {
+	var fee int64
+	if p.HandlingFeePercent != nil && *p.HandlingFeePercent > 0 {
+		fee += int64(math.Round(float64(amount) * *p.HandlingFeePercent / 100))
+	}
+	if p.HandlingFeeFixed != nil && *p.HandlingFeeFixed > 0 {
+		if rate <= 0 {
+			rate = 1
+		}
+		fee += int64(math.Round(float64(*p.HandlingFeeFixed) * rate))
+	}
+	return fee
+}
+
 // Coupon 优惠券
 type Coupon struct {
 	ID               int64   `gorm:"primaryKey;column:id" json:"id"`
@@ -97,3 +260,49 @@ const (
 	CouponTypeAmount  = 1 // 固定金额
 	CouponTypePercent = 2 // 百分比折扣
 )
+
+// RedeemCode 兑换码（礼品卡），兑换后直接发放套餐、时长、流量或余额
+type RedeemCode struct {
+	ID               int64  `gorm:"primaryKey;column:id" json:"id"`
+	BatchNo          string `gorm:"column:batch_no;size:32;index" json:"batch_no"`
+	Code             string `gorm:"column:code;size:32;uniqueIndex" json:"code"`
+	Name             string `gorm:"column:name" json:"name"`
+	Type             int    `gorm:"column:type" json:"type"`
+	PlanID           *int64 `gorm:"column:plan_id" json:"plan_id"`
+	Value            int64  `gorm:"column:value" json:"value"`                             // 天数 / GB / 金额（分）
+	LimitUse         *int   `gorm:"column:limit_use" json:"limit_use"`                     // 总次数，为空或 0 不限
+	LimitUseWithUser *int   `gorm:"column:limit_use_with_user" json:"limit_use_with_user"` // 每用户次数，为空或 0 不限
+	UsedCount        int    `gorm:"column:used_count;default:0" json:"used_count"`
+	StartedAt        int64  `gorm:"column:started_at" json:"started_at"`
+	EndedAt          int64  `gorm:"column:ended_at" json:"ended_at"` // 为 0 不过期
+	CreatedAt        int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt        int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (RedeemCode) TableName() string {
+	return "v2_redeem_code"
+}
+
+// 兑换码类型
+const (
+	RedeemTypePlan    = 1 // 开通套餐 Value 天
+	RedeemTypeTime    = 2 // 当前套餐延长 Value 天
+	RedeemTypeTraffic = 3 // 发放 Value GB 流量包
+	RedeemTypeBalance = 4 // 充值 Value 分余额
+)
+
+// RedeemLog 兑换记录
+type RedeemLog struct {
+	ID        int64  `gorm:"primaryKey;column:id" json:"id"`
+	CodeID    int64  `gorm:"column:code_id;index:idx_redeem_log_code_user" json:"code_id"`
+	UserID    int64  `gorm:"column:user_id;index:idx_redeem_log_code_user" json:"user_id"`
+	Code      string `gorm:"column:code;size:32" json:"code"`
+	Type      int    `gorm:"column:type" json:"type"`
+	PlanID    *int64 `gorm:"column:plan_id" json:"plan_id"`
+	Value     int64  `gorm:"column:value" json:"value"`
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (RedeemLog) TableName() string {
+	return "v2_redeem_log"
+}
@@ -0,0 +1,30 @@
+package model
+
+import "testing"
+
+func TestHandlingFee(t *testing.T) {
+	fixed := int64(100)
+	percent := 2.5
+
+	tests := []struct {
+		payment Payment
+		amount  int64
+		want    int64
+	}{
+		{Payment{}, 1000, 0},
+		{Payment{HandlingFeeFixed: &fixed}, 1000, 100},
+		{Payment{HandlingFeePercent: &percent}, 1000, 25},
+		{Payment{HandlingFeeFixed: &fixed, HandlingFeePercent: &percent}, 1990, 150},
+	}
+	for _, tt := range tests {
+		if got := tt.payment.HandlingFee(tt.amount); got != tt.want {
+			t.Errorf("HandlingFee(%d) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+
+	handling := int64(25)
+	order := Order{TotalAmount: 1000, HandlingAmount: &handling}
+	if got := order.PayAmount(); got != 1025 {
+		t.Errorf("PayAmount() = %d, want 1025", got)
+	}
+}
@@ -100,6 +100,8 @@ type CommissionLog struct {
 	TradeNo      string `gorm:"column:trade_no;size:36" json:"trade_no"`
 	OrderAmount  int64  `gorm:"column:order_amount" json:"order_amount"`
 	GetAmount    int64  `gorm:"column:get_amount" json:"get_amount"`
+	Tier         int    `gorm:"column:tier;default:1" json:"tier"` // 邀请层级，1 为直接邀请人
+	Status       int    `gorm:"column:status;default:0;index" json:"status"`
 	CreatedAt    int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
 	UpdatedAt    int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
@@ -107,3 +109,68 @@ type CommissionLog struct {
 func (CommissionLog) TableName() string {
 	return "v2_commission_log"
 }
+
+// CommissionWithdraw 佣金提现申请，申请金额从佣金余额转入冻结，审核通过后线下打款
+type CommissionWithdraw struct {
+	ID           int64   `gorm:"primaryKey;column:id" json:"id"`
+	UserID       int64   `gorm:"column:user_id;index" json:"user_id"`
+	Method       string  `gorm:"column:method;size:16" json:"method"`
+	Account      string  `gorm:"column:account;size:255" json:"account"`
+	Amount       int64   `gorm:"column:amount" json:"amount"`               // 申请金额（冻结金额）
+	Fee          int64   `gorm:"column:fee;default:0" json:"fee"`           // 手续费
+	ActualAmount int64   `gorm:"column:actual_amount" json:"actual_amount"` // 实际打款金额
+	Status       int     `gorm:"column:status;default:0;index" json:"status"`
+	AdminNote    *string `gorm:"column:admin_note;type:text" json:"admin_note"`
+	OperatorID   *int64  `gorm:"column:operator_id" json:"operator_id"`
+	ProcessedAt  *int64  `gorm:"column:processed_at" json:"processed_at"`
+	CreatedAt    int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt    int64   `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (CommissionWithdraw) TableName() string {
+	return "v2_commission_withdraw"
+}
+
+// 提现方式
+const (
+	WithdrawMethodUSDT   = "usdt"
+	WithdrawMethodAlipay = "alipay"
+	WithdrawMethodBank   = "bank"
+)
+
+// 提现状态
+const (
+	WithdrawStatusPending   = 0 // 待审核（冻结中）
+	WithdrawStatusApproved  = 1 // 已通过（已打款）
+	WithdrawStatusRejected  = 2 // 已拒绝（已解冻）
+	WithdrawStatusCancelled = 3 // 用户取消（已解冻）
+)
+
+// CommissionWithdrawLog 提现申请审计记录，每次状态变更写入一条
+type CommissionWithdrawLog struct {
+	ID         int64   `gorm:"primaryKey;column:id" json:"id"`
+	WithdrawID int64   `gorm:"column:withdraw_id;index" json:"withdraw_id"`
+	UserID     int64   `gorm:"column:user_id" json:"user_id"`
+	OperatorID *int64  `gorm:"column:operator_id" json:"operator_id"` // 为空表示用户本人操作
+	Action     string  `gorm:"column:action;size:16" json:"action"`
+	Status     int     `gorm:"column:status" json:"status"` // 变更后的状态
+	Note       *string `gorm:"column:note;type:text" json:"note"`
+	CreatedAt  int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (CommissionWithdrawLog) TableName() string {
+	return "v2_commission_withdraw_log"
+}
+
+// SubscribeTemplate 订阅模板
+type SubscribeTemplate struct {
+	ID        int64  `gorm:"primaryKey;column:id" json:"id"`
+	Name      string `gorm:"column:name;uniqueIndex;size:32" json:"name"`
+	Content   string `gorm:"column:content;type:text" json:"content"`
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (SubscribeTemplate) TableName() string {
+	return "v2_subscribe_template"
+}
@@ -1,38 +1,77 @@
 package model
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+)
+
 // Plan 套餐模型
 type Plan struct {
-	ID                 int64  `gorm:"primaryKey;column:id" json:"id"`
-	GroupID            *int64 `gorm:"column:group_id" json:"group_id"`
-	TransferEnable     int64  `gorm:"column:transfer_enable" json:"transfer_enable"` // 流量配额（字节）
-	Name               string `gorm:"column:name" json:"name"`
-	SpeedLimit         *int   `gorm:"column:speed_limit" json:"speed_limit"`   // 速度限制（Mbps）
-	DeviceLimit        *int   `gorm:"column:device_limit" json:"device_limit"` // 设备数量限制
-	Show               bool   `gorm:"column:show;default:false" json:"show"`
-	Sell               bool   `gorm:"column:sell;default:true" json:"sell"`
-	Renew              bool   `gorm:"column:renew;default:true" json:"renew"`
-	Sort               int    `gorm:"column:sort" json:"sort"`
-	Content            string `gorm:"column:content;type:text" json:"content"`
-	MonthPrice         *int64 `gorm:"column:month_price" json:"month_price"`
-	QuarterPrice       *int64 `gorm:"column:quarter_price" json:"quarter_price"`
-	HalfYearPrice      *int64 `gorm:"column:half_year_price" json:"half_year_price"`
-	YearPrice          *int64 `gorm:"column:year_price" json:"year_price"`
-	TwoYearPrice       *int64 `gorm:"column:two_year_price" json:"two_year_price"`
-	ThreeYearPrice     *int64 `gorm:"column:three_year_price" json:"three_year_price"`
-	OnetimePrice       *int64 `gorm:"column:onetime_price" json:"onetime_price"`
-	ResetPrice         *int64 `gorm:"column:reset_price" json:"reset_price"`
-	ResetTrafficMethod *int   `gorm:"column:reset_traffic_method" json:"reset_traffic_method"`
-	CapacityLimit      *int   `gorm:"column:capacity_limit" json:"capacity_limit"`     // 最大可售数量（null=不限制）
-	SoldCount          int    `gorm:"column:sold_count;default:0" json:"sold_count"`   // 已售出数量
-	UpgradeGroupID     *int64 `gorm:"column:upgrade_group_id" json:"upgrade_group_id"` // 购买后升级到的用户组ID
-	CreatedAt          int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-	UpdatedAt          int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	ID                 int64      `gorm:"primaryKey;column:id" json:"id"`
+	GroupID            *int64     `gorm:"column:group_id" json:"group_id"`
+	TransferEnable     int64      `gorm:"column:transfer_enable" json:"transfer_enable"` // 流量配额（字节）
+	Name               string     `gorm:"column:name" json:"name"`
+	SpeedLimit         *int       `gorm:"column:speed_limit" json:"speed_limit"`   // 速度限制（Mbps）
+	DeviceLimit        *int       `gorm:"column:device_limit" json:"device_limit"` // 设备数量限制
+	Show               bool       `gorm:"column:show;default:false" json:"show"`
+	Sell               bool       `gorm:"column:sell;default:true" json:"sell"`
+	Renew              bool       `gorm:"column:renew;default:true" json:"renew"`
+	Sort               int        `gorm:"column:sort" json:"sort"`
+	Content            string     `gorm:"column:content;type:text" json:"content"`
+	MonthPrice         *int64     `gorm:"column:month_price" json:"month_price"`
+	QuarterPrice       *int64     `gorm:"column:quarter_price" json:"quarter_price"`
+	HalfYearPrice      *int64     `gorm:"column:half_year_price" json:"half_year_price"`
+	YearPrice          *int64     `gorm:"column:year_price" json:"year_price"`
+	TwoYearPrice       *int64     `gorm:"column:two_year_price" json:"two_year_price"`
+	ThreeYearPrice     *int64     `gorm:"column:three_year_price" json:"three_year_price"`
+	OnetimePrice       *int64     `gorm:"column:onetime_price" json:"onetime_price"`
+	ResetPrice         *int64     `gorm:"column:reset_price" json:"reset_price"`
+	CurrencyPrices     PriceTable `gorm:"column:currency_prices;type:text" json:"currency_prices"` // 外币定价，未设置的币种按汇率折算
+	ResetTrafficMethod *int       `gorm:"column:reset_traffic_method" json:"reset_traffic_method"`
+	CapacityLimit      *int       `gorm:"column:capacity_limit" json:"capacity_limit"`     // 最大可售数量（null=不限制）
+	SoldCount          int        `gorm:"column:sold_count;default:0" json:"sold_count"`   // 已售出数量
+	UpgradeGroupID     *int64     `gorm:"column:upgrade_group_id" json:"upgrade_group_id"` // 购买后升级到的用户组ID
+	CreatedAt          int64      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt          int64      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
 
 func (Plan) TableName() string {
 	return "v2_plan"
 }
 
+// PriceTable 两级价格表：键 -> 周期 -> 金额（分）
+// 套餐外币定价以币种为键，例如 {"USD": {"monthly": 499}}；用户组价格以套餐 ID 为键
+type PriceTable map[string]map[string]int64
+
+func (c *PriceTable) Scan(value interface{}) error {
+	if value == nil {
+		*c = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		str, ok := value.(string)
+		if !ok {
+			*c = nil
+			return nil
+		}
+		bytes = []byte(str)
+	}
+	if len(bytes) == 0 {
+		*c = nil
+		return nil
+	}
+	return json.Unmarshal(bytes, c)
+}
+
+func (c PriceTable) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
 // 流量重置方式
 const (
 	ResetTrafficFollowSystem  = -1 // 跟随系统设置
@@ -53,6 +92,7 @@ const (
 	PeriodThreeYearly  = "three_yearly"
 	PeriodOnetime      = "onetime"
 	PeriodResetTraffic = "reset_traffic"
+	PeriodTrafficPack  = "traffic_pack"
 )
 
 // GetPeriodDays 获取周期天数
@@ -116,6 +156,11 @@ func (p *Plan) GetPriceByPeriod(period string) int64 {
 	return 0
 }
 
+// GetCurrencyPrice 获取指定币种与周期的定价，未设置时返回 0
+func (p *Plan) GetCurrencyPrice(currency, period string) int64 {
+	return p.CurrencyPrices[currency][period]
+}
+
 // CanPurchase 检查套餐是否可以购买
 func (p *Plan) CanPurchase() bool {
 	// 如果没有设置限制，可以购买
@@ -140,3 +185,72 @@ func (p *Plan) GetRemainingCount() int {
 	}
 	return remaining
 }
+
+// TrafficPack 流量包商品，购买后在有效期内叠加到套餐流量之上
+type TrafficPack struct {
+	ID        int64  `gorm:"primaryKey;column:id" json:"id"`
+	Name      string `gorm:"column:name" json:"name"`
+	Traffic   int64  `gorm:"column:traffic" json:"traffic"` // 流量（GB）
+	Days      int    `gorm:"column:days" json:"days"`       // 有效天数
+	Price     int64  `gorm:"column:price" json:"price"`
+	Show      bool   `gorm:"column:show;default:false" json:"show"`
+	Sell      bool   `gorm:"column:sell;default:true" json:"sell"`
+	Sort      int    `gorm:"column:sort" json:"sort"`
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (TrafficPack) TableName() string {
+	return "v2_traffic_pack"
+}
+
+// UserTrafficPack 用户已购流量包
+// 套餐流量用完后消耗流量包，按到期先后扣减；Used 为已结算的用量
+type UserTrafficPack struct {
+	ID        int64  `gorm:"primaryKey;column:id" json:"id"`
+	UserID    int64  `gorm:"column:user_id;index" json:"user_id"`
+	PackID    *int64 `gorm:"column:pack_id" json:"pack_id"`
+	OrderID   *int64 `gorm:"column:order_id;index" json:"order_id"`
+	Traffic   int64  `gorm:"column:traffic" json:"traffic"` // 流量（字节）
+	Used      int64  `gorm:"column:used;default:0" json:"used"`
+	ExpiredAt int64  `gorm:"column:expired_at;index" json:"expired_at"`
+	Status    int    `gorm:"column:status;default:0" json:"status"`
+	CreatedAt int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (UserTrafficPack) TableName() string {
+	return "v2_user_traffic_pack"
+}
+
+// 流量包状态
+const (
+	TrafficPackActive  = 0 // 有效
+	TrafficPackExpired = 1 // 已过期（已结算）
+)
+
+// PlanWaitlist 售罄套餐的候补队列
+// 套餐释放名额时按加入顺序通知候补用户，并在 ReservedUntil 前为其保留名额
+type PlanWaitlist struct {
+	ID            int64  `gorm:"primaryKey;column:id" json:"id"`
+	PlanID        int64  `gorm:"column:plan_id;index:idx_plan_status" json:"plan_id"`
+	UserID        int64  `gorm:"column:user_id;index" json:"user_id"`
+	Status        int    `gorm:"column:status;default:0;index:idx_plan_status" json:"status"`
+	NotifiedAt    *int64 `gorm:"column:notified_at" json:"notified_at"`
+	ReservedUntil *int64 `gorm:"column:reserved_until;index" json:"reserved_until"`
+	CreatedAt     int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt     int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (PlanWaitlist) TableName() string {
+	return "v2_plan_waitlist"
+}
+
+// 候补状态
+const (
+	WaitlistWaiting   = 0 // 排队中
+	WaitlistReserved  = 1 // 已通知，保留名额中
+	WaitlistPurchased = 2 // 已购买
+	WaitlistExpired   = 3 // 保留超时
+	WaitlistCancelled = 4 // 用户取消
+)
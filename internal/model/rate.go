@@ -0,0 +1,98 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RateTimeRange 时段倍率，End 小于 Start 表示跨天（例如 23:00-07:00）
+type RateTimeRange struct {
+	Start string  `json:"start"` // HH:MM
+	End   string  `json:"end"`   // HH:MM，可为 24:00
+	Rate  float64 `json:"rate"`
+}
+
+// ParseRateTimeRanges 解析时段倍率配置
+func ParseRateTimeRanges(ranges JSONArray) ([]RateTimeRange, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(ranges)
+	if err != nil {
+		return nil, err
+	}
+	var result []RateTimeRange
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errors.New("invalid rate time ranges")
+	}
+	for _, r := range result {
+		start, err := parseClock(r.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(r.End)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("empty rate time range: %s-%s", r.Start, r.End)
+		}
+		if r.Rate <= 0 {
+			return nil, errors.New("rate must be positive")
+		}
+	}
+	return result, nil
+}
+
+// parseClock 解析 HH:MM 为当天分钟数
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time: %s", s)
+	}
+	return h*60 + m, nil
+}
+
+// NormalizeRate 倍率不大于 0 时按 1 计算，不支持免流量倍率
+func NormalizeRate(rate float64) float64 {
+	if rate <= 0 {
+		return 1
+	}
+	return rate
+}
+
+// rateAt 计算生效倍率，命中的第一个时段优先，未命中使用基础倍率
+func rateAt(base float64, enable bool, ranges JSONArray, t time.Time) float64 {
+	base = NormalizeRate(base)
+	if !enable {
+		return base
+	}
+	parsed, err := ParseRateTimeRanges(ranges)
+	if err != nil {
+		return base
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	for _, r := range parsed {
+		start, _ := parseClock(r.Start)
+		end, _ := parseClock(r.End)
+		if start < end {
+			if minute >= start && minute < end {
+				return NormalizeRate(r.Rate)
+			}
+		} else if minute >= start || minute < end {
+			return NormalizeRate(r.Rate)
+		}
+	}
+	return base
+}
+
+// rateName 启用时段倍率的节点在名称后显示当前倍率
+func rateName(name string, enable bool, rate float64) string {
+	if !enable {
+		return name
+	}
+	return fmt.Sprintf("%s [%gx]", name, rate)
+}
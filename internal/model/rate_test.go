@@ -0,0 +1,79 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateAt(t *testing.T) {
+	server := &Server{
+		Rate:           1.5,
+		RateTimeEnable: true,
+		RateTimeRanges: JSONArray{
+			map[string]interface{}{"start": "01:00", "end": "07:00", "rate": 0.5},
+			map[string]interface{}{"start": "23:00", "end": "01:00", "rate": 0.8},
+		},
+	}
+
+	tests := []struct {
+		clock string
+		want  float64
+	}{
+		{"00:30", 0.8},
+		{"01:00", 0.5},
+		{"06:59", 0.5},
+		{"07:00", 1.5},
+		{"12:00", 1.5},
+		{"23:30", 0.8},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse("15:04", tt.clock)
+		if got := server.RateAt(at); got != tt.want {
+			t.Errorf("RateAt(%s) = %v, want %v", tt.clock, got, tt.want)
+		}
+	}
+
+	server.RateTimeEnable = false
+	at, _ := time.Parse("15:04", "03:00")
+	if got := server.RateAt(at); got != 1.5 {
+		t.Errorf("RateAt with ranges disabled = %v, want 1.5", got)
+	}
+}
+
+func TestParseRateTimeRanges(t *testing.T) {
+	invalid := []JSONArray{
+		{map[string]interface{}{"start": "25:00", "end": "07:00", "rate": 0.5}},
+		{map[string]interface{}{"start": "01:00", "end": "01:00", "rate": 0.5}},
+		{map[string]interface{}{"start": "01:00", "end": "07:00", "rate": -1}},
+		{map[string]interface{}{"start": "01:00", "end": "07:00", "rate": 0}},
+		{"01:00-07:00"},
+	}
+	for _, ranges := range invalid {
+		if _, err := ParseRateTimeRanges(ranges); err == nil {
+			t.Errorf("ParseRateTimeRanges(%v) expected error", ranges)
+		}
+	}
+}
+
+func TestRateName(t *testing.T) {
+	at, _ := time.Parse("15:04", "03:00")
+	ranges := JSONArray{map[string]interface{}{"start": "01:00", "end": "07:00", "rate": 0.5}}
+
+	server := &Server{Name: "HK 01", Rate: 0, RateTimeEnable: true, RateTimeRanges: ranges}
+	if got := server.NameAt(at); got != "HK 01 [0.5x]" {
+		t.Errorf("Server.NameAt = %q", got)
+	}
+	node := &ServerNode{Name: "HK Node", Rate: 0, RateTimeEnable: true, RateTimeRanges: ranges}
+	if got := node.NameAt(at); got != "HK Node [0.5x]" {
+		t.Errorf("ServerNode.NameAt = %q", got)
+	}
+
+	// 基础倍率为 0 时按 1 计费，与流量上报一致
+	node.RateTimeEnable = false
+	if got := node.RateAt(at); got != NormalizeRate(0) || got != 1 {
+		t.Errorf("RateAt with zero rate = %v, want 1", got)
+	}
+	if got := node.NameAt(at); got != "HK Node" {
+		t.Errorf("ServerNode.NameAt with ranges disabled = %q", got)
+	}
+}
@@ -3,6 +3,8 @@ package model
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"strings"
+	"time"
 )
 
 // Server 节点模型
@@ -21,6 +23,7 @@ type Server struct {
 	Port             string    `gorm:"column:port" json:"port"`
 	ServerPort       int       `gorm:"column:server_port" json:"server_port"`
 	ProtocolSettings JSONMap   `gorm:"column:protocol_settings;type:json" json:"protocol_settings"`
+	WireGuardKey     string    `gorm:"column:wireguard_private_key;size:64" json:"-"` // WireGuard 服务端私钥，不随节点信息下发
 	Show             bool      `gorm:"column:show;default:false" json:"show"`
 	Sort             *int      `gorm:"column:sort" json:"sort"`
 	RateTimeEnable   bool      `gorm:"column:rate_time_enable;default:false" json:"rate_time_enable"`
@@ -46,6 +49,7 @@ const (
 	ServerTypeNaive       = "naive"
 	ServerTypeHTTP        = "http"
 	ServerTypeMieru       = "mieru"
+	ServerTypeWireGuard   = "wireguard"
 )
 
 // JSONArray 用于存储 JSON 数组
@@ -116,6 +120,28 @@ func (s *Server) GetGroupIDsAsInt64() []int64 {
 	return result
 }
 
+// GetRouteIDsAsInt64 获取 route_ids 为 int64 数组
+func (s *Server) GetRouteIDsAsInt64() []int64 {
+	result := make([]int64, 0)
+	for _, v := range s.RouteIDs {
+		switch val := v.(type) {
+		case float64:
+			result = append(result, int64(val))
+		}
+	}
+	return result
+}
+
+// RateAt 获取指定时间的生效倍率
+func (s *Server) RateAt(t time.Time) float64 {
+	return rateAt(s.Rate, s.RateTimeEnable, s.RateTimeRanges, t)
+}
+
+// NameAt 获取指定时间的显示名称，启用时段倍率时附带当前倍率
+func (s *Server) NameAt(t time.Time) string {
+	return rateName(s.Name, s.RateTimeEnable, s.RateAt(t))
+}
+
 // ServerGroup 节点组
 type ServerGroup struct {
 	ID        int64  `gorm:"primaryKey;column:id" json:"id"`
@@ -143,9 +169,46 @@ func (ServerRoute) TableName() string {
 	return "v2_server_route"
 }
 
+// 路由动作
+const (
+	RouteActionBlock  = "block"  // 阻断
+	RouteActionDirect = "direct" // 直连
+	RouteActionDNS    = "dns"    // 使用 ActionValue 指定的 DNS 解析
+	RouteActionSocks  = "socks"  // 走主机 SOCKS 出口，ActionValue 可指定其他 SOCKS 地址
+)
+
+// GetMatches 解析匹配规则，支持 JSON 数组或按行/逗号分隔
+// 每条规则格式为 type:value，例如 domain_suffix:example.com、geosite:category-ads-all
+func (r *ServerRoute) GetMatches() []string {
+	match := strings.TrimSpace(r.Match)
+	if match == "" {
+		return nil
+	}
+
+	var items []string
+	if strings.HasPrefix(match, "[") {
+		if err := json.Unmarshal([]byte(match), &items); err != nil {
+			return nil
+		}
+	} else {
+		items = strings.FieldsFunc(match, func(c rune) bool {
+			return c == '\n' || c == '\r' || c == ','
+		})
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 // ServerInfo 服务器信息（包含用户密码等）
 type ServerInfo struct {
 	Server
-	Password string `json:"password"`
-	Ports    string `json:"ports,omitempty"`
+	Password  string         `json:"password"`
+	Ports     string         `json:"ports,omitempty"`
+	WireGuard *WireGuardPeer `json:"-"` // WireGuard 节点的用户 peer
 }
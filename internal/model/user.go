@@ -16,10 +16,12 @@ type User struct {
 	CommissionType    int     `gorm:"column:commission_type;default:0" json:"commission_type"`
 	CommissionRate    *int    `gorm:"column:commission_rate" json:"commission_rate"`
 	CommissionBalance int64   `gorm:"column:commission_balance;default:0" json:"commission_balance"`
+	CommissionFrozen  int64   `gorm:"column:commission_frozen;default:0" json:"commission_frozen"` // 提现审核中冻结的佣金
 	T                 int64   `gorm:"column:t;default:0" json:"t"`
 	U                 int64   `gorm:"column:u;default:0" json:"u"`
 	D                 int64   `gorm:"column:d;default:0" json:"d"`
 	TransferEnable    int64   `gorm:"column:transfer_enable;default:0" json:"transfer_enable"`
+	PackTraffic       int64   `gorm:"column:pack_traffic;default:0" json:"pack_traffic"` // 流量包本周期可用流量
 	Banned            bool    `gorm:"column:banned;default:false" json:"banned"`
 	IsAdmin           bool    `gorm:"column:is_admin;default:false" json:"is_admin"`
 	IsStaff           bool    `gorm:"column:is_staff;default:false" json:"is_staff"`
@@ -32,11 +34,13 @@ type User struct {
 	DeviceLimit       *int    `gorm:"column:device_limit" json:"device_limit"`
 	RemindExpire      *int    `gorm:"column:remind_expire;default:1" json:"remind_expire"`
 	RemindTraffic     *int    `gorm:"column:remind_traffic;default:1" json:"remind_traffic"`
+	AutoRenew         bool    `gorm:"column:auto_renew;default:false" json:"auto_renew"`
 	Token             string  `gorm:"column:token;size:32" json:"token"`
 	ExpiredAt         *int64  `gorm:"column:expired_at;default:0" json:"expired_at"`
 	Remarks           *string `gorm:"column:remarks;type:text" json:"remarks"`
 	LastCheckinAt     *int64  `gorm:"column:last_checkin_at" json:"last_checkin_at"`
 	RegisterIP        *string `gorm:"column:register_ip;size:45" json:"register_ip"`
+	TrialAt           *int64  `gorm:"column:trial_at;index" json:"trial_at"` // 注册试用发放时间，为空表示未领取试用
 	CreatedAt         int64   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
 	UpdatedAt         int64   `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 
@@ -44,6 +48,13 @@ type User struct {
 	Plan *Plan `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
 }
 
+// 佣金类型（User.CommissionType）
+const (
+	CommissionTypeSystem  = 0 // 跟随系统设置
+	CommissionTypeCycle   = 1 // 每笔订单返佣
+	CommissionTypeOnetime = 2 // 仅被邀请人首单返佣
+)
+
 func (User) TableName() string {
 	return "v2_user"
 }
@@ -62,9 +73,17 @@ func (u *User) IsActive() bool {
 	return true
 }
 
+// TotalTraffic 总流量（套餐流量 + 流量包），套餐不限流量时为 0
+func (u *User) TotalTraffic() int64 {
+	if u.TransferEnable == 0 {
+		return 0
+	}
+	return u.TransferEnable + u.PackTraffic
+}
+
 // HasTraffic 检查用户是否有剩余流量
 func (u *User) HasTraffic() bool {
-	return u.U+u.D < u.TransferEnable
+	return u.U+u.D < u.TotalTraffic()
 }
 
 // GetUsedTraffic 获取已使用流量
@@ -74,7 +93,7 @@ func (u *User) GetUsedTraffic() int64 {
 
 // GetRemainingTraffic 获取剩余流量
 func (u *User) GetRemainingTraffic() int64 {
-	remaining := u.TransferEnable - u.U - u.D
+	remaining := u.TotalTraffic() - u.U - u.D
 	if remaining < 0 {
 		return 0
 	}
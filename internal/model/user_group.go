@@ -1,17 +1,20 @@
 package model
 
+import "strconv"
+
 // UserGroup 用户组模型（核心表）
 // 用户组决定用户可以访问哪些节点和购买哪些套餐
 // 注意：流量、速度、设备限制等由套餐（Plan）决定，不在用户组中设置
 type UserGroup struct {
-	ID          int64     `gorm:"primaryKey;column:id" json:"id"`
-	Name        string    `gorm:"column:name" json:"name"`
-	Description string    `gorm:"column:description;type:text" json:"description"`
-	ServerIDs   JSONArray `gorm:"column:server_ids;type:json" json:"server_ids"` // 该组可访问的节点ID列表
-	PlanIDs     JSONArray `gorm:"column:plan_ids;type:json" json:"plan_ids"`     // 该组可购买的套餐ID列表
-	Sort        int       `gorm:"column:sort;default:0" json:"sort"`
-	CreatedAt   int64     `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-	UpdatedAt   int64     `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	ID          int64      `gorm:"primaryKey;column:id" json:"id"`
+	Name        string     `gorm:"column:name" json:"name"`
+	Description string     `gorm:"column:description;type:text" json:"description"`
+	ServerIDs   JSONArray  `gorm:"column:server_ids;type:json" json:"server_ids"`   // 该组可访问的节点ID列表
+	PlanIDs     JSONArray  `gorm:"column:plan_ids;type:json" json:"plan_ids"`       // 该组可购买的套餐ID列表
+	PlanPrices  PriceTable `gorm:"column:plan_prices;type:text" json:"plan_prices"` // 该组的套餐价格覆盖（基础币种），键为套餐ID
+	Sort        int        `gorm:"column:sort;default:0" json:"sort"`
+	CreatedAt   int64      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   int64      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 
 	// 保留这些字段用于向后兼容，但标记为废弃
 	// Deprecated: 流量应该由套餐决定，不应该在用户组中设置
@@ -58,6 +61,11 @@ func (g *UserGroup) GetPlanIDsAsInt64() []int64 {
 	return result
 }
 
+// GetPlanPrice 获取该组指定套餐与周期的覆盖价格，未设置时返回 0
+func (g *UserGroup) GetPlanPrice(planID int64, period string) int64 {
+	return g.PlanPrices[strconv.FormatInt(planID, 10)][period]
+}
+
 // HasServer 检查该组是否可以访问指定节点
 func (g *UserGroup) HasServer(serverID int64) bool {
 	serverIDs := g.GetServerIDsAsInt64()
@@ -0,0 +1,16 @@
+package model
+
+// WireGuardPeer 用户 WireGuard peer（密钥对与隧道地址）
+type WireGuardPeer struct {
+	ID         int64  `gorm:"primaryKey;column:id" json:"id"`
+	UserID     int64  `gorm:"column:user_id;uniqueIndex" json:"user_id"`
+	PrivateKey string `gorm:"column:private_key;size:64" json:"-"`
+	PublicKey  string `gorm:"column:public_key;size:64" json:"public_key"`
+	IP         string `gorm:"column:ip;uniqueIndex;size:64" json:"ip"`
+	CreatedAt  int64  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt  int64  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (WireGuardPeer) TableName() string {
+	return "v2_wireguard_peer"
+}
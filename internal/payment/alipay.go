@@ -0,0 +1,383 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&AlipayGateway{})
+}
+
+const alipayDefaultGateway = "https://openapi.alipay.com/gateway.do"
+
+// alipayTimeZone 支付宝接口时间戳使用北京时间
+var alipayTimeZone = time.FixedZone("CST", 8*3600)
+
+// AlipayGateway 支付宝开放平台（当面付 / 电脑网站支付）
+type AlipayGateway struct{}
+
+func (g *AlipayGateway) Name() string {
+	return "alipay"
+}
+
+func (g *AlipayGateway) Fields() []Field {
+	return []Field{
+		{Key: "app_id", Label: "应用 ID", Type: FieldInput, Required: true},
+		{Key: "private_key", Label: "应用私钥", Type: FieldTextarea, Required: true, Description: "PKCS1 / PKCS8，可省略 PEM 头尾"},
+		{Key: "alipay_public_key", Label: "支付宝公钥", Type: FieldTextarea, Required: true},
+		{Key: "product", Label: "支付产品", Type: FieldSelect, Options: []string{"precreate", "page"}, Default: "precreate", Description: "precreate 当面付扫码，page 电脑网站支付"},
+		{Key: "return_url", Label: "返回地址", Type: FieldInput, Description: "电脑网站支付完成后跳转"},
+		{Key: "gateway", Label: "网关地址", Type: FieldInput, Default: alipayDefaultGateway},
+	}
+}
+
+// alipayClient 支付宝接口客户端
+type alipayClient struct {
+	appID      string
+	gateway    string
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+}
+
+func newAlipayClient(config Config) (*alipayClient, error) {
+	if config["app_id"] == "" {
+		return nil, errors.New("alipay app_id not configured")
+	}
+	privateKey, err := parseAlipayPrivateKey(config["private_key"])
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := parseAlipayPublicKey(config["alipay_public_key"])
+	if err != nil {
+		return nil, err
+	}
+	return &alipayClient{
+		appID:      config["app_id"],
+		gateway:    config.get("gateway", alipayDefaultGateway),
+		privateKey: privateKey,
+		publicKey:  publicKey,
+	}, nil
+}
+
+// parseAlipayPrivateKey 解析应用私钥，兼容 PKCS1 与 PKCS8
+func parseAlipayPrivateKey(key string) (*rsa.PrivateKey, error) {
+	der, err := decodeAlipayKey(key)
+	if err != nil {
+		return nil, errors.New("invalid alipay private_key")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("invalid alipay private_key")
+	}
+	rsaKey, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("alipay private_key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// parseAlipayPublicKey 解析支付宝公钥
+func parseAlipayPublicKey(key string) (*rsa.PublicKey, error) {
+	der, err := decodeAlipayKey(key)
+	if err != nil {
+		return nil, errors.New("invalid alipay_public_key")
+	}
+	k, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.New("invalid alipay_public_key")
+	}
+	rsaKey, ok := k.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("alipay_public_key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// decodeAlipayKey 支付宝后台导出的密钥通常不带 PEM 头尾
+func decodeAlipayKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, errors.New("empty key")
+	}
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		return block.Bytes, nil
+	}
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(key), ""))
+}
+
+// alipaySignContent 待签名字符串：除 sign 外的非空参数按键名排序后以 & 连接
+func alipaySignContent(params map[string]string, excludes ...string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if k == "sign" || v == "" {
+			continue
+		}
+		skip := false
+		for _, e := range excludes {
+			if k == e {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString("&")
+		}
+		buf.WriteString(k)
+		buf.WriteString("=")
+		buf.WriteString(params[k])
+	}
+	return buf.String()
+}
+
+// sign RSA2（SHA256WithRSA）签名
+func (c *alipayClient) sign(content string) (string, error) {
+	hash := sha256.Sum256([]byte(content))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.privateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// verify 使用支付宝公钥校验签名
+func (c *alipayClient) verify(content, sign string) bool {
+	sig, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256([]byte(content))
+	return rsa.VerifyPKCS1v15(c.publicKey, crypto.SHA256, hash[:], sig) == nil
+}
+
+// buildParams 构建带签名的公共请求参数
+func (c *alipayClient) buildParams(method string, bizContent map[string]interface{}, extra map[string]string) (map[string]string, error) {
+	biz, err := json.Marshal(bizContent)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]string{
+		"app_id":      c.appID,
+		"method":      method,
+		"format":      "JSON",
+		"charset":     "utf-8",
+		"sign_type":   "RSA2",
+		"timestamp":   time.Now().In(alipayTimeZone).Format("2006-01-02 15:04:05"),
+		"version":     "1.0",
+		"biz_content": string(biz),
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	sign, err := c.sign(alipaySignContent(params))
+	if err != nil {
+		return nil, err
+	}
+	params["sign"] = sign
+	return params, nil
+}
+
+// execute 调用支付宝接口并校验响应签名，返回 <method>_response 节点
+func (c *alipayClient) execute(method string, bizContent map[string]interface{}, extra map[string]string, out interface{}) error {
+	params, err := c.buildParams(method, bizContent, extra)
+	if err != nil {
+		return err
+	}
+	form := url.Values{}
+	for k, v := range params {
+		form.Set(k, v)
+	}
+
+	resp, err := httpClient.PostForm(c.gateway, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return errors.New("invalid alipay response")
+	}
+	node := raw[strings.ReplaceAll(method, ".", "_")+"_response"]
+	if node == nil {
+		node = raw["error_response"]
+	}
+	if node == nil {
+		return errors.New("invalid alipay response")
+	}
+
+	var result alipayError
+	json.Unmarshal(node, &result)
+	if result.Code != "10000" {
+		return &result
+	}
+
+	// 响应签名覆盖响应节点的原始 JSON
+	var sign string
+	json.Unmarshal(raw["sign"], &sign)
+	if !c.verify(string(node), sign) {
+		return errors.New("invalid alipay response signature")
+	}
+	return json.Unmarshal(node, out)
+}
+
+// alipayError 支付宝业务错误
+type alipayError struct {
+	Code    string `json:"code"`
+	Msg     string `json:"msg"`
+	SubCode string `json:"sub_code"`
+	SubMsg  string `json:"sub_msg"`
+}
+
+func (e *alipayError) Error() string {
+	if e.SubMsg != "" {
+		return fmt.Sprintf("alipay: %s", e.SubMsg)
+	}
+	return fmt.Sprintf("alipay: %s", e.Msg)
+}
+
+func (g *AlipayGateway) Create(config Config, req *Request) (*Result, error) {
+	// 支付宝仅支持人民币结算
+	if err := checkCurrency(req.Currency, "CNY"); err != nil {
+		return nil, err
+	}
+	client, err := newAlipayClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	bizContent := map[string]interface{}{
+		"out_trade_no": req.TradeNo,
+		"total_amount": formatYuan(req.Amount),
+		"subject":      req.Subject,
+	}
+	extra := map[string]string{"notify_url": req.NotifyURL}
+
+	if config["product"] == "page" {
+		bizContent["product_code"] = "FAST_INSTANT_TRADE_PAY"
+		extra["return_url"] = config["return_url"]
+		params, err := client.buildParams("alipay.trade.page.pay", bizContent, extra)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{
+			Type: "redirect",
+			Data: client.gateway + "?" + buildQuery(params),
+		}, nil
+	}
+
+	var result struct {
+		QRCode string `json:"qr_code"`
+	}
+	if err := client.execute("alipay.trade.precreate", bizContent, extra, &result); err != nil {
+		return nil, err
+	}
+	if result.QRCode == "" {
+		return nil, errors.New("alipay qr_code is empty")
+	}
+
+	return &Result{
+		Type: "qrcode",
+		Data: result.QRCode,
+	}, nil
+}
+
+func (g *AlipayGateway) Notify(config Config, n *Notification) (*Trade, error) {
+	client, err := newAlipayClient(config)
+	if err != nil {
+		return nil, err
+	}
+	params := n.Params
+	if !client.verify(alipaySignContent(params, "sign_type"), params["sign"]) {
+		return nil, errors.New("invalid signature")
+	}
+	if params["app_id"] != client.appID {
+		return nil, errors.New("alipay app_id mismatch")
+	}
+	return &Trade{
+		TradeNo:    params["out_trade_no"],
+		CallbackNo: params["trade_no"],
+		Amount:     parseYuan(params["total_amount"]),
+		Currency:   "CNY",
+		Paid:       alipayTradePaid(params["trade_status"]),
+	}, nil
+}
+
+func (g *AlipayGateway) Query(config Config, req *Request) (*Trade, error) {
+	client, err := newAlipayClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		TradeNo     string `json:"trade_no"`
+		TradeStatus string `json:"trade_status"`
+		TotalAmount string `json:"total_amount"`
+	}
+	if err := client.execute("alipay.trade.query", map[string]interface{}{"out_trade_no": req.TradeNo}, nil, &result); err != nil {
+		// 用户未扫码时交易尚未创建
+		if e, ok := err.(*alipayError); ok && e.SubCode == "ACQ.TRADE_NOT_EXIST" {
+			return &Trade{TradeNo: req.TradeNo}, nil
+		}
+		return nil, err
+	}
+
+	return &Trade{
+		TradeNo:    req.TradeNo,
+		CallbackNo: result.TradeNo,
+		Amount:     parseYuan(result.TotalAmount),
+		Currency:   "CNY",
+		Paid:       alipayTradePaid(result.TradeStatus),
+	}, nil
+}
+
+func (g *AlipayGateway) Refund(config Config, req *RefundRequest) (string, error) {
+	client, err := newAlipayClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	bizContent := map[string]interface{}{
+		"out_trade_no":   req.TradeNo,
+		"refund_amount":  formatYuan(req.Amount),
+		"out_request_no": req.RefundNo,
+	}
+	var result struct {
+		TradeNo string `json:"trade_no"`
+	}
+	if err := client.execute("alipay.trade.refund", bizContent, nil, &result); err != nil {
+		return "", err
+	}
+	// 支付宝以 out_request_no 标识退款请求
+	return req.RefundNo, nil
+}
+
+// alipayTradePaid 交易是否已支付
+func alipayTradePaid(status string) bool {
+	return status == "TRADE_SUCCESS" || status == "TRADE_FINISHED"
+}
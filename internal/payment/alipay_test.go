@@ -0,0 +1,96 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func alipayTestKeys(t *testing.T) (*rsa.PrivateKey, string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	priv, _ := x509.MarshalPKCS8PrivateKey(key)
+	return key, base64.StdEncoding.EncodeToString(priv), base64.StdEncoding.EncodeToString(pub)
+}
+
+func alipayTestSign(key *rsa.PrivateKey, content string) string {
+	hash := sha256.Sum256([]byte(content))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestAlipayPrecreateAndNotify(t *testing.T) {
+	_, merchantPriv, merchantPub := alipayTestKeys(t)
+	alipayKey, _, alipayPub := alipayTestKeys(t)
+
+	merchant, _ := parseAlipayPublicKey(merchantPub)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		params := make(map[string]string)
+		for k, v := range r.PostForm {
+			params[k] = v[0]
+		}
+		client := &alipayClient{publicKey: merchant}
+		if !client.verify(alipaySignContent(params), params["sign"]) {
+			w.Write([]byte(`{"error_response":{"code":"40002","msg":"Invalid Arguments","sub_msg":"invalid sign"}}`))
+			return
+		}
+		node := `{"code":"10000","msg":"Success","out_trade_no":"T1","qr_code":"https://qr.alipay.com/abc"}`
+		fmt.Fprintf(w, `{"alipay_trade_precreate_response":%s,"sign":"%s"}`, node, alipayTestSign(alipayKey, node))
+	}))
+	defer srv.Close()
+
+	g := &AlipayGateway{}
+	config := Config{
+		"app_id":            "2021000000000000",
+		"private_key":       merchantPriv,
+		"alipay_public_key": alipayPub,
+		"gateway":           srv.URL,
+	}
+	req := &Request{TradeNo: "T1", Amount: 1990, Subject: "订阅服务"}
+
+	result, err := g.Create(config, req)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if result.Type != "qrcode" || result.Data != "https://qr.alipay.com/abc" {
+		t.Errorf("result = %+v", result)
+	}
+
+	notify := map[string]string{
+		"app_id":       "2021000000000000",
+		"out_trade_no": "T1",
+		"trade_no":     "2024010122001",
+		"trade_status": "TRADE_SUCCESS",
+		"total_amount": "19.90",
+		"sign_type":    "RSA2",
+	}
+	notify["sign"] = alipayTestSign(alipayKey, alipaySignContent(notify, "sign_type"))
+	trade, err := g.Notify(config, &Notification{Params: notify})
+	if err != nil {
+		t.Fatalf("valid notify rejected: %v", err)
+	}
+	if !trade.Paid || trade.TradeNo != "T1" || trade.CallbackNo != "2024010122001" || trade.Amount != 1990 {
+		t.Errorf("trade = %+v", trade)
+	}
+	notify["total_amount"] = "0.01"
+	if _, err := g.Notify(config, &Notification{Params: notify}); err == nil {
+		t.Error("tampered notify accepted")
+	}
+
+	// 使用错误的支付宝公钥时拒绝响应
+	config["alipay_public_key"] = merchantPub
+	if _, err := g.Create(config, req); err == nil {
+		t.Error("expected response signature error")
+	}
+}
@@ -0,0 +1,183 @@
+package payment
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(&EpayGateway{})
+}
+
+// EpayGateway 易支付
+type EpayGateway struct{}
+
+func (g *EpayGateway) Name() string {
+	return "epay"
+}
+
+func (g *EpayGateway) Fields() []Field {
+	return []Field{
+		{Key: "url", Label: "接口地址", Type: FieldInput, Required: true},
+		{Key: "pid", Label: "商户 ID", Type: FieldInput, Required: true},
+		{Key: "key", Label: "商户密钥", Type: FieldInput, Required: true},
+		{Key: "type", Label: "支付类型", Type: FieldInput, Default: "alipay", Description: "alipay / wxpay / qqpay 等"},
+		{Key: "notify_url", Label: "回调地址", Type: FieldInput, Description: "未配置通知域名时使用"},
+		{Key: "return_url", Label: "返回地址", Type: FieldInput},
+		{Key: "currency", Label: "结算币种", Type: FieldInput, Description: "商户结算币种，例如 CNY，为空时不校验订单币种"},
+	}
+}
+
+func (g *EpayGateway) Create(config Config, req *Request) (*Result, error) {
+	if config["currency"] != "" {
+		if err := checkCurrency(req.Currency, config["currency"]); err != nil {
+			return nil, err
+		}
+	}
+
+	params := map[string]string{
+		"pid":          config["pid"],
+		"type":         config.get("type", "alipay"),
+		"out_trade_no": req.TradeNo,
+		"notify_url":   req.NotifyURL,
+		"return_url":   config["return_url"],
+		"name":         req.Subject,
+		"money":        formatAmount(req.Amount, req.Currency),
+	}
+	amount := chargedAmount(req.Amount, req.Currency)
+
+	// 生成签名
+	params["sign"] = epaySign(params, config["key"])
+	params["sign_type"] = "MD5"
+
+	return &Result{
+		Type:   "redirect",
+		Data:   config["url"] + "/submit.php?" + buildQuery(params),
+		Amount: amount,
+	}, nil
+}
+
+func (g *EpayGateway) Notify(config Config, n *Notification) (*Trade, error) {
+	params := n.Params
+	if config["key"] == "" || params["sign"] == "" || epaySign(params, config["key"]) != params["sign"] {
+		return nil, errors.New("invalid signature")
+	}
+	if params["out_trade_no"] == "" {
+		return nil, errors.New("trade_no not found")
+	}
+	return &Trade{
+		TradeNo:    params["out_trade_no"],
+		CallbackNo: params["trade_no"],
+		Amount:     parseYuan(params["money"]),
+		Currency:   strings.ToUpper(config["currency"]),
+		Paid:       params["trade_status"] == "TRADE_SUCCESS",
+	}, nil
+}
+
+func (g *EpayGateway) Query(config Config, req *Request) (*Trade, error) {
+	params := map[string]string{
+		"act":          "order",
+		"pid":          config["pid"],
+		"key":          config["key"],
+		"out_trade_no": req.TradeNo,
+	}
+
+	resp, err := httpClient.Get(config["url"] + "/api.php?" + buildQuery(params))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var result struct {
+		Status  json.Number `json:"status"`
+		TradeNo string      `json:"trade_no"`
+		Money   string      `json:"money"`
+	}
+	json.Unmarshal(body, &result)
+
+	return &Trade{
+		TradeNo:    req.TradeNo,
+		CallbackNo: result.TradeNo,
+		Amount:     parseYuan(result.Money),
+		Currency:   strings.ToUpper(config["currency"]),
+		Paid:       result.Status.String() == "1",
+	}, nil
+}
+
+func (g *EpayGateway) Refund(config Config, req *RefundRequest) (string, error) {
+	return "", ErrRefundNotSupported
+}
+
+// epaySign 易支付签名：非空参数按键名排序拼接后追加密钥取 MD5
+func epaySign(params map[string]string, key string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "sign" && k != "sign_type" && params[k] != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString("&")
+		}
+		buf.WriteString(k)
+		buf.WriteString("=")
+		buf.WriteString(params[k])
+	}
+	buf.WriteString(key)
+
+	hash := md5.Sum([]byte(buf.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+// buildQuery 构建查询字符串
+func buildQuery(params map[string]string) string {
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// formatYuan 分转为元字符串
+func formatYuan(amount int64) string {
+	return fmt.Sprintf("%.2f", float64(amount)/100)
+}
+
+// chargedAmount 网关实际收取金额（分），无小数位的币种取整
+func chargedAmount(amount int64, currency string) int64 {
+	if zeroDecimalCurrencies[strings.ToLower(currency)] {
+		return int64(math.Round(float64(amount)/100)) * 100
+	}
+	return amount
+}
+
+// formatAmount 分转为金额字符串，无小数位的币种取整
+func formatAmount(amount int64, currency string) string {
+	if zeroDecimalCurrencies[strings.ToLower(currency)] {
+		return strconv.FormatInt(chargedAmount(amount, currency)/100, 10)
+	}
+	return formatYuan(amount)
+}
+
+// parseYuan 元字符串转为分，无法解析时返回 -1
+func parseYuan(s string) int64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return -1
+	}
+	return int64(math.Round(v * 100))
+}
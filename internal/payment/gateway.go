@@ -0,0 +1,173 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Gateway 支付网关接口，新增网关只需实现该接口并在 init 中注册
+type Gateway interface {
+	// Name 网关标识，对应 Payment.Payment
+	Name() string
+	// Fields 配置项描述，用于后台渲染表单与校验 Payment.Config
+	Fields() []Field
+	// Create 发起支付
+	Create(config Config, req *Request) (*Result, error)
+	// Notify 校验并解析异步通知，无法校验时必须返回错误
+	Notify(config Config, n *Notification) (*Trade, error)
+	// Query 主动查询交易状态
+	Query(config Config, req *Request) (*Trade, error)
+	// Refund 原路退款，返回网关退款单号
+	Refund(config Config, req *RefundRequest) (string, error)
+}
+
+// Config 支付方式配置
+type Config map[string]string
+
+// Field 网关配置项
+type Field struct {
+	Key         string   `json:"key"`
+	Label       string   `json:"label"`
+	Type        string   `json:"type"` // input / textarea / select
+	Required    bool     `json:"required"`
+	Options     []string `json:"options,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Request 支付请求
+type Request struct {
+	TradeNo    string
+	CallbackNo string // 网关交易号，查询时使用
+	Amount     int64  // 应付金额（分）
+	Currency   string // 币种代码（大写），为空时使用网关配置的币种
+	Subject    string
+	NotifyURL  string
+}
+
+// Result 支付结果
+type Result struct {
+	Type       string // redirect, qrcode
+	Data       string // URL or QR code content
+	Amount     int64  // 网关实际收取金额（分），为 0 表示与请求金额一致
+	CallbackNo string // 网关预下单交易号，查询时回传
+}
+
+// Notification 网关回调原始内容
+type Notification struct {
+	Params     map[string]string
+	Body       []byte
+	Header     http.Header
+	ReceivedAt time.Time // 接收时间，重放回调时为原始接收时间
+}
+
+// Trade 网关交易信息
+type Trade struct {
+	TradeNo    string // 订单号
+	CallbackNo string // 网关交易号
+	Amount     int64  // 实付金额（分）
+	Currency   string // 实付币种，为空表示网关未返回币种
+	Paid       bool
+}
+
+// RefundRequest 退款请求
+type RefundRequest struct {
+	TradeNo    string
+	CallbackNo string
+	RefundNo   string // 退款请求号，同一退款重复请求时保持不变
+	Amount     int64  // 退款金额（分）
+	Currency   string // 订单币种
+}
+
+// 配置项类型
+const (
+	FieldInput    = "input"
+	FieldTextarea = "textarea"
+	FieldSelect   = "select"
+)
+
+// ErrRefundNotSupported 网关不支持原路退款
+var ErrRefundNotSupported = errors.New("gateway does not support refund")
+
+// zeroDecimalCurrencies 无小数位的币种（小写），提交网关时金额以元为单位
+var zeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true,
+	"krw": true, "mga": true, "pyg": true, "rwf": true, "ugx": true, "vnd": true,
+	"vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// checkCurrency 校验请求币种与网关结算币种一致，请求未指定币种时不校验
+func checkCurrency(currency, supported string) error {
+	if currency != "" && !strings.EqualFold(currency, supported) {
+		return fmt.Errorf("currency %s is not supported by this payment method", strings.ToUpper(currency))
+	}
+	return nil
+}
+
+// httpClient 网关请求使用的 HTTP 客户端
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+var gateways = make(map[string]Gateway)
+
+// Register 注册支付网关
+func Register(g Gateway) {
+	gateways[g.Name()] = g
+}
+
+// Get 获取支付网关
+func Get(name string) (Gateway, bool) {
+	g, ok := gateways[name]
+	return g, ok
+}
+
+// List 获取已注册的网关（按名称排序）
+func List() []Gateway {
+	list := make([]Gateway, 0, len(gateways))
+	for _, g := range gateways {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// ValidateConfig 按网关配置项校验配置
+func ValidateConfig(name string, config Config) error {
+	g, ok := Get(name)
+	if !ok {
+		return fmt.Errorf("unsupported payment method: %s", name)
+	}
+	for _, f := range g.Fields() {
+		value := strings.TrimSpace(config[f.Key])
+		if value == "" {
+			if f.Required && f.Default == "" {
+				return fmt.Errorf("payment config %s is required", f.Key)
+			}
+			continue
+		}
+		if f.Type == FieldSelect && !contains(f.Options, value) {
+			return fmt.Errorf("payment config %s must be one of %s", f.Key, strings.Join(f.Options, ", "))
+		}
+	}
+	return nil
+}
+
+// get 获取配置值，未配置时使用默认值
+func (c Config) get(key, def string) string {
+	if v := strings.TrimSpace(c[key]); v != "" {
+		return v
+	}
+	return def
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package payment
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		ok     bool
+	}{
+		{"epay", Config{"url": "https://pay.example.com", "pid": "1", "key": "k"}, true},
+		{"epay", Config{"url": "https://pay.example.com", "pid": "1"}, false},
+		{"stripe", Config{"secret_key": "sk", "webhook_secret": "whsec", "success_url": "https://example.com"}, true},
+		{"alipay", Config{"app_id": "1", "private_key": "x", "alipay_public_key": "y", "product": "page"}, true},
+		{"alipay", Config{"app_id": "1", "private_key": "x", "alipay_public_key": "y", "product": "wap"}, false},
+		{"unknown", Config{}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateConfig(tt.name, tt.config); (err == nil) != tt.ok {
+			t.Errorf("ValidateConfig(%s, %v) err = %v, want ok = %v", tt.name, tt.config, err, tt.ok)
+		}
+	}
+}
+
+func TestEpayNotify(t *testing.T) {
+	g := &EpayGateway{}
+	params := map[string]string{
+		"pid":          "1",
+		"out_trade_no": "T1",
+		"trade_no":     "E1",
+		"money":        "19.90",
+		"trade_status": "TRADE_SUCCESS",
+	}
+	params["sign"] = epaySign(params, "key")
+
+	trade, err := g.Notify(Config{"key": "key"}, &Notification{Params: params})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if !trade.Paid || trade.TradeNo != "T1" || trade.Amount != 1990 {
+		t.Errorf("trade = %+v", trade)
+	}
+
+	// 未配置密钥时拒绝回调
+	params["sign"] = epaySign(params, "")
+	if _, err := g.Notify(Config{}, &Notification{Params: params}); err == nil {
+		t.Error("notify without key accepted")
+	}
+}
+
+func TestEpayCreate(t *testing.T) {
+	g := &EpayGateway{}
+	config := Config{"url": "https://pay.example.com", "pid": "1", "key": "key"}
+
+	// 无小数位的币种按取整后的金额收取
+	result, err := g.Create(config, &Request{TradeNo: "T1", Amount: 12345, Currency: "JPY"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if result.Amount != 12300 || !strings.Contains(result.Data, "money=123&") {
+		t.Errorf("result = %+v", result)
+	}
+
+	result, err = g.Create(config, &Request{TradeNo: "T2", Amount: 1990, Currency: "CNY"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if result.Amount != 1990 || !strings.Contains(result.Data, "money=19.90") {
+		t.Errorf("result = %+v", result)
+	}
+}
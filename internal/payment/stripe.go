@@ -0,0 +1,290 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&StripeGateway{})
+}
+
+const (
+	stripeDefaultAPIBase  = "https://api.stripe.com"
+	stripeDefaultCurrency = "cny"
+	// stripeSignatureTolerance Webhook 时间戳允许的最大偏差
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// StripeGateway Stripe Checkout
+type StripeGateway struct{}
+
+func (g *StripeGateway) Name() string {
+	return "stripe"
+}
+
+func (g *StripeGateway) Fields() []Field {
+	return []Field{
+		{Key: "secret_key", Label: "API 密钥", Type: FieldInput, Required: true, Description: "sk_..."},
+		{Key: "webhook_secret", Label: "Webhook 签名密钥", Type: FieldInput, Required: true, Description: "whsec_..."},
+		{Key: "currency", Label: "结算币种", Type: FieldInput, Default: stripeDefaultCurrency, Description: "订单未指定币种时使用"},
+		{Key: "success_url", Label: "支付完成跳转地址", Type: FieldInput, Required: true},
+		{Key: "cancel_url", Label: "取消支付跳转地址", Type: FieldInput},
+		{Key: "api_base", Label: "API 地址", Type: FieldInput, Default: stripeDefaultAPIBase},
+	}
+}
+
+// stripeCurrency 获取结算币种（小写），优先使用订单币种
+func stripeCurrency(config Config, currency string) string {
+	if currency != "" {
+		return strings.ToLower(currency)
+	}
+	return strings.ToLower(config.get("currency", stripeDefaultCurrency))
+}
+
+// stripeAmount 将以分为单位的金额转换为 Stripe 最小货币单位
+func stripeAmount(amount int64, currency string) int64 {
+	if zeroDecimalCurrencies[currency] {
+		return int64(math.Round(float64(amount) / 100))
+	}
+	return amount
+}
+
+// stripeCents 将 Stripe 最小货币单位转换为分
+func stripeCents(amount int64, currency string) int64 {
+	if zeroDecimalCurrencies[currency] {
+		return amount * 100
+	}
+	return amount
+}
+
+func (g *StripeGateway) Create(config Config, req *Request) (*Result, error) {
+	successURL := config["success_url"]
+	if successURL == "" {
+		return nil, errors.New("stripe success_url not configured")
+	}
+
+	currency := stripeCurrency(config, req.Currency)
+	amount := stripeAmount(req.Amount, currency)
+	if amount <= 0 {
+		return nil, errors.New("invalid payment amount")
+	}
+
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", successURL)
+	form.Set("cancel_url", config.get("cancel_url", successURL))
+	form.Set("client_reference_id", req.TradeNo)
+	form.Set("metadata[trade_no]", req.TradeNo)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Subject)
+
+	var session stripeSession
+	if err := stripeRequest(config, http.MethodPost, "/v1/checkout/sessions", form, "", &session); err != nil {
+		return nil, err
+	}
+	if session.URL == "" {
+		return nil, errors.New("stripe session url is empty")
+	}
+
+	return &Result{
+		Type:       "redirect",
+		Data:       session.URL,
+		Amount:     stripeCents(amount, currency),
+		CallbackNo: session.ID,
+	}, nil
+}
+
+// stripeSession Checkout Session
+type stripeSession struct {
+	ID                string            `json:"id"`
+	URL               string            `json:"url"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Metadata          map[string]string `json:"metadata"`
+	PaymentStatus     string            `json:"payment_status"`
+	PaymentIntent     string            `json:"payment_intent"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+}
+
+// trade 转换为交易信息，金额按会话币种换算为分，币种由调用方与订单核对
+func (s *stripeSession) trade() *Trade {
+	tradeNo := s.Metadata["trade_no"]
+	if tradeNo == "" {
+		tradeNo = s.ClientReferenceID
+	}
+	currency := strings.ToLower(s.Currency)
+	return &Trade{
+		TradeNo:    tradeNo,
+		CallbackNo: s.ID,
+		Amount:     stripeCents(s.AmountTotal, currency),
+		Currency:   strings.ToUpper(currency),
+		Paid:       s.PaymentStatus == "paid",
+	}
+}
+
+func (g *StripeGateway) Notify(config Config, n *Notification) (*Trade, error) {
+	receivedAt := n.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	if err := verifyStripeSignature(n.Body, n.Header.Get("Stripe-Signature"), config["webhook_secret"], receivedAt); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object stripeSession `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(n.Body, &event); err != nil {
+		return nil, errors.New("invalid stripe event")
+	}
+
+	trade := event.Data.Object.trade()
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+	default:
+		// 其他事件只确认不处理
+		trade.Paid = false
+	}
+	return trade, nil
+}
+
+func (g *StripeGateway) Query(config Config, req *Request) (*Trade, error) {
+	if req.CallbackNo == "" {
+		return &Trade{TradeNo: req.TradeNo}, nil
+	}
+	var session stripeSession
+	if err := stripeRequest(config, http.MethodGet, "/v1/checkout/sessions/"+url.PathEscape(req.CallbackNo), nil, "", &session); err != nil {
+		return nil, err
+	}
+	return session.trade(), nil
+}
+
+func (g *StripeGateway) Refund(config Config, req *RefundRequest) (string, error) {
+	if req.CallbackNo == "" {
+		return "", errors.New("stripe session not found")
+	}
+	var session stripeSession
+	if err := stripeRequest(config, http.MethodGet, "/v1/checkout/sessions/"+url.PathEscape(req.CallbackNo), nil, "", &session); err != nil {
+		return "", err
+	}
+	if session.PaymentIntent == "" {
+		return "", errors.New("stripe payment intent not found")
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", session.PaymentIntent)
+	form.Set("amount", strconv.FormatInt(stripeAmount(req.Amount, stripeCurrency(config, req.Currency)), 10))
+	form.Set("metadata[trade_no]", req.TradeNo)
+
+	var refund struct {
+		ID string `json:"id"`
+	}
+	if err := stripeRequest(config, http.MethodPost, "/v1/refunds", form, req.RefundNo, &refund); err != nil {
+		return "", err
+	}
+	return refund.ID, nil
+}
+
+// stripeRequest 调用 Stripe API，idempotencyKey 非空时防止重复提交
+func stripeRequest(config Config, method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	if config["secret_key"] == "" {
+		return errors.New("stripe secret_key not configured")
+	}
+	apiBase := strings.TrimRight(config.get("api_base", stripeDefaultAPIBase), "/")
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, apiBase+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config["secret_key"])
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &apiErr)
+		if apiErr.Error.Message != "" {
+			return fmt.Errorf("stripe: %s", apiErr.Error.Message)
+		}
+		return fmt.Errorf("stripe: unexpected status %d", resp.StatusCode)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// verifyStripeSignature 校验 Stripe-Signature 头
+// 格式：t=时间戳,v1=签名[,v1=签名...]，签名为 HMAC-SHA256(secret, "t.body")
+func verifyStripeSignature(body []byte, signature, secret string, now time.Time) error {
+	if secret == "" {
+		return errors.New("stripe webhook_secret not configured")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signature, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("invalid stripe signature header")
+	}
+	if diff := now.Sub(time.Unix(ts, 0)); diff > stripeSignatureTolerance || diff < -stripeSignatureTolerance {
+		return errors.New("stripe signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
@@ -0,0 +1,96 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signStripePayload(body []byte, secret string, ts int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", ts)))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	body := []byte(`{"type":"checkout.session.completed"}`)
+	now := time.Unix(1700000000, 0)
+	secret := "whsec_test"
+
+	if err := verifyStripeSignature(body, signStripePayload(body, secret, now.Unix()), secret, now); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	// 多个 v1 签名时任一匹配即可
+	header := "t=1700000000,v1=deadbeef," + signStripePayload(body, secret, now.Unix())[len("t=1700000000,"):]
+	if err := verifyStripeSignature(body, header, secret, now); err != nil {
+		t.Errorf("signature with rotated secrets rejected: %v", err)
+	}
+
+	invalid := []string{
+		signStripePayload(body, "whsec_other", now.Unix()),
+		signStripePayload(body, secret, now.Add(-10*time.Minute).Unix()),
+		signStripePayload([]byte(`{}`), secret, now.Unix()),
+		"v1=abc",
+		"",
+	}
+	for _, header := range invalid {
+		if err := verifyStripeSignature(body, header, secret, now); err == nil {
+			t.Errorf("signature %q expected error", header)
+		}
+	}
+	if err := verifyStripeSignature(body, signStripePayload(body, "", now.Unix()), "", now); err == nil {
+		t.Error("empty webhook secret expected error")
+	}
+}
+
+func TestStripeCreate(t *testing.T) {
+	var form map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/checkout/sessions" || r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+			return
+		}
+		r.ParseForm()
+		form = make(map[string]string)
+		for k, v := range r.PostForm {
+			form[k] = v[0]
+		}
+		w.Write([]byte(`{"id":"cs_test_1","url":"https://checkout.stripe.com/c/pay/cs_test_1"}`))
+	}))
+	defer srv.Close()
+
+	g := &StripeGateway{}
+	req := &Request{TradeNo: "T1", Amount: 1050, Subject: "订阅服务"}
+	config := Config{"secret_key": "sk_test", "api_base": srv.URL, "currency": "JPY", "success_url": "https://example.com"}
+
+	result, err := g.Create(config, req)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if result.Type != "redirect" || result.Data != "https://checkout.stripe.com/c/pay/cs_test_1" || result.CallbackNo != "cs_test_1" {
+		t.Errorf("result = %+v", result)
+	}
+	// 实际收取金额按无小数币种取整
+	if result.Amount != 1100 {
+		t.Errorf("result amount = %d, want 1100", result.Amount)
+	}
+	// JPY 为无小数币种：1050 分 -> 11
+	if form["line_items[0][price_data][unit_amount]"] != "11" || form["line_items[0][price_data][currency]"] != "jpy" {
+		t.Errorf("form = %v", form)
+	}
+	if form["metadata[trade_no]"] != "T1" {
+		t.Errorf("metadata trade_no = %q", form["metadata[trade_no]"])
+	}
+
+	config["secret_key"] = "sk_wrong"
+	if _, err := g.Create(config, req); err == nil || err.Error() != "stripe: invalid api key" {
+		t.Errorf("expected api error, got %v", err)
+	}
+}
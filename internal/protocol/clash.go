@@ -5,76 +5,12 @@ import (
 	"strings"
 
 	"dashgo/internal/model"
-
-	"gopkg.in/yaml.v3"
 )
 
-// ClashConfig Clash 配置结构
-type ClashConfig struct {
-	Port               int                      `yaml:"port,omitempty"`
-	SocksPort          int                      `yaml:"socks-port,omitempty"`
-	AllowLan           bool                     `yaml:"allow-lan"`
-	Mode               string                   `yaml:"mode"`
-	LogLevel           string                   `yaml:"log-level"`
-	ExternalController string                   `yaml:"external-controller,omitempty"`
-	DNS                *ClashDNS                `yaml:"dns,omitempty"`
-	Proxies            []map[string]interface{} `yaml:"proxies"`
-	ProxyGroups        []ClashProxyGroup        `yaml:"proxy-groups"`
-	Rules              []string                 `yaml:"rules"`
-}
-
-type ClashDNS struct {
-	Enable         bool                 `yaml:"enable"`
-	IPv6           bool                 `yaml:"ipv6"`
-	NameServer     []string             `yaml:"nameserver"`
-	Fallback       []string             `yaml:"fallback,omitempty"`
-	FallbackFilter *ClashFallbackFilter `yaml:"fallback-filter,omitempty"`
-}
-
-type ClashFallbackFilter struct {
-	GeoIP  bool     `yaml:"geoip"`
-	IPCidr []string `yaml:"ipcidr,omitempty"`
-}
-
-type ClashProxyGroup struct {
-	Name     string   `yaml:"name"`
-	Type     string   `yaml:"type"`
-	Proxies  []string `yaml:"proxies"`
-	URL      string   `yaml:"url,omitempty"`
-	Interval int      `yaml:"interval,omitempty"`
-}
-
-// GenerateClashConfig 生成 Clash 配置
+// GenerateClashConfig 使用内置模板生成 Clash 配置
 func GenerateClashConfig(servers []model.ServerInfo, user *model.User) string {
-	config := getDefaultClashConfig()
-
-	proxyNames := []string{}
-	for _, server := range servers {
-		proxy := buildClashProxy(server, user)
-		if proxy != nil {
-			config.Proxies = append(config.Proxies, proxy)
-			proxyNames = append(proxyNames, server.Name)
-		}
-	}
-
-	// 更新代理组，将节点添加到需要的组中
-	for i := range config.ProxyGroups {
-		groupName := config.ProxyGroups[i].Name
-		switch groupName {
-		case "🚀 节点选择":
-			// 节点选择组：添加所有节告
-			config.ProxyGroups[i].Proxies = append(config.ProxyGroups[i].Proxies, proxyNames...)
-		case "♻️ 自动选择", "🔯 故障转移", "🔮 负载均衡":
-			// 自动选择/故障转移/负载均衡：添加所有节告
-			config.ProxyGroups[i].Proxies = proxyNames
-		case "📲 电报消息", "🤖 OpenAI", "📹 YouTube", "🎬 Netflix", "🍎 苹果服务", "🎮 游戏平台", "🐟 漏网之鱼":
-			// 其他分组：添加所有节点到末尾
-			config.ProxyGroups[i].Proxies = append(config.ProxyGroups[i].Proxies, proxyNames...)
-		}
-	}
-
-	data, _ := yaml.Marshal(config)
-	return string(data)
+	config, _ := RenderClashConfig(DefaultTemplate("clash"), servers, user)
+	return config
 }
 
 func buildClashProxy(server model.ServerInfo, user *model.User) map[string]interface{} {
@@ -352,6 +288,9 @@ func buildClashProxy(server model.ServerInfo, user *model.User) map[string]inter
 		}
 		return proxy
 
+	case model.ServerTypeWireGuard:
+		return buildClashWireGuard(server, user)
+
 	case "naive":
 		// NaiveProxy 告Clash Meta 中不直接支持，返告nil
 		return nil
@@ -422,168 +361,3 @@ func parsePort(portStr string) int {
 	fmt.Sscanf(portStr, "%d", &port)
 	return port
 }
-
-func getDefaultClashConfig() *ClashConfig {
-	return &ClashConfig{
-		Port:      7890,
-		SocksPort: 7891,
-		AllowLan:  false,
-		Mode:      "rule",
-		LogLevel:  "info",
-		DNS: &ClashDNS{
-			Enable:     true,
-			IPv6:       false,
-			NameServer: []string{"223.5.5.5", "119.29.29.29", "https://doh.pub/dns-query"},
-			Fallback:   []string{"8.8.8.8", "1.1.1.1", "https://dns.google/dns-query"},
-			FallbackFilter: &ClashFallbackFilter{
-				GeoIP:  true,
-				IPCidr: []string{"240.0.0.0/4", "0.0.0.0/32"},
-			},
-		},
-		Proxies: []map[string]interface{}{},
-		ProxyGroups: []ClashProxyGroup{
-			{
-				Name:    "🚀 节点选择",
-				Type:    "select",
-				Proxies: []string{"♻️ 自动选择", "🔯 故障转移", "🔮 负载均衡", "DIRECT"},
-			},
-			{
-				Name:     "♻️ 自动选择",
-				Type:     "url-test",
-				Proxies:  []string{},
-				URL:      "http://www.gstatic.com/generate_204",
-				Interval: 300,
-			},
-			{
-				Name:     "🔯 故障转移",
-				Type:     "fallback",
-				Proxies:  []string{},
-				URL:      "http://www.gstatic.com/generate_204",
-				Interval: 300,
-			},
-			{
-				Name:    "🔮 负载均衡",
-				Type:    "load-balance",
-				Proxies: []string{},
-				URL:     "http://www.gstatic.com/generate_204",
-			},
-			{
-				Name:    "📲 电报消息",
-				Type:    "select",
-				Proxies: []string{"🚀 节点选择", "♻️ 自动选择", "DIRECT"},
-			},
-			{
-				Name:    "🤖 OpenAI",
-				Type:    "select",
-				Proxies: []string{"🚀 节点选择", "♻️ 自动选择"},
-			},
-			{
-				Name:    "📹 YouTube",
-				Type:    "select",
-				Proxies: []string{"🚀 节点选择", "♻️ 自动选择", "DIRECT"},
-			},
-			{
-				Name:    "🎬 Netflix",
-				Type:    "select",
-				Proxies: []string{"🚀 节点选择", "♻️ 自动选择", "DIRECT"},
-			},
-			{
-				Name:    "🍎 苹果服务",
-				Type:    "select",
-				Proxies: []string{"DIRECT", "🚀 节点选择"},
-			},
-			{
-				Name:    "🎮 游戏平台",
-				Type:    "select",
-				Proxies: []string{"DIRECT", "🚀 节点选择"},
-			},
-			{
-				Name:    "🐟 漏网之鱼",
-				Type:    "select",
-				Proxies: []string{"🚀 节点选择", "♻️ 自动选择", "DIRECT"},
-			},
-		},
-		Rules: []string{
-			// 本地/局域网
-			"DOMAIN-SUFFIX,local,DIRECT",
-			"IP-CIDR,127.0.0.0/8,DIRECT",
-			"IP-CIDR,172.16.0.0/12,DIRECT",
-			"IP-CIDR,192.168.0.0/16,DIRECT",
-			"IP-CIDR,10.0.0.0/8,DIRECT",
-			"IP-CIDR,100.64.0.0/10,DIRECT",
-			// OpenAI
-			"DOMAIN-SUFFIX,openai.com,🤖 OpenAI",
-			"DOMAIN-SUFFIX,ai.com,🤖 OpenAI",
-			"DOMAIN-SUFFIX,anthropic.com,🤖 OpenAI",
-			"DOMAIN-SUFFIX,claude.ai,🤖 OpenAI",
-			"DOMAIN-KEYWORD,openai,🤖 OpenAI",
-			// Telegram
-			"DOMAIN-SUFFIX,telegram.org,📲 电报消息",
-			"DOMAIN-SUFFIX,t.me,📲 电报消息",
-			"DOMAIN-SUFFIX,tg.dev,📲 电报消息",
-			"IP-CIDR,91.108.0.0/16,📲 电报消息",
-			"IP-CIDR,109.239.140.0/24,📲 电报消息",
-			"IP-CIDR,149.154.160.0/20,📲 电报消息",
-			// YouTube
-			"DOMAIN-SUFFIX,youtube.com,📹 YouTube",
-			"DOMAIN-SUFFIX,googlevideo.com,📹 YouTube",
-			"DOMAIN-SUFFIX,ytimg.com,📹 YouTube",
-			"DOMAIN-SUFFIX,yt.be,📹 YouTube",
-			// Netflix
-			"DOMAIN-SUFFIX,netflix.com,🎬 Netflix",
-			"DOMAIN-SUFFIX,netflix.net,🎬 Netflix",
-			"DOMAIN-SUFFIX,nflximg.com,🎬 Netflix",
-			"DOMAIN-SUFFIX,nflximg.net,🎬 Netflix",
-			"DOMAIN-SUFFIX,nflxvideo.net,🎬 Netflix",
-			// Apple
-			"DOMAIN-SUFFIX,apple.com,🍎 苹果服务",
-			"DOMAIN-SUFFIX,icloud.com,🍎 苹果服务",
-			"DOMAIN-SUFFIX,icloud-content.com,🍎 苹果服务",
-			"DOMAIN-SUFFIX,mzstatic.com,🍎 苹果服务",
-			// 游戏
-			"DOMAIN-SUFFIX,steam.com,🎮 游戏平台",
-			"DOMAIN-SUFFIX,steampowered.com,🎮 游戏平台",
-			"DOMAIN-SUFFIX,steamcommunity.com,🎮 游戏平台",
-			"DOMAIN-SUFFIX,epicgames.com,🎮 游戏平台",
-			"DOMAIN-SUFFIX,ea.com,🎮 游戏平台",
-			// Google
-			"DOMAIN-SUFFIX,google.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,googleapis.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,gstatic.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,gmail.com,🚀 节点选择",
-			// GitHub
-			"DOMAIN-SUFFIX,github.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,githubusercontent.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,githubassets.com,🚀 节点选择",
-			// Twitter
-			"DOMAIN-SUFFIX,twitter.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,x.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,twimg.com,🚀 节点选择",
-			// Facebook
-			"DOMAIN-SUFFIX,facebook.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,fb.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,instagram.com,🚀 节点选择",
-			"DOMAIN-SUFFIX,whatsapp.com,🚀 节点选择",
-			// 国内直连
-			"DOMAIN-SUFFIX,cn,DIRECT",
-			"DOMAIN-SUFFIX,baidu.com,DIRECT",
-			"DOMAIN-SUFFIX,qq.com,DIRECT",
-			"DOMAIN-SUFFIX,weixin.com,DIRECT",
-			"DOMAIN-SUFFIX,taobao.com,DIRECT",
-			"DOMAIN-SUFFIX,jd.com,DIRECT",
-			"DOMAIN-SUFFIX,bilibili.com,DIRECT",
-			"DOMAIN-SUFFIX,163.com,DIRECT",
-			"DOMAIN-SUFFIX,126.com,DIRECT",
-			"DOMAIN-SUFFIX,sina.com,DIRECT",
-			"DOMAIN-SUFFIX,weibo.com,DIRECT",
-			"DOMAIN-SUFFIX,zhihu.com,DIRECT",
-			"DOMAIN-SUFFIX,douyin.com,DIRECT",
-			"DOMAIN-SUFFIX,tiktok.com,🚀 节点选择",
-			// GeoIP
-			"GEOIP,LAN,DIRECT",
-			"GEOIP,CN,DIRECT",
-			// 兜底
-			"MATCH,🐟 漏网之鱼",
-		},
-	}
-}
@@ -5,8 +5,6 @@ import (
 	"strings"
 
 	"dashgo/internal/model"
-
-	"gopkg.in/yaml.v3"
 )
 
 // GenerateQuantumultXConfig 生成 Quantumult X 配置
@@ -451,35 +449,21 @@ func GenerateShadowrocketConfig(servers []model.ServerInfo, user *model.User) st
 	return GenerateBase64Links(servers, user)
 }
 
-// GenerateClashMetaConfig 生成 Clash Meta (mihomo) 配置
+// GenerateClashMetaConfig 使用内置模板生成 Clash Meta (mihomo) 配置
 func GenerateClashMetaConfig(servers []model.ServerInfo, user *model.User) string {
-	// Clash Meta 完全兼容 Clash 配置，但支持更多协议
-	config := getDefaultClashMetaConfig()
-
-	proxyNames := []string{}
-	for _, server := range servers {
-		proxy := buildClashMetaProxy(server, user)
-		if proxy != nil {
-			config.Proxies = append(config.Proxies, proxy)
-			proxyNames = append(proxyNames, server.Name)
-		}
-	}
-
-	// 更新代理告
-	for i := range config.ProxyGroups {
-		if config.ProxyGroups[i].Name == "Proxy" || config.ProxyGroups[i].Name == "Auto" {
-			config.ProxyGroups[i].Proxies = append(config.ProxyGroups[i].Proxies, proxyNames...)
-		}
-	}
-
-	data, _ := yaml.Marshal(config)
-	return string(data)
+	config, _ := RenderClashMetaConfig(DefaultTemplate("clashmeta"), servers, user)
+	return config
 }
 
 func buildClashMetaProxy(server model.ServerInfo, user *model.User) map[string]interface{} {
 	ps := server.ProtocolSettings
 	port := parsePort(server.Port)
 
+	// Mieru 仅 Clash Meta 支持
+	if server.Type == model.ServerTypeMieru {
+		return buildClashMetaMieru(server, user)
+	}
+
 	// 基础配置告Clash 相同
 	proxy := buildClashProxy(server, user)
 	if proxy == nil {
@@ -543,8 +527,34 @@ func buildClashMetaProxy(server model.ServerInfo, user *model.User) map[string]i
 	return proxy
 }
 
-func getDefaultClashMetaConfig() *ClashConfig {
-	config := getDefaultClashConfig()
-	// Clash Meta 特有配置
-	return config
+// buildClashMetaMieru 构建 mihomo 的 mieru 代理
+func buildClashMetaMieru(server model.ServerInfo, user *model.User) map[string]interface{} {
+	ps := server.ProtocolSettings
+
+	transport := "TCP"
+	if t, ok := ps["transport"].(string); ok && t != "" {
+		transport = strings.ToUpper(t)
+	}
+
+	proxy := map[string]interface{}{
+		"name":      server.Name,
+		"type":      "mieru",
+		"server":    server.Host,
+		"transport": transport,
+		"username":  user.UUID[:8],
+		"password":  user.UUID,
+	}
+
+	// 端口范围优先
+	if server.Ports != "" {
+		proxy["port-range"] = server.Ports
+	} else {
+		proxy["port"] = parsePort(server.Port)
+	}
+
+	if m, ok := ps["multiplexing"].(string); ok && m != "" {
+		proxy["multiplexing"] = m
+	}
+
+	return proxy
 }
@@ -89,59 +89,17 @@ type RouteRule struct {
 	Outbound string   `json:"outbound"`
 }
 
-// GenerateSingBoxConfig 生成 sing-box 配置
+// GenerateSingBoxConfig 使用内置模板生成 sing-box 配置
 func GenerateSingBoxConfig(servers []model.ServerInfo, user *model.User) map[string]interface{} {
-	config := getDefaultSingBoxConfig()
-
-	outbounds := config["outbounds"].([]interface{})
-	proxyTags := []string{}
-
-	for _, server := range servers {
-		outbound := buildSingBoxOutbound(server, user)
-		if outbound != nil {
-			outbounds = append(outbounds, outbound)
-			proxyTags = append(proxyTags, server.Name)
-		}
-	}
-
-	// 更新各个分组告outbounds
-	for i, ob := range outbounds {
-		if m, ok := ob.(map[string]interface{}); ok {
-			tag, _ := m["tag"].(string)
-			outType, _ := m["type"].(string)
-
-			switch tag {
-			case "🚀 节点选择":
-				// 节点选择：添加所有节告
-				if existing, ok := m["outbounds"].([]string); ok {
-					m["outbounds"] = append(existing, proxyTags...)
-				}
-			case "♻️ 自动选择", "🔯 故障转移":
-				// 自动选择/故障转移：只包含节点
-				m["outbounds"] = proxyTags
-			case "📲 电报消息", "🤖 OpenAI", "📹 YouTube", "🎬 Netflix", "🍎 苹果服务", "🐟 漏网之鱼":
-				// 其他分组：添加所有节告
-				if existing, ok := m["outbounds"].([]string); ok {
-					m["outbounds"] = append(existing, proxyTags...)
-				}
-			default:
-				// 其他 selector/urltest 类型
-				if outType == "selector" || outType == "urltest" {
-					if existing, ok := m["outbounds"].([]string); ok {
-						m["outbounds"] = append(existing, proxyTags...)
-					} else {
-						m["outbounds"] = proxyTags
-					}
-				}
-			}
-			outbounds[i] = m
-		}
-	}
-
-	config["outbounds"] = outbounds
+	config, _ := RenderSingBoxConfig(DefaultTemplate("singbox"), servers, user)
 	return config
 }
 
+// BuildSingBoxOutbound 构建单个节点的 sing-box 出站（中转节点连接落地节点时使用）
+func BuildSingBoxOutbound(server model.ServerInfo, user *model.User) map[string]interface{} {
+	return buildSingBoxOutbound(server, user)
+}
+
 func buildSingBoxOutbound(server model.ServerInfo, user *model.User) map[string]interface{} {
 	ps := server.ProtocolSettings
 
@@ -168,6 +126,11 @@ func buildSingBoxOutbound(server model.ServerInfo, user *model.User) map[string]
 		return buildShadowTLS(server, user)
 	case "naive":
 		return buildNaive(server, user)
+	case model.ServerTypeWireGuard:
+		return buildSingBoxWireGuard(server, user)
+	case model.ServerTypeMieru:
+		// sing-box 官方版本不支持 mieru 出站
+		return nil
 	}
 
 	_ = ps
@@ -640,112 +603,6 @@ func buildTransport(network string, ps model.JSONMap) map[string]interface{} {
 	return nil
 }
 
-func getDefaultSingBoxConfig() map[string]interface{} {
-	return map[string]interface{}{
-		"log": map[string]interface{}{
-			"level":     "info",
-			"timestamp": true,
-		},
-		"dns": map[string]interface{}{
-			"servers": []map[string]interface{}{
-				{"tag": "google", "address": "https://dns.google/dns-query", "detour": "🚀 节点选择"},
-				{"tag": "cloudflare", "address": "https://cloudflare-dns.com/dns-query", "detour": "🚀 节点选择"},
-				{"tag": "alidns", "address": "https://dns.alidns.com/dns-query", "detour": "direct"},
-				{"tag": "local", "address": "223.5.5.5", "detour": "direct"},
-			},
-			"rules": []map[string]interface{}{
-				{"domain_suffix": []string{".cn"}, "server": "local"},
-				{"geosite": "cn", "server": "local"},
-			},
-			"final": "google",
-		},
-		"outbounds": []interface{}{
-			map[string]interface{}{
-				"type":      "selector",
-				"tag":       "🚀 节点选择",
-				"outbounds": []string{"♻️ 自动选择", "🔯 故障转移", "direct"},
-			},
-			map[string]interface{}{
-				"type":      "urltest",
-				"tag":       "♻️ 自动选择",
-				"outbounds": []string{},
-				"url":       "https://www.gstatic.com/generate_204",
-				"interval":  "5m",
-				"tolerance": 50,
-			},
-			map[string]interface{}{
-				"type":      "urltest",
-				"tag":       "🔯 故障转移",
-				"outbounds": []string{},
-				"url":       "https://www.gstatic.com/generate_204",
-				"interval":  "5m",
-			},
-			map[string]interface{}{
-				"type":      "selector",
-				"tag":       "📲 电报消息",
-				"outbounds": []string{"🚀 节点选择", "♻️ 自动选择", "direct"},
-			},
-			map[string]interface{}{
-				"type":      "selector",
-				"tag":       "🤖 OpenAI",
-				"outbounds": []string{"🚀 节点选择", "♻️ 自动选择"},
-			},
-			map[string]interface{}{
-				"type":      "selector",
-				"tag":       "📹 YouTube",
-				"outbounds": []string{"🚀 节点选择", "♻️ 自动选择", "direct"},
-			},
-			map[string]interface{}{
-				"type":      "selector",
-				"tag":       "🎬 Netflix",
-				"outbounds": []string{"🚀 节点选择", "♻️ 自动选择", "direct"},
-			},
-			map[string]interface{}{
-				"type":      "selector",
-				"tag":       "🍎 苹果服务",
-				"outbounds": []string{"direct", "🚀 节点选择"},
-			},
-			map[string]interface{}{
-				"type":      "selector",
-				"tag":       "🐟 漏网之鱼",
-				"outbounds": []string{"🚀 节点选择", "♻️ 自动选择", "direct"},
-			},
-			map[string]interface{}{"type": "direct", "tag": "direct"},
-			map[string]interface{}{"type": "block", "tag": "block"},
-			map[string]interface{}{"type": "dns", "tag": "dns-out"},
-		},
-		"route": map[string]interface{}{
-			"rules": []map[string]interface{}{
-				{"protocol": []string{"dns"}, "outbound": "dns-out"},
-				{"ip_is_private": true, "outbound": "direct"},
-				// OpenAI
-				{"domain_suffix": []string{"openai.com", "ai.com", "anthropic.com", "claude.ai"}, "outbound": "🤖 OpenAI"},
-				{"domain_keyword": []string{"openai"}, "outbound": "🤖 OpenAI"},
-				// Telegram
-				{"domain_suffix": []string{"telegram.org", "t.me", "tg.dev"}, "outbound": "📲 电报消息"},
-				{"ip_cidr": []string{"91.108.0.0/16", "109.239.140.0/24", "149.154.160.0/20"}, "outbound": "📲 电报消息"},
-				// YouTube
-				{"domain_suffix": []string{"youtube.com", "googlevideo.com", "ytimg.com", "yt.be"}, "outbound": "📹 YouTube"},
-				// Netflix
-				{"domain_suffix": []string{"netflix.com", "netflix.net", "nflximg.com", "nflximg.net", "nflxvideo.net"}, "outbound": "🎬 Netflix"},
-				// Apple
-				{"domain_suffix": []string{"apple.com", "icloud.com", "icloud-content.com", "mzstatic.com"}, "outbound": "🍎 苹果服务"},
-				// Google
-				{"domain_suffix": []string{"google.com", "googleapis.com", "gstatic.com", "gmail.com"}, "outbound": "🚀 节点选择"},
-				// GitHub
-				{"domain_suffix": []string{"github.com", "githubusercontent.com", "githubassets.com"}, "outbound": "🚀 节点选择"},
-				// Twitter
-				{"domain_suffix": []string{"twitter.com", "x.com", "twimg.com"}, "outbound": "🚀 节点选择"},
-				// 国内直连
-				{"geosite": "cn", "outbound": "direct"},
-				{"geoip": "cn", "outbound": "direct"},
-			},
-			"final":                 "🐟 漏网之鱼",
-			"auto_detect_interface": true,
-		},
-	}
-}
-
 // ToJSON 转换告JSON 字符告
 func ToJSON(config map[string]interface{}) string {
 	data, _ := json.MarshalIndent(config, "", "  ")
@@ -0,0 +1,224 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+
+	"dashgo/internal/model"
+)
+
+// SubscribeFormat 订阅格式定义
+type SubscribeFormat struct {
+	Name        string            // 格式名称，对应 ?format= 参数
+	Aliases     []string          // 格式别名
+	UserAgents  []string          // User-Agent 匹配关键字（小写）
+	ContentType string            // 响应 Content-Type
+	FileExt     string            // 下载文件扩展名
+	Headers     map[string]string // 额外响应头，{title} 替换为站点名称，{filename} 替换为按 RFC 5987 编码的下载文件名
+	Template    string            // 使用的模板名称，为空表示不支持模板
+	Generate    func(servers []model.ServerInfo, user *model.User) string
+	Render      func(content string, servers []model.ServerInfo, user *model.User) (string, error)
+}
+
+// Clash 系客户端读取更新间隔与配置名称，并以下载文件名作为配置文件名
+var clashHeaders = map[string]string{
+	"profile-update-interval": "24",
+	"profile-title":           "{title}",
+	"content-disposition":     "attachment; filename*=UTF-8''{filename}",
+}
+
+// 配置文件类客户端以附件形式下载，base64 链接类格式不设置
+var fileHeaders = map[string]string{
+	"content-disposition": "attachment; filename*=UTF-8''{filename}",
+}
+
+// 匹配顺序即优先级：更具体的客户端必须排在通用关键字之前
+// 例如 mihomo/Clash.Meta 与 Stash 要先于 clash 匹配
+var subscribeFormats = []*SubscribeFormat{
+	{
+		Name:        "singbox",
+		Aliases:     []string{"sing-box", "sfa", "sfi", "sfm"},
+		UserAgents:  []string{"sing-box", "hiddify", "sfa", "sfi", "sfm"},
+		ContentType: "application/json; charset=utf-8",
+		FileExt:     ".json",
+		Template:    "singbox",
+		Headers:     clashHeaders,
+		Generate: func(servers []model.ServerInfo, user *model.User) string {
+			return ToJSON(GenerateSingBoxConfig(servers, user))
+		},
+		Render: func(content string, servers []model.ServerInfo, user *model.User) (string, error) {
+			config, err := RenderSingBoxConfig(content, servers, user)
+			if err != nil {
+				return "", err
+			}
+			return ToJSON(config), nil
+		},
+	},
+	{
+		Name:        "clashmeta",
+		Aliases:     []string{"mihomo", "clash.meta", "meta"},
+		UserAgents:  []string{"mihomo", "clash.meta", "clashmeta", "clashx meta", "clash-verge", "clash verge", "flclash", "nyanpasu"},
+		ContentType: "text/yaml; charset=utf-8",
+		FileExt:     ".yaml",
+		Template:    "clashmeta",
+		Headers:     clashHeaders,
+		Generate:    GenerateClashMetaConfig,
+		Render:      RenderClashMetaConfig,
+	},
+	{
+		Name:        "stash",
+		UserAgents:  []string{"stash"},
+		ContentType: "text/yaml; charset=utf-8",
+		FileExt:     ".yaml",
+		Template:    "clashmeta",
+		Headers:     clashHeaders,
+		Generate:    GenerateClashMetaConfig,
+		Render:      RenderClashMetaConfig,
+	},
+	{
+		Name:        "clash",
+		UserAgents:  []string{"clash"},
+		ContentType: "text/yaml; charset=utf-8",
+		FileExt:     ".yaml",
+		Template:    "clash",
+		Headers:     clashHeaders,
+		Generate:    GenerateClashConfig,
+		Render:      RenderClashConfig,
+	},
+	{
+		Name:        "surfboard",
+		UserAgents:  []string{"surfboard"},
+		ContentType: "text/plain; charset=utf-8",
+		FileExt:     ".conf",
+		Template:    "surfboard",
+		Headers:     fileHeaders,
+		Generate:    GenerateSurfboardConfig,
+		Render:      RenderSurfboardConfig,
+	},
+	{
+		Name:        "surge",
+		UserAgents:  []string{"surge"},
+		ContentType: "text/plain; charset=utf-8",
+		FileExt:     ".conf",
+		Template:    "surge",
+		Headers:     fileHeaders,
+		Generate:    GenerateSurgeConfig,
+		Render:      RenderSurgeConfig,
+	},
+	{
+		Name:        "quantumultx",
+		Aliases:     []string{"quanx", "quantumult"},
+		UserAgents:  []string{"quantumult%20x", "quantumult x"},
+		ContentType: "text/plain; charset=utf-8",
+		FileExt:     ".conf",
+		Headers:     fileHeaders,
+		Generate:    GenerateQuantumultXConfig,
+	},
+	{
+		Name:        "loon",
+		UserAgents:  []string{"loon"},
+		ContentType: "text/plain; charset=utf-8",
+		FileExt:     ".conf",
+		Headers:     fileHeaders,
+		Generate:    GenerateLoonConfig,
+	},
+	{
+		Name:        "shadowrocket",
+		UserAgents:  []string{"shadowrocket"},
+		ContentType: "text/plain; charset=utf-8",
+		FileExt:     ".txt",
+		Generate:    GenerateShadowrocketConfig,
+	},
+	{
+		Name:        "v2rayn",
+		Aliases:     []string{"v2rayng", "v2ray"},
+		UserAgents:  []string{"v2rayn", "v2rayng"},
+		ContentType: "text/plain; charset=utf-8",
+		FileExt:     ".txt",
+		Generate:    GenerateBase64Links,
+	},
+}
+
+// 未匹配到任何格式时使用的默认格式
+var defaultSubscribeFormat = &SubscribeFormat{
+	Name:        "base64",
+	ContentType: "text/plain; charset=utf-8",
+	FileExt:     ".txt",
+	Generate:    GenerateBase64Links,
+}
+
+// GetSubscribeFormats 获取所有已注册的订阅格式
+func GetSubscribeFormats() []*SubscribeFormat {
+	return append(subscribeFormats, defaultSubscribeFormat)
+}
+
+// GetSubscribeFormat 根据名称或别名获取订阅格式
+func GetSubscribeFormat(name string) *SubscribeFormat {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil
+	}
+	for _, f := range GetSubscribeFormats() {
+		if f.Name == name {
+			return f
+		}
+		for _, alias := range f.Aliases {
+			if alias == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Build 生成订阅内容，content 为空时使用内置模板
+func (f *SubscribeFormat) Build(content string, servers []model.ServerInfo, user *model.User) (string, error) {
+	if f.Render == nil || content == "" {
+		return f.Generate(servers, user), nil
+	}
+	return f.Render(content, servers, user)
+}
+
+// ResponseHeaders 生成该格式的额外响应头
+func (f *SubscribeFormat) ResponseHeaders(siteName string) map[string]string {
+	replacer := strings.NewReplacer("{title}", siteName, "{filename}", encodeFilename(siteName+f.FileExt))
+	headers := make(map[string]string, len(f.Headers))
+	for k, v := range f.Headers {
+		headers[k] = replacer.Replace(v)
+	}
+	return headers
+}
+
+// encodeFilename 按 RFC 5987 百分号编码文件名，支持非 ASCII 站点名称
+func encodeFilename(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// ResolveSubscribeFormat 解析订阅格式，?format= 优先，其次匹配 User-Agent，最后回退到 base64
+func ResolveSubscribeFormat(format, userAgent string) *SubscribeFormat {
+	if f := GetSubscribeFormat(format); f != nil {
+		return f
+	}
+
+	ua := strings.ToLower(userAgent)
+	if ua != "" {
+		for _, f := range subscribeFormats {
+			for _, keyword := range f.UserAgents {
+				if strings.Contains(ua, keyword) {
+					return f
+				}
+			}
+		}
+	}
+
+	return defaultSubscribeFormat
+}
@@ -0,0 +1,65 @@
+package protocol
+
+import "testing"
+
+func TestResolveSubscribeFormat(t *testing.T) {
+	cases := []struct {
+		format string
+		ua     string
+		want   string
+	}{
+		{"", "", "base64"},
+		{"", "v2rayNG/1.8.5", "v2rayn"},
+		{"", "v2rayN/6.23", "v2rayn"},
+		{"", "ClashforWindows/0.20.39", "clash"},
+		{"", "clash-verge/v1.3.8", "clashmeta"},
+		{"", "ClashMetaForAndroid/2.8.9.Meta", "clashmeta"},
+		{"", "mihomo/1.18.0", "clashmeta"},
+		{"", "Stash/2.4.7 Clash/1.9.0", "stash"},
+		{"", "Surge iOS/2920", "surge"},
+		{"", "Surfboard/2.20.1", "surfboard"},
+		{"", "Quantumult%20X/1.4.1", "quantumultx"},
+		{"", "Quantumult X/1.4.1", "quantumultx"},
+		{"", "Quantumult/1.0.20", "base64"},
+		{"", "Loon/3.1.5", "loon"},
+		{"", "Shadowrocket/2070", "shadowrocket"},
+		{"", "SFI/1.8.0 (sing-box 1.8.0)", "singbox"},
+		{"", "HiddifyNext/0.14.1", "singbox"},
+		{"surge", "ClashforWindows/0.20.39", "surge"},
+		{"Mihomo", "", "clashmeta"},
+		{"unknown", "Loon/3.1.5", "loon"},
+	}
+
+	for _, tc := range cases {
+		got := ResolveSubscribeFormat(tc.format, tc.ua)
+		if got.Name != tc.want {
+			t.Errorf("ResolveSubscribeFormat(%q, %q) = %s, want %s", tc.format, tc.ua, got.Name, tc.want)
+		}
+	}
+}
+
+func TestSubscribeFormatHeaders(t *testing.T) {
+	clash := GetSubscribeFormat("clashmeta").ResponseHeaders("Demo")
+	if clash["profile-update-interval"] != "24" || clash["profile-title"] != "Demo" || clash["content-disposition"] != "attachment; filename*=UTF-8''Demo.yaml" {
+		t.Errorf("clashmeta headers = %v", clash)
+	}
+
+	surge := GetSubscribeFormat("surge").ResponseHeaders("Demo")
+	if surge["content-disposition"] != "attachment; filename*=UTF-8''Demo.conf" {
+		t.Errorf("surge headers = %v", surge)
+	}
+	if _, ok := surge["profile-update-interval"]; ok {
+		t.Errorf("surge should not set profile-update-interval: %v", surge)
+	}
+
+	// 非 ASCII 站点名称按 RFC 5987 编码
+	loon := GetSubscribeFormat("loon").ResponseHeaders("我的 VPN")
+	if loon["content-disposition"] != "attachment; filename*=UTF-8''%E6%88%91%E7%9A%84%20VPN.conf" {
+		t.Errorf("loon headers = %v", loon)
+	}
+
+	// base64 链接类格式在浏览器中直接显示，不作为附件下载
+	if headers := GetSubscribeFormat("v2rayn").ResponseHeaders("Demo"); len(headers) != 0 {
+		t.Errorf("v2rayn headers = %v", headers)
+	}
+}
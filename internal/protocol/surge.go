@@ -7,45 +7,10 @@ import (
 	"dashgo/internal/model"
 )
 
-// GenerateSurgeConfig 生成 Surge 配置
+// GenerateSurgeConfig 使用内置模板生成 Surge 配置
 func GenerateSurgeConfig(servers []model.ServerInfo, user *model.User) string {
-	var sb strings.Builder
-
-	// General
-	sb.WriteString("[General]\n")
-	sb.WriteString("loglevel = notify\n")
-	sb.WriteString("dns-server = 223.5.5.5, 119.29.29.29\n")
-	sb.WriteString("skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, 100.64.0.0/10, localhost, *.local\n")
-	sb.WriteString("allow-wifi-access = false\n")
-	sb.WriteString("external-controller-access = password@0.0.0.0:6170\n")
-	sb.WriteString("\n")
-
-	// Proxy
-	sb.WriteString("[Proxy]\n")
-	sb.WriteString("DIRECT = direct\n")
-	proxyNames := []string{}
-
-	for _, server := range servers {
-		line := buildSurgeProxy(server, user)
-		if line != "" {
-			sb.WriteString(line + "\n")
-			proxyNames = append(proxyNames, server.Name)
-		}
-	}
-	sb.WriteString("\n")
-
-	// Proxy Group
-	sb.WriteString("[Proxy Group]\n")
-	sb.WriteString(fmt.Sprintf("Proxy = select, Auto, DIRECT, %s\n", strings.Join(proxyNames, ", ")))
-	sb.WriteString(fmt.Sprintf("Auto = url-test, %s, url=http://www.gstatic.com/generate_204, interval=300\n", strings.Join(proxyNames, ", ")))
-	sb.WriteString("\n")
-
-	// Rule
-	sb.WriteString("[Rule]\n")
-	sb.WriteString("GEOIP,CN,DIRECT\n")
-	sb.WriteString("FINAL,Proxy\n")
-
-	return sb.String()
+	config, _ := RenderSurgeConfig(DefaultTemplate("surge"), servers, user)
+	return config
 }
 
 func buildSurgeProxy(server model.ServerInfo, user *model.User) string {
@@ -263,8 +228,17 @@ func buildSurgeProxy(server model.ServerInfo, user *model.User) string {
 	return ""
 }
 
-// GenerateSurfboardConfig 生成 Surfboard 配置 (类似 Surge)
+// GenerateSurfboardConfig 使用内置模板生成 Surfboard 配置
 func GenerateSurfboardConfig(servers []model.ServerInfo, user *model.User) string {
-	// Surfboard 配置格式告Surge 类似
-	return GenerateSurgeConfig(servers, user)
+	config, _ := RenderSurfboardConfig(DefaultTemplate("surfboard"), servers, user)
+	return config
+}
+
+// buildSurfboardProxy Surfboard 仅支持 ss、vmess、trojan，节点行写法与 Surge 相同
+func buildSurfboardProxy(server model.ServerInfo, user *model.User) string {
+	switch server.Type {
+	case model.ServerTypeShadowsocks, model.ServerTypeVmess, model.ServerTypeTrojan:
+		return buildSurgeProxy(server, user)
+	}
+	return ""
 }
@@ -0,0 +1,270 @@
+package protocol
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"dashgo/internal/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed templates/*
+var defaultTemplates embed.FS
+
+// 支持模板的订阅格式及其内置模板文件
+var templateFiles = map[string]string{
+	"clash":     "templates/clash.yaml",
+	"clashmeta": "templates/clashmeta.yaml",
+	"singbox":   "templates/singbox.json",
+	"surge":     "templates/surge.conf",
+	"surfboard": "templates/surfboard.conf",
+}
+
+// TemplateData 订阅模板渲染数据
+type TemplateData struct {
+	User    *model.User        // 当前用户
+	Nodes   []model.ServerInfo // 成功生成的节点
+	Proxies []string           // 节点名称列表，与 Nodes 一一对应
+	Lines   []string           // 文本格式（Surge 等）的节点行
+}
+
+// TemplateNames 获取支持模板的格式名称
+func TemplateNames() []string {
+	return []string{"clash", "clashmeta", "singbox", "surge", "surfboard"}
+}
+
+// DefaultTemplate 获取内置模板内容
+func DefaultTemplate(name string) string {
+	file, ok := templateFiles[name]
+	if !ok {
+		return ""
+	}
+	data, _ := defaultTemplates.ReadFile(file)
+	return string(data)
+}
+
+func newTemplateData(user *model.User) *TemplateData {
+	return &TemplateData{
+		User:    user,
+		Nodes:   []model.ServerInfo{},
+		Proxies: []string{},
+		Lines:   []string{},
+	}
+}
+
+// RenderTemplate 渲染订阅模板
+func RenderTemplate(name, content string, data *TemplateData) ([]byte, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs(data)).Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// templateFuncs 模板函数
+//
+//	json v              输出 JSON（同时是合法的 YAML flow 写法）
+//	list a b ...        构造字符串列表
+//	concat l1 l2 ...    合并字符串列表
+//	join l sep          拼接字符串列表
+//	byTag tag           带指定标签的节点名称
+//	match pattern       名称匹配正则的节点名称
+func templateFuncs(data *TemplateData) template.FuncMap {
+	return template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(buf.String()), nil
+		},
+		"list": func(items ...string) []string {
+			return items
+		},
+		"concat": func(lists ...[]string) []string {
+			result := []string{}
+			for _, l := range lists {
+				result = append(result, l...)
+			}
+			return result
+		},
+		"join": strings.Join,
+		"byTag": func(tag string) []string {
+			result := []string{}
+			for _, node := range data.Nodes {
+				for _, t := range node.Tags {
+					if s, ok := t.(string); ok && s == tag {
+						result = append(result, node.Name)
+						break
+					}
+				}
+			}
+			return result
+		},
+		"match": func(pattern string) ([]string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			result := []string{}
+			for _, name := range data.Proxies {
+				if re.MatchString(name) {
+					result = append(result, name)
+				}
+			}
+			return result, nil
+		},
+	}
+}
+
+// RenderClashConfig 使用模板生成 Clash 配置
+func RenderClashConfig(content string, servers []model.ServerInfo, user *model.User) (string, error) {
+	return renderClashTemplate("clash", content, servers, user, buildClashProxy)
+}
+
+// RenderClashMetaConfig 使用模板生成 Clash Meta (mihomo) 配置
+func RenderClashMetaConfig(content string, servers []model.ServerInfo, user *model.User) (string, error) {
+	return renderClashTemplate("clashmeta", content, servers, user, buildClashMetaProxy)
+}
+
+func renderClashTemplate(name, content string, servers []model.ServerInfo, user *model.User,
+	build func(model.ServerInfo, *model.User) map[string]interface{}) (string, error) {
+	data := newTemplateData(user)
+	proxies := []map[string]interface{}{}
+	for _, server := range servers {
+		proxy := build(server, user)
+		if proxy != nil {
+			proxies = append(proxies, proxy)
+			data.Nodes = append(data.Nodes, server)
+			data.Proxies = append(data.Proxies, server.Name)
+		}
+	}
+
+	out, err := RenderTemplate(name, content, data)
+	if err != nil {
+		return "", err
+	}
+
+	// 解析为 yaml.Node 以保留模板中的字段顺序，再写入 proxies
+	var doc yaml.Node
+	if err := yaml.Unmarshal(out, &doc); err != nil {
+		return "", fmt.Errorf("invalid yaml: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", errors.New("template must render a yaml mapping")
+	}
+
+	var proxiesNode yaml.Node
+	if err := proxiesNode.Encode(proxies); err != nil {
+		return "", err
+	}
+
+	root := doc.Content[0]
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "proxies" {
+			root.Content[i+1] = &proxiesNode
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "proxies"}, &proxiesNode)
+	}
+
+	clearFlowStyle(&doc)
+	result, err := yaml.Marshal(&doc)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// clearFlowStyle 将模板中 json 输出的 flow 写法统一为 block 写法
+func clearFlowStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle
+	for _, child := range node.Content {
+		clearFlowStyle(child)
+	}
+}
+
+// RenderSingBoxConfig 使用模板生成 sing-box 配置
+func RenderSingBoxConfig(content string, servers []model.ServerInfo, user *model.User) (map[string]interface{}, error) {
+	data := newTemplateData(user)
+	outbounds := []interface{}{}
+	endpoints := []interface{}{}
+	for _, server := range servers {
+		outbound := buildSingBoxOutbound(server, user)
+		if outbound != nil {
+			// WireGuard 在 sing-box 中为 endpoint，但同样可作为出站被引用
+			if outbound["type"] == "wireguard" {
+				endpoints = append(endpoints, outbound)
+			} else {
+				outbounds = append(outbounds, outbound)
+			}
+			data.Nodes = append(data.Nodes, server)
+			data.Proxies = append(data.Proxies, server.Name)
+		}
+	}
+
+	out, err := RenderTemplate("singbox", content, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	existing, _ := config["outbounds"].([]interface{})
+	config["outbounds"] = append(existing, outbounds...)
+	if len(endpoints) > 0 {
+		existingEndpoints, _ := config["endpoints"].([]interface{})
+		config["endpoints"] = append(existingEndpoints, endpoints...)
+	}
+	return config, nil
+}
+
+// RenderSurgeConfig 使用模板生成 Surge 配置
+func RenderSurgeConfig(content string, servers []model.ServerInfo, user *model.User) (string, error) {
+	return renderLineConfig("surge", content, servers, user, buildSurgeProxy)
+}
+
+// RenderSurfboardConfig 使用模板生成 Surfboard 配置
+func RenderSurfboardConfig(content string, servers []model.ServerInfo, user *model.User) (string, error) {
+	return renderLineConfig("surfboard", content, servers, user, buildSurfboardProxy)
+}
+
+// renderLineConfig 渲染以节点行描述代理的文本配置
+func renderLineConfig(name, content string, servers []model.ServerInfo, user *model.User, build func(model.ServerInfo, *model.User) string) (string, error) {
+	data := newTemplateData(user)
+	for _, server := range servers {
+		line := build(server, user)
+		if line != "" {
+			data.Nodes = append(data.Nodes, server)
+			data.Proxies = append(data.Proxies, server.Name)
+			data.Lines = append(data.Lines, line)
+		}
+	}
+
+	out, err := RenderTemplate(name, content, data)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
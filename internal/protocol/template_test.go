@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"dashgo/internal/model"
+)
+
+func testServers() []model.ServerInfo {
+	return []model.ServerInfo{
+		{Server: model.Server{Name: "HK 01", Type: model.ServerTypeTrojan, Host: "hk.example.com", Port: "443", Tags: model.JSONArray{"HK"}}},
+		{Server: model.Server{Name: "JP 01", Type: model.ServerTypeVmess, Host: "jp.example.com", Port: "443"}},
+	}
+}
+
+func TestDefaultTemplatesRender(t *testing.T) {
+	user := &model.User{UUID: "8f6c7a0e-4b1d-4c2e-9a3f-0d1e2f3a4b5c"}
+	servers := testServers()
+
+	clash, err := RenderClashConfig(DefaultTemplate("clash"), servers, user)
+	if err != nil {
+		t.Fatalf("clash: %v", err)
+	}
+	if !strings.Contains(clash, "hk.example.com") || !strings.Contains(clash, "proxy-groups") {
+		t.Errorf("clash output missing proxies or groups:\n%s", clash)
+	}
+
+	if _, err := RenderClashMetaConfig(DefaultTemplate("clashmeta"), servers, user); err != nil {
+		t.Fatalf("clashmeta: %v", err)
+	}
+
+	singbox, err := RenderSingBoxConfig(DefaultTemplate("singbox"), servers, user)
+	if err != nil {
+		t.Fatalf("singbox: %v", err)
+	}
+	outbounds, _ := singbox["outbounds"].([]interface{})
+	last, _ := outbounds[len(outbounds)-1].(map[string]interface{})
+	if last["tag"] != "JP 01" {
+		t.Errorf("singbox outbounds not appended, last = %v", last)
+	}
+
+	surge, err := RenderSurgeConfig(DefaultTemplate("surge"), servers, user)
+	if err != nil {
+		t.Fatalf("surge: %v", err)
+	}
+	if !strings.Contains(surge, "Proxy = select, Auto, DIRECT, HK 01, JP 01") {
+		t.Errorf("surge proxy group not rendered:\n%s", surge)
+	}
+
+	// Surfboard 使用独立模板，不支持的协议不输出
+	surfboardServers := append(testServers(), model.ServerInfo{Server: model.Server{Name: "US 01", Type: model.ServerTypeTuic, Host: "us.example.com", Port: "443"}})
+	surfboard, err := RenderSurfboardConfig(DefaultTemplate("surfboard"), surfboardServers, user)
+	if err != nil {
+		t.Fatalf("surfboard: %v", err)
+	}
+	if !strings.Contains(surfboard, "proxy-test-url") || strings.Contains(surfboard, "external-controller-access") {
+		t.Errorf("surfboard rendered with surge template:\n%s", surfboard)
+	}
+	if strings.Contains(surfboard, "US 01") || !strings.Contains(surfboard, "HK 01 = trojan") {
+		t.Errorf("surfboard proxies:\n%s", surfboard)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	user := &model.User{UUID: "8f6c7a0e-4b1d-4c2e-9a3f-0d1e2f3a4b5c"}
+	tpl := `proxy-groups:
+  - name: HK
+    type: select
+    proxies: {{ json (byTag "HK") }}
+  - name: JP
+    type: select
+    proxies: {{ json (match "^JP") }}
+`
+	out, err := RenderClashConfig(tpl, testServers(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `- "HK 01"`) || !strings.Contains(out, `- "JP 01"`) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	if _, err := RenderClashConfig("{{ .Missing", testServers(), user); err == nil {
+		t.Error("expected parse error")
+	}
+}
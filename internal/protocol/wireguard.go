@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"dashgo/internal/model"
+)
+
+// wireGuardMTU 获取节点 MTU，默认 1420
+func wireGuardMTU(ps model.JSONMap) int {
+	if mtu, ok := ps["mtu"].(float64); ok && mtu > 0 {
+		return int(mtu)
+	}
+	return 1420
+}
+
+// wireGuardServerKey 获取服务端公钥
+func wireGuardServerKey(server model.ServerInfo) string {
+	key, _ := server.ProtocolSettings["public_key"].(string)
+	return key
+}
+
+func buildClashWireGuard(server model.ServerInfo, user *model.User) map[string]interface{} {
+	peer := server.WireGuard
+	publicKey := wireGuardServerKey(server)
+	if peer == nil || publicKey == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"name":        server.Name,
+		"type":        "wireguard",
+		"server":      server.Host,
+		"port":        parsePort(server.Port),
+		"ip":          peer.IP,
+		"private-key": peer.PrivateKey,
+		"public-key":  publicKey,
+		"allowed-ips": []string{"0.0.0.0/0"},
+		"mtu":         wireGuardMTU(server.ProtocolSettings),
+		"udp":         true,
+	}
+}
+
+// sing-box 1.11+ 中 WireGuard 为 endpoint，由 RenderSingBoxConfig 移入 endpoints
+func buildSingBoxWireGuard(server model.ServerInfo, user *model.User) map[string]interface{} {
+	peer := server.WireGuard
+	publicKey := wireGuardServerKey(server)
+	if peer == nil || publicKey == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"type":        "wireguard",
+		"tag":         server.Name,
+		"mtu":         wireGuardMTU(server.ProtocolSettings),
+		"address":     []string{peer.IP + "/32"},
+		"private_key": peer.PrivateKey,
+		"peers": []map[string]interface{}{
+			{
+				"address":     server.Host,
+				"port":        parsePort(server.Port),
+				"public_key":  publicKey,
+				"allowed_ips": []string{"0.0.0.0/0"},
+			},
+		},
+	}
+}
+
+// wireguard://privatekey@host:port?publickey=xxx&address=10.66.0.2/32&mtu=1420#name
+func generateWireGuardLink(server model.ServerInfo, user *model.User) string {
+	peer := server.WireGuard
+	publicKey := wireGuardServerKey(server)
+	if peer == nil || publicKey == "" {
+		return ""
+	}
+	params := url.Values{}
+	params.Set("publickey", publicKey)
+	params.Set("address", peer.IP+"/32")
+	params.Set("mtu", fmt.Sprintf("%d", wireGuardMTU(server.ProtocolSettings)))
+	return fmt.Sprintf("wireguard://%s@%s:%s?%s#%s",
+		url.QueryEscape(peer.PrivateKey), server.Host, server.Port, params.Encode(), url.QueryEscape(server.Name))
+}
+
+// GenerateWireGuardConf 生成标准 WireGuard 客户端配置文件
+func GenerateWireGuardConf(server model.ServerInfo, user *model.User) string {
+	peer := server.WireGuard
+	publicKey := wireGuardServerKey(server)
+	if peer == nil || publicKey == "" {
+		return ""
+	}
+
+	dns := "1.1.1.1"
+	if d, ok := server.ProtocolSettings["dns"].(string); ok && d != "" {
+		dns = d
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[Interface]\n")
+	sb.WriteString(fmt.Sprintf("PrivateKey = %s\n", peer.PrivateKey))
+	sb.WriteString(fmt.Sprintf("Address = %s/32\n", peer.IP))
+	sb.WriteString(fmt.Sprintf("DNS = %s\n", dns))
+	sb.WriteString(fmt.Sprintf("MTU = %d\n", wireGuardMTU(server.ProtocolSettings)))
+	sb.WriteString("\n[Peer]\n")
+	sb.WriteString(fmt.Sprintf("PublicKey = %s\n", publicKey))
+	sb.WriteString("AllowedIPs = 0.0.0.0/0\n")
+	sb.WriteString(fmt.Sprintf("Endpoint = %s:%s\n", server.Host, server.Port))
+	sb.WriteString("PersistentKeepalive = 25\n")
+	return sb.String()
+}
@@ -4,6 +4,7 @@ import (
 	"dashgo/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CouponRepository struct {
@@ -67,6 +68,123 @@ func (r *CouponRepository) RecordUsage(couponID, orderID, userID int64) error {
 	return r.db.Model(&model.Order{}).Where("id = ?", orderID).Update("coupon_id", couponID).Error
 }
 
+// RedeemCodeRepository 兑换码仓库
+type RedeemCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRedeemCodeRepository(db *gorm.DB) *RedeemCodeRepository {
+	return &RedeemCodeRepository{db: db}
+}
+
+// WithTx 返回在事务中执行的仓库
+func (r *RedeemCodeRepository) WithTx(tx *gorm.DB) *RedeemCodeRepository {
+	return &RedeemCodeRepository{db: tx}
+}
+
+// Transaction 在事务中执行
+func (r *RedeemCodeRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+func (r *RedeemCodeRepository) Create(code *model.RedeemCode) error {
+	return r.db.Create(code).Error
+}
+
+func (r *RedeemCodeRepository) Update(code *model.RedeemCode) error {
+	return r.db.Save(code).Error
+}
+
+func (r *RedeemCodeRepository) Delete(id int64) error {
+	return r.db.Delete(&model.RedeemCode{}, id).Error
+}
+
+func (r *RedeemCodeRepository) FindByID(id int64) (*model.RedeemCode, error) {
+	var code model.RedeemCode
+	err := r.db.First(&code, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r *RedeemCodeRepository) FindByCode(code string) (*model.RedeemCode, error) {
+	var redeemCode model.RedeemCode
+	err := r.db.Where("code = ?", code).First(&redeemCode).Error
+	if err != nil {
+		return nil, err
+	}
+	return &redeemCode, nil
+}
+
+func (r *RedeemCodeRepository) FindByBatchNo(batchNo string) ([]model.RedeemCode, error) {
+	var codes []model.RedeemCode
+	err := r.db.Where("batch_no = ?", batchNo).Order("id ASC").Find(&codes).Error
+	return codes, err
+}
+
+// List 分页获取兑换码，batchNo 不为空时按批次筛选
+func (r *RedeemCodeRepository) List(batchNo string, page, pageSize int) ([]model.RedeemCode, int64, error) {
+	var codes []model.RedeemCode
+	var total int64
+	query := r.db.Model(&model.RedeemCode{})
+	if batchNo != "" {
+		query = query.Where("batch_no = ?", batchNo)
+	}
+	query.Count(&total)
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&codes).Error
+	return codes, total, err
+}
+
+// IncrementUsed 占用一次使用次数，已达总次数上限时返回 false
+func (r *RedeemCodeRepository) IncrementUsed(id int64) (bool, error) {
+	result := r.db.Model(&model.RedeemCode{}).
+		Where("id = ?", id).
+		Where("(limit_use IS NULL OR limit_use = 0 OR used_count < limit_use)").
+		UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// RedeemLogRepository 兑换记录仓库
+type RedeemLogRepository struct {
+	db *gorm.DB
+}
+
+func NewRedeemLogRepository(db *gorm.DB) *RedeemLogRepository {
+	return &RedeemLogRepository{db: db}
+}
+
+// WithTx 返回在事务中执行的仓库
+func (r *RedeemLogRepository) WithTx(tx *gorm.DB) *RedeemLogRepository {
+	return &RedeemLogRepository{db: tx}
+}
+
+func (r *RedeemLogRepository) Create(log *model.RedeemLog) error {
+	return r.db.Create(log).Error
+}
+
+func (r *RedeemLogRepository) CountByUser(codeID, userID int64) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.RedeemLog{}).Where("code_id = ? AND user_id = ?", codeID, userID).Count(&count).Error
+	return count, err
+}
+
+// List 分页获取兑换记录，codeID、userID 为 0 时不筛选
+func (r *RedeemLogRepository) List(codeID, userID int64, page, pageSize int) ([]model.RedeemLog, int64, error) {
+	var logs []model.RedeemLog
+	var total int64
+	query := r.db.Model(&model.RedeemLog{})
+	if codeID > 0 {
+		query = query.Where("code_id = ?", codeID)
+	}
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	query.Count(&total)
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error
+	return logs, total, err
+}
+
 // InviteCodeRepository 邀请码仓库
 type InviteCodeRepository struct {
 	db *gorm.DB
@@ -121,6 +239,11 @@ func NewCommissionLogRepository(db *gorm.DB) *CommissionLogRepository {
 	return &CommissionLogRepository{db: db}
 }
 
+// WithTx 返回在事务中执行的仓库
+func (r *CommissionLogRepository) WithTx(tx *gorm.DB) *CommissionLogRepository {
+	return &CommissionLogRepository{db: tx}
+}
+
 func (r *CommissionLogRepository) Create(log *model.CommissionLog) error {
 	return r.db.Create(log).Error
 }
@@ -139,6 +262,30 @@ func (r *CommissionLogRepository) FindByInviteUserID(userID int64, page, pageSiz
 	return logs, total, err
 }
 
+// FindByTradeNo 获取订单相关的佣金记录（含追回记录）
+func (r *CommissionLogRepository) FindByTradeNo(tradeNo string) ([]model.CommissionLog, error) {
+	var logs []model.CommissionLog
+	err := r.db.Where("trade_no = ?", tradeNo).Order("id ASC").Find(&logs).Error
+	return logs, err
+}
+
+// UpdateStatusByTradeNo 更新订单指定状态的佣金记录
+func (r *CommissionLogRepository) UpdateStatusByTradeNo(tradeNo string, from, to int) error {
+	return r.db.Model(&model.CommissionLog{}).
+		Where("trade_no = ? AND status = ?", tradeNo, from).
+		Update("status", to).Error
+}
+
+// SumByStatus 汇总邀请人指定状态的佣金
+func (r *CommissionLogRepository) SumByStatus(userID int64, status int) (int64, error) {
+	var sum int64
+	err := r.db.Model(&model.CommissionLog{}).
+		Where("invite_user_id = ? AND status = ?", userID, status).
+		Select("COALESCE(SUM(get_amount), 0)").
+		Scan(&sum).Error
+	return sum, err
+}
+
 func (r *CommissionLogRepository) SumByInviteUserID(userID int64) (int64, error) {
 	var sum int64
 	err := r.db.Model(&model.CommissionLog{}).
@@ -148,6 +295,97 @@ func (r *CommissionLogRepository) SumByInviteUserID(userID int64) (int64, error)
 	return sum, err
 }
 
+// SumByTier 按邀请层级汇总邀请人的佣金（不含已作废）
+func (r *CommissionLogRepository) SumByTier(userID int64) (map[int]int64, error) {
+	var rows []struct {
+		Tier  int
+		Total int64
+	}
+	err := r.db.Model(&model.CommissionLog{}).
+		Where("invite_user_id = ? AND status <> ?", userID, model.CommissionStatusCancelled).
+		Select("tier, COALESCE(SUM(get_amount), 0) AS total").
+		Group("tier").
+		Scan(&rows).Error
+	sums := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		sums[row.Tier] = row.Total
+	}
+	return sums, err
+}
+
+// CommissionWithdrawRepository 佣金提现申请仓库
+type CommissionWithdrawRepository struct {
+	db *gorm.DB
+}
+
+func NewCommissionWithdrawRepository(db *gorm.DB) *CommissionWithdrawRepository {
+	return &CommissionWithdrawRepository{db: db}
+}
+
+// WithTx 返回在事务中执行的仓库
+func (r *CommissionWithdrawRepository) WithTx(tx *gorm.DB) *CommissionWithdrawRepository {
+	return &CommissionWithdrawRepository{db: tx}
+}
+
+// Transaction 在事务中执行
+func (r *CommissionWithdrawRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+func (r *CommissionWithdrawRepository) Create(withdraw *model.CommissionWithdraw) error {
+	return r.db.Create(withdraw).Error
+}
+
+func (r *CommissionWithdrawRepository) Update(withdraw *model.CommissionWithdraw) error {
+	return r.db.Save(withdraw).Error
+}
+
+func (r *CommissionWithdrawRepository) FindByID(id int64) (*model.CommissionWithdraw, error) {
+	var withdraw model.CommissionWithdraw
+	err := r.db.First(&withdraw, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &withdraw, nil
+}
+
+// FindByIDForUpdate 在事务中加锁读取提现申请
+func (r *CommissionWithdrawRepository) FindByIDForUpdate(id int64) (*model.CommissionWithdraw, error) {
+	var withdraw model.CommissionWithdraw
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&withdraw, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &withdraw, nil
+}
+
+// List 分页获取提现申请，userID 为 0、status 为 nil 时不过滤
+func (r *CommissionWithdrawRepository) List(userID int64, status *int, page, pageSize int) ([]model.CommissionWithdraw, int64, error) {
+	var withdraws []model.CommissionWithdraw
+	var total int64
+	query := r.db.Model(&model.CommissionWithdraw{})
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	query.Count(&total)
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&withdraws).Error
+	return withdraws, total, err
+}
+
+func (r *CommissionWithdrawRepository) CreateLog(log *model.CommissionWithdrawLog) error {
+	return r.db.Create(log).Error
+}
+
+// FindLogs 获取提现申请的审计记录
+func (r *CommissionWithdrawRepository) FindLogs(withdrawID int64) ([]model.CommissionWithdrawLog, error) {
+	var logs []model.CommissionWithdrawLog
+	err := r.db.Where("withdraw_id = ?", withdrawID).Order("id ASC").Find(&logs).Error
+	return logs, err
+}
+
 // NoticeRepository 公告仓库
 type NoticeRepository struct {
 	db *gorm.DB
@@ -96,3 +96,47 @@ func (r *ServerNodeRepository) GetAll() ([]model.ServerNode, error) {
 	err := r.db.Order("created_at DESC").Find(&nodes).Error
 	return nodes, err
 }
+
+type WireGuardPeerRepository struct {
+	db *gorm.DB
+}
+
+func NewWireGuardPeerRepository(db *gorm.DB) *WireGuardPeerRepository {
+	return &WireGuardPeerRepository{db: db}
+}
+
+func (r *WireGuardPeerRepository) Create(peer *model.WireGuardPeer) error {
+	return r.db.Create(peer).Error
+}
+
+func (r *WireGuardPeerRepository) Update(peer *model.WireGuardPeer) error {
+	return r.db.Save(peer).Error
+}
+
+func (r *WireGuardPeerRepository) DeleteByUserID(userID int64) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.WireGuardPeer{}).Error
+}
+
+func (r *WireGuardPeerRepository) FindByUserID(userID int64) (*model.WireGuardPeer, error) {
+	var peer model.WireGuardPeer
+	err := r.db.Where("user_id = ?", userID).First(&peer).Error
+	if err != nil {
+		return nil, err
+	}
+	return &peer, nil
+}
+
+func (r *WireGuardPeerRepository) FindByUserIDs(userIDs []int64) ([]model.WireGuardPeer, error) {
+	var peers []model.WireGuardPeer
+	if len(userIDs) == 0 {
+		return peers, nil
+	}
+	err := r.db.Where("user_id IN ?", userIDs).Find(&peers).Error
+	return peers, err
+}
+
+func (r *WireGuardPeerRepository) GetAllIPs() ([]string, error) {
+	var ips []string
+	err := r.db.Model(&model.WireGuardPeer{}).Pluck("ip", &ips).Error
+	return ips, err
+}
@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"math"
+
 	"dashgo/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepository struct {
@@ -44,12 +47,58 @@ func (r *OrderRepository) FindByTradeNo(tradeNo string) (*model.Order, error) {
 	return &order, nil
 }
 
+// WithTx 返回在事务中执行的仓库
+func (r *OrderRepository) WithTx(tx *gorm.DB) *OrderRepository {
+	return &OrderRepository{db: tx}
+}
+
+// Transaction 在事务中执行
+func (r *OrderRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// FindByTradeNoForUpdate 在事务中加锁读取订单
+// MySQL 使用 SELECT ... FOR UPDATE；SQLite 不支持行锁，先对该行执行一次空更新以获取数据库写锁
+func (r *OrderRepository) FindByTradeNoForUpdate(tradeNo string) (*model.Order, error) {
+	if r.db.Dialector.Name() == "sqlite" {
+		if err := r.db.Model(&model.Order{}).Where("trade_no = ?", tradeNo).
+			UpdateColumn("trade_no", gorm.Expr("trade_no")).Error; err != nil {
+			return nil, err
+		}
+	}
+	var order model.Order
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("trade_no = ?", tradeNo).First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 func (r *OrderRepository) FindByUserID(userID int64) ([]model.Order, error) {
 	var orders []model.Order
 	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&orders).Error
 	return orders, err
 }
 
+// FindCompletedByUserID 获取用户已完成（未被折抵）的订单
+func (r *OrderRepository) FindCompletedByUserID(userID int64) ([]model.Order, error) {
+	var orders []model.Order
+	err := r.db.Where("user_id = ? AND status = ?", userID, model.OrderStatusCompleted).Order("id ASC").Find(&orders).Error
+	return orders, err
+}
+
+// FindLastCompletedByPlan 获取用户该套餐最近一笔已完成的周期订单（不含流量重置）
+func (r *OrderRepository) FindLastCompletedByPlan(userID, planID int64) (*model.Order, error) {
+	var order model.Order
+	err := r.db.Where("user_id = ? AND plan_id = ? AND status = ? AND type <> ?",
+		userID, planID, model.OrderStatusCompleted, model.OrderTypeResetTraffic).
+		Order("id DESC").First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 func (r *OrderRepository) FindPendingByUserID(userID int64) ([]model.Order, error) {
 	var orders []model.Order
 	err := r.db.Where("user_id = ? AND status = ?", userID, model.OrderStatusPending).Find(&orders).Error
@@ -81,22 +130,65 @@ func (r *OrderRepository) Count() (int64, error) {
 	return count, err
 }
 
+// AddRefund 累加订单退款金额，超出实付金额时不更新并返回 false
+func (r *OrderRepository) AddRefund(orderID, amount int64) (bool, error) {
+	result := r.db.Model(&model.Order{}).
+		Where("id = ? AND COALESCE(refund_amount, 0) + ? <= total_amount", orderID, amount).
+		Update("refund_amount", gorm.Expr("COALESCE(refund_amount, 0) + ?", amount))
+	return result.RowsAffected > 0, result.Error
+}
+
+// 已支付的订单状态，已折抵的订单同样计入收入统计
+var paidOrderStatuses = []int{model.OrderStatusCompleted, model.OrderStatusDiscounted}
+
+// FindCommissionDue 获取持有期已满、佣金待确认的订单
+func (r *OrderRepository) FindCommissionDue(paidBefore int64, limit int) ([]model.Order, error) {
+	var orders []model.Order
+	err := r.db.Where("commission_status = ? AND commission_balance > 0", model.CommissionStatusPending).
+		Where("paid_at IS NOT NULL AND paid_at <= ?", paidBefore).
+		Order("id ASC").Limit(limit).Find(&orders).Error
+	return orders, err
+}
+
+// UpdateCommission 更新订单佣金状态与实际发放金额
+func (r *OrderRepository) UpdateCommission(id int64, status int, actual int64) error {
+	return r.db.Model(&model.Order{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"commission_status":         status,
+		"actual_commission_balance": actual,
+	}).Error
+}
+
+// CountPaidByUser 统计用户已支付的订单数（不含零元订单），excludeID 对应的订单不计入
+func (r *OrderRepository) CountPaidByUser(userID, excludeID int64) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Order{}).
+		Where("user_id = ? AND id <> ?", userID, excludeID).
+		Where("status IN ? AND total_amount > 0", paidOrderStatuses).
+		Count(&count).Error
+	return count, err
+}
+
+// sumRevenue 统计实收金额（扣除退款），外币订单按下单汇率折算为基础币种
+func sumRevenue(query *gorm.DB) int64 {
+	var total float64
+	query.Select("COALESCE(SUM((total_amount - COALESCE(refund_amount, 0)) / COALESCE(NULLIF(currency_rate, 0), 1)), 0)").
+		Scan(&total)
+	return int64(math.Round(total))
+}
+
 // GetTodayStats 获取今日订单统计
 func (r *OrderRepository) GetTodayStats() (int64, int64, error) {
 	var count int64
-	var total int64
 
 	today := getCurrentTimestamp() - (getCurrentTimestamp() % 86400)
 	r.db.Model(&model.Order{}).
 		Where("created_at >= ?", today).
-		Where("status = ?", model.OrderStatusCompleted).
+		Where("status IN ?", paidOrderStatuses).
 		Count(&count)
 
-	r.db.Model(&model.Order{}).
+	total := sumRevenue(r.db.Model(&model.Order{}).
 		Where("created_at >= ?", today).
-		Where("status = ?", model.OrderStatusCompleted).
-		Select("COALESCE(SUM(total_amount), 0)").
-		Scan(&total)
+		Where("status IN ?", paidOrderStatuses))
 
 	return count, total, nil
 }
@@ -104,7 +196,6 @@ func (r *OrderRepository) GetTodayStats() (int64, int64, error) {
 // GetMonthStats 获取本月订单统计
 func (r *OrderRepository) GetMonthStats() (int64, int64, error) {
 	var count int64
-	var total int64
 
 	// 本月第一天
 	now := getCurrentTimestamp()
@@ -112,14 +203,12 @@ func (r *OrderRepository) GetMonthStats() (int64, int64, error) {
 
 	r.db.Model(&model.Order{}).
 		Where("created_at >= ?", monthStart).
-		Where("status = ?", model.OrderStatusCompleted).
+		Where("status IN ?", paidOrderStatuses).
 		Count(&count)
 
-	r.db.Model(&model.Order{}).
+	total := sumRevenue(r.db.Model(&model.Order{}).
 		Where("created_at >= ?", monthStart).
-		Where("status = ?", model.OrderStatusCompleted).
-		Select("COALESCE(SUM(total_amount), 0)").
-		Scan(&total)
+		Where("status IN ?", paidOrderStatuses))
 
 	return count, total, nil
 }
@@ -172,33 +261,179 @@ func (r *PaymentRepository) GetEnabled() ([]model.Payment, error) {
 	return payments, err
 }
 
-// CancelExpiredOrders 取消过期订单
+func (r *PaymentRepository) GetAll() ([]model.Payment, error) {
+	var payments []model.Payment
+	err := r.db.Order("sort ASC").Find(&payments).Error
+	return payments, err
+}
+
+func (r *PaymentRepository) Create(payment *model.Payment) error {
+	return r.db.Create(payment).Error
+}
+
+func (r *PaymentRepository) Update(payment *model.Payment) error {
+	return r.db.Save(payment).Error
+}
+
+func (r *PaymentRepository) Delete(id int64) error {
+	return r.db.Delete(&model.Payment{}, id).Error
+}
+
+// CancelExpiredOrders 取消过期订单，使用了余额抵扣的订单需退回余额，不在此处取消
 func (r *OrderRepository) CancelExpiredOrders(expireSeconds int64) (int64, error) {
 	threshold := getCurrentTimestamp() - expireSeconds
 	result := r.db.Model(&model.Order{}).
 		Where("status = ?", model.OrderStatusPending).
 		Where("created_at < ?", threshold).
+		Where("COALESCE(balance_amount, 0) = 0").
 		Update("status", model.OrderStatusCancelled)
 	return result.RowsAffected, result.Error
 }
 
+// FindExpiredWithBalance 查询使用了余额抵扣的过期待支付订单
+func (r *OrderRepository) FindExpiredWithBalance(expireSeconds int64) ([]model.Order, error) {
+	var orders []model.Order
+	threshold := getCurrentTimestamp() - expireSeconds
+	err := r.db.Where("status = ?", model.OrderStatusPending).
+		Where("created_at < ?", threshold).
+		Where("balance_amount > 0").
+		Find(&orders).Error
+	return orders, err
+}
+
 // GetDailyStats 获取指定日期的订单统计
 func (r *OrderRepository) GetDailyStats(startTime, endTime int64) (int64, int64, error) {
 	var count int64
-	var total int64
 
 	r.db.Model(&model.Order{}).
 		Where("created_at >= ?", startTime).
 		Where("created_at < ?", endTime).
-		Where("status = ?", model.OrderStatusCompleted).
+		Where("status IN ?", paidOrderStatuses).
 		Count(&count)
 
-	r.db.Model(&model.Order{}).
+	total := sumRevenue(r.db.Model(&model.Order{}).
 		Where("created_at >= ?", startTime).
 		Where("created_at < ?", endTime).
-		Where("status = ?", model.OrderStatusCompleted).
-		Select("COALESCE(SUM(total_amount), 0)").
-		Scan(&total)
+		Where("status IN ?", paidOrderStatuses))
 
 	return count, total, nil
 }
+
+// OrderRefundRepository 退款记录仓库
+type OrderRefundRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderRefundRepository(db *gorm.DB) *OrderRefundRepository {
+	return &OrderRefundRepository{db: db}
+}
+
+// WithTx 返回在事务中执行的仓库
+func (r *OrderRefundRepository) WithTx(tx *gorm.DB) *OrderRefundRepository {
+	return &OrderRefundRepository{db: tx}
+}
+
+func (r *OrderRefundRepository) Create(refund *model.OrderRefund) error {
+	return r.db.Create(refund).Error
+}
+
+func (r *OrderRefundRepository) FindByOrderID(orderID int64) ([]model.OrderRefund, error) {
+	var refunds []model.OrderRefund
+	err := r.db.Where("order_id = ?", orderID).Order("id ASC").Find(&refunds).Error
+	return refunds, err
+}
+
+func (r *OrderRefundRepository) List(page, pageSize int) ([]model.OrderRefund, int64, error) {
+	var refunds []model.OrderRefund
+	var total int64
+	r.db.Model(&model.OrderRefund{}).Count(&total)
+	err := r.db.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&refunds).Error
+	return refunds, total, err
+}
+
+// PaymentCallbackRepository 支付回调日志仓库
+type PaymentCallbackRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentCallbackRepository(db *gorm.DB) *PaymentCallbackRepository {
+	return &PaymentCallbackRepository{db: db}
+}
+
+func (r *PaymentCallbackRepository) Create(callback *model.PaymentCallback) error {
+	return r.db.Create(callback).Error
+}
+
+func (r *PaymentCallbackRepository) Update(callback *model.PaymentCallback) error {
+	return r.db.Save(callback).Error
+}
+
+func (r *PaymentCallbackRepository) FindByID(id int64) (*model.PaymentCallback, error) {
+	var callback model.PaymentCallback
+	err := r.db.First(&callback, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &callback, nil
+}
+
+// ExistsCompleted 网关交易号是否已有成功处理的回调
+func (r *PaymentCallbackRepository) ExistsCompleted(paymentID int64, callbackNo string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.PaymentCallback{}).
+		Where("payment_id = ? AND callback_no = ? AND outcome = ?", paymentID, callbackNo, model.CallbackOutcomeCompleted).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// List 分页获取回调日志，tradeNo 不为空时按订单号筛选
+func (r *PaymentCallbackRepository) List(tradeNo string, page, pageSize int) ([]model.PaymentCallback, int64, error) {
+	var callbacks []model.PaymentCallback
+	var total int64
+	query := r.db.Model(&model.PaymentCallback{})
+	if tradeNo != "" {
+		query = query.Where("trade_no = ?", tradeNo)
+	}
+	query.Count(&total)
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&callbacks).Error
+	return callbacks, total, err
+}
+
+// RenewalAttemptRepository 自动续费记录仓库
+type RenewalAttemptRepository struct {
+	db *gorm.DB
+}
+
+func NewRenewalAttemptRepository(db *gorm.DB) *RenewalAttemptRepository {
+	return &RenewalAttemptRepository{db: db}
+}
+
+func (r *RenewalAttemptRepository) Create(attempt *model.RenewalAttempt) error {
+	return r.db.Create(attempt).Error
+}
+
+// FindLatest 获取用户针对某一到期时间的最近一次续费尝试
+func (r *RenewalAttemptRepository) FindLatest(userID, expiredAt int64) (*model.RenewalAttempt, error) {
+	var attempt model.RenewalAttempt
+	err := r.db.Where("user_id = ? AND expired_at = ?", userID, expiredAt).Order("id DESC").First(&attempt).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// List 分页获取续费记录，userID 为 0 时不筛选
+func (r *RenewalAttemptRepository) List(userID int64, page, pageSize int) ([]model.RenewalAttempt, int64, error) {
+	var attempts []model.RenewalAttempt
+	var total int64
+	query := r.db.Model(&model.RenewalAttempt{})
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	query.Count(&total)
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&attempts).Error
+	return attempts, total, err
+}
@@ -4,6 +4,7 @@ import (
 	"dashgo/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PlanRepository struct {
@@ -14,6 +15,25 @@ func NewPlanRepository(db *gorm.DB) *PlanRepository {
 	return &PlanRepository{db: db}
 }
 
+// WithTx 返回在事务中执行的仓库
+func (r *PlanRepository) WithTx(tx *gorm.DB) *PlanRepository {
+	return &PlanRepository{db: tx}
+}
+
+// Transaction 在事务中执行
+func (r *PlanRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// FindByIDForUpdate 在事务中加锁读取套餐（SQLite 下忽略行锁）
+func (r *PlanRepository) FindByIDForUpdate(id int64) (*model.Plan, error) {
+	var plan model.Plan
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&plan, id).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
 func (r *PlanRepository) Create(plan *model.Plan) error {
 	return r.db.Create(plan).Error
 }
@@ -67,3 +87,197 @@ func (r *PlanRepository) DecrementSoldCount(planID int64) error {
 	return r.db.Model(&model.Plan{}).Where("id = ? AND sold_count > 0", planID).
 		UpdateColumn("sold_count", gorm.Expr("sold_count - ?", 1)).Error
 }
+
+// TrafficPackRepository 流量包商品仓库
+type TrafficPackRepository struct {
+	db *gorm.DB
+}
+
+func NewTrafficPackRepository(db *gorm.DB) *TrafficPackRepository {
+	return &TrafficPackRepository{db: db}
+}
+
+func (r *TrafficPackRepository) Create(pack *model.TrafficPack) error {
+	return r.db.Create(pack).Error
+}
+
+func (r *TrafficPackRepository) Update(pack *model.TrafficPack) error {
+	return r.db.Save(pack).Error
+}
+
+func (r *TrafficPackRepository) Delete(id int64) error {
+	return r.db.Delete(&model.TrafficPack{}, id).Error
+}
+
+func (r *TrafficPackRepository) FindByID(id int64) (*model.TrafficPack, error) {
+	var pack model.TrafficPack
+	err := r.db.First(&pack, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pack, nil
+}
+
+func (r *TrafficPackRepository) GetAll() ([]model.TrafficPack, error) {
+	var packs []model.TrafficPack
+	err := r.db.Order("sort ASC").Find(&packs).Error
+	return packs, err
+}
+
+func (r *TrafficPackRepository) GetAvailable() ([]model.TrafficPack, error) {
+	var packs []model.TrafficPack
+	err := r.db.Where("`show` = ? AND sell = ?", true, true).Order("sort ASC").Find(&packs).Error
+	return packs, err
+}
+
+// UserTrafficPackRepository 用户流量包仓库
+type UserTrafficPackRepository struct {
+	db *gorm.DB
+}
+
+func NewUserTrafficPackRepository(db *gorm.DB) *UserTrafficPackRepository {
+	return &UserTrafficPackRepository{db: db}
+}
+
+// WithTx 返回在事务中执行的仓库
+func (r *UserTrafficPackRepository) WithTx(tx *gorm.DB) *UserTrafficPackRepository {
+	return &UserTrafficPackRepository{db: tx}
+}
+
+func (r *UserTrafficPackRepository) Create(pack *model.UserTrafficPack) error {
+	return r.db.Create(pack).Error
+}
+
+func (r *UserTrafficPackRepository) Update(pack *model.UserTrafficPack) error {
+	return r.db.Save(pack).Error
+}
+
+func (r *UserTrafficPackRepository) FindByOrderID(orderID int64) (*model.UserTrafficPack, error) {
+	var pack model.UserTrafficPack
+	err := r.db.Where("order_id = ?", orderID).First(&pack).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pack, nil
+}
+
+// FindActiveByUserID 获取用户未结算的流量包（按到期时间先后）
+func (r *UserTrafficPackRepository) FindActiveByUserID(userID int64) ([]model.UserTrafficPack, error) {
+	var packs []model.UserTrafficPack
+	err := r.db.Where("user_id = ? AND status = ?", userID, model.TrafficPackActive).
+		Order("expired_at ASC, id ASC").Find(&packs).Error
+	return packs, err
+}
+
+func (r *UserTrafficPackRepository) FindByUserID(userID int64) ([]model.UserTrafficPack, error) {
+	var packs []model.UserTrafficPack
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&packs).Error
+	return packs, err
+}
+
+// GetExpiredUserIDs 获取有已到期但未结算流量包的用户
+func (r *UserTrafficPackRepository) GetExpiredUserIDs(now int64) ([]int64, error) {
+	var userIDs []int64
+	err := r.db.Model(&model.UserTrafficPack{}).
+		Where("status = ? AND expired_at <= ?", model.TrafficPackActive, now).
+		Distinct("user_id").Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// PlanWaitlistRepository 套餐候补队列仓库
+type PlanWaitlistRepository struct {
+	db *gorm.DB
+}
+
+func NewPlanWaitlistRepository(db *gorm.DB) *PlanWaitlistRepository {
+	return &PlanWaitlistRepository{db: db}
+}
+
+// WithTx 返回在事务中执行的仓库
+func (r *PlanWaitlistRepository) WithTx(tx *gorm.DB) *PlanWaitlistRepository {
+	return &PlanWaitlistRepository{db: tx}
+}
+
+func (r *PlanWaitlistRepository) Create(entry *model.PlanWaitlist) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *PlanWaitlistRepository) Update(entry *model.PlanWaitlist) error {
+	return r.db.Save(entry).Error
+}
+
+// FindOpen 获取用户在套餐上排队中或保留中的候补记录
+func (r *PlanWaitlistRepository) FindOpen(planID, userID int64) (*model.PlanWaitlist, error) {
+	var entry model.PlanWaitlist
+	err := r.db.Where("plan_id = ? AND user_id = ? AND status IN ?", planID, userID,
+		[]int{model.WaitlistWaiting, model.WaitlistReserved}).First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// FindWaiting 按加入顺序获取排队中的候补记录
+func (r *PlanWaitlistRepository) FindWaiting(planID int64, limit int) ([]model.PlanWaitlist, error) {
+	var entries []model.PlanWaitlist
+	err := r.db.Where("plan_id = ? AND status = ?", planID, model.WaitlistWaiting).
+		Order("id ASC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// CountReserved 统计套餐未过期的保留名额，excludeUserID 的保留不计入
+func (r *PlanWaitlistRepository) CountReserved(planID, excludeUserID, now int64) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.PlanWaitlist{}).
+		Where("plan_id = ? AND status = ? AND reserved_until > ?", planID, model.WaitlistReserved, now).
+		Where("user_id <> ?", excludeUserID).
+		Count(&count).Error
+	return count, err
+}
+
+// ExpireReservations 将超时的保留标记为过期，返回涉及的套餐 ID
+func (r *PlanWaitlistRepository) ExpireReservations(now int64) ([]int64, error) {
+	var planIDs []int64
+	err := r.db.Model(&model.PlanWaitlist{}).
+		Where("status = ? AND reserved_until <= ?", model.WaitlistReserved, now).
+		Distinct("plan_id").Pluck("plan_id", &planIDs).Error
+	if err != nil || len(planIDs) == 0 {
+		return planIDs, err
+	}
+	err = r.db.Model(&model.PlanWaitlist{}).
+		Where("status = ? AND reserved_until <= ?", model.WaitlistReserved, now).
+		Updates(map[string]interface{}{"status": model.WaitlistExpired, "updated_at": now}).Error
+	return planIDs, err
+}
+
+// GetWaitingPlanIDs 获取有排队用户的套餐
+func (r *PlanWaitlistRepository) GetWaitingPlanIDs() ([]int64, error) {
+	var planIDs []int64
+	err := r.db.Model(&model.PlanWaitlist{}).
+		Where("status = ?", model.WaitlistWaiting).
+		Distinct("plan_id").Pluck("plan_id", &planIDs).Error
+	return planIDs, err
+}
+
+// List 分页获取候补记录，status 为 nil 时不过滤状态
+func (r *PlanWaitlistRepository) List(planID int64, status *int, page, pageSize int) ([]model.PlanWaitlist, int64, error) {
+	var entries []model.PlanWaitlist
+	var total int64
+	query := r.db.Model(&model.PlanWaitlist{})
+	if planID > 0 {
+		query = query.Where("plan_id = ?", planID)
+	}
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	query.Count(&total)
+	err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error
+	return entries, total, err
+}
+
+// FindByUserID 获取用户的候补记录
+func (r *PlanWaitlistRepository) FindByUserID(userID int64) ([]model.PlanWaitlist, error) {
+	var entries []model.PlanWaitlist
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&entries).Error
+	return entries, err
+}
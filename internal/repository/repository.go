@@ -3,51 +3,75 @@ package repository
 import "gorm.io/gorm"
 
 type Repositories struct {
-	DB            *gorm.DB // Direct database access for services that need it
-	User          *UserRepository
-	Server        *ServerRepository
-	Plan          *PlanRepository
-	Order         *OrderRepository
-	Setting       *SettingRepository
-	Stat          *StatRepository
-	Ticket        *TicketRepository
-	TicketMessage *TicketMessageRepository
-	Payment       *PaymentRepository
-	Coupon        *CouponRepository
-	InviteCode    *InviteCodeRepository
-	CommissionLog *CommissionLogRepository
-	Notice        *NoticeRepository
-	Knowledge     *KnowledgeRepository
-	Host          *HostRepository
-	ServerNode    *ServerNodeRepository
-	ServerGroup   *ServerGroupRepository
-	UserGroup     *UserGroupRepository
-	Security      *SecurityRepository
-	Port          *PortRepository
+	DB                *gorm.DB // Direct database access for services that need it
+	User              *UserRepository
+	Server            *ServerRepository
+	Plan              *PlanRepository
+	TrafficPack       *TrafficPackRepository
+	UserTrafficPack   *UserTrafficPackRepository
+	PlanWaitlist      *PlanWaitlistRepository
+	Order             *OrderRepository
+	OrderRefund       *OrderRefundRepository
+	PaymentCallback   *PaymentCallbackRepository
+	RenewalAttempt    *RenewalAttemptRepository
+	Setting           *SettingRepository
+	SubscribeTemplate *SubscribeTemplateRepository
+	Stat              *StatRepository
+	Ticket            *TicketRepository
+	TicketMessage     *TicketMessageRepository
+	Payment           *PaymentRepository
+	Coupon            *CouponRepository
+	RedeemCode        *RedeemCodeRepository
+	RedeemLog         *RedeemLogRepository
+	InviteCode        *InviteCodeRepository
+	CommissionLog     *CommissionLogRepository
+	Withdraw          *CommissionWithdrawRepository
+	Notice            *NoticeRepository
+	Knowledge         *KnowledgeRepository
+	Host              *HostRepository
+	ServerNode        *ServerNodeRepository
+	WireGuardPeer     *WireGuardPeerRepository
+	ServerGroup       *ServerGroupRepository
+	ServerRoute       *ServerRouteRepository
+	UserGroup         *UserGroupRepository
+	Security          *SecurityRepository
+	Port              *PortRepository
 }
 
 func NewRepositories(db *gorm.DB) *Repositories {
 	return &Repositories{
-		DB:            db, // Store DB reference for direct access
-		User:          NewUserRepository(db),
-		Server:        NewServerRepository(db),
-		Plan:          NewPlanRepository(db),
-		Order:         NewOrderRepository(db),
-		Setting:       NewSettingRepository(db),
-		Stat:          NewStatRepository(db),
-		Ticket:        NewTicketRepository(db),
-		TicketMessage: NewTicketMessageRepository(db),
-		Payment:       NewPaymentRepository(db),
-		Coupon:        NewCouponRepository(db),
-		InviteCode:    NewInviteCodeRepository(db),
-		CommissionLog: NewCommissionLogRepository(db),
-		Notice:        NewNoticeRepository(db),
-		Knowledge:     NewKnowledgeRepository(db),
-		Host:          NewHostRepository(db),
-		ServerNode:    NewServerNodeRepository(db),
-		ServerGroup:   NewServerGroupRepository(db),
-		UserGroup:     NewUserGroupRepository(db),
-		Security:      NewSecurityRepository(db),
-		Port:          NewPortRepository(db),
+		DB:                db, // Store DB reference for direct access
+		User:              NewUserRepository(db),
+		Server:            NewServerRepository(db),
+		Plan:              NewPlanRepository(db),
+		TrafficPack:       NewTrafficPackRepository(db),
+		UserTrafficPack:   NewUserTrafficPackRepository(db),
+		PlanWaitlist:      NewPlanWaitlistRepository(db),
+		Order:             NewOrderRepository(db),
+		OrderRefund:       NewOrderRefundRepository(db),
+		PaymentCallback:   NewPaymentCallbackRepository(db),
+		RenewalAttempt:    NewRenewalAttemptRepository(db),
+		Setting:           NewSettingRepository(db),
+		SubscribeTemplate: NewSubscribeTemplateRepository(db),
+		Stat:              NewStatRepository(db),
+		Ticket:            NewTicketRepository(db),
+		TicketMessage:     NewTicketMessageRepository(db),
+		Payment:           NewPaymentRepository(db),
+		Coupon:            NewCouponRepository(db),
+		RedeemCode:        NewRedeemCodeRepository(db),
+		RedeemLog:         NewRedeemLogRepository(db),
+		InviteCode:        NewInviteCodeRepository(db),
+		CommissionLog:     NewCommissionLogRepository(db),
+		Withdraw:          NewCommissionWithdrawRepository(db),
+		Notice:            NewNoticeRepository(db),
+		Knowledge:         NewKnowledgeRepository(db),
+		Host:              NewHostRepository(db),
+		ServerNode:        NewServerNodeRepository(db),
+		WireGuardPeer:     NewWireGuardPeerRepository(db),
+		ServerGroup:       NewServerGroupRepository(db),
+		ServerRoute:       NewServerRouteRepository(db),
+		UserGroup:         NewUserGroupRepository(db),
+		Security:          NewSecurityRepository(db),
+		Port:              NewPortRepository(db),
 	}
 }
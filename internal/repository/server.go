@@ -107,6 +107,13 @@ func (r *ServerRepository) GetByHostID(hostID int64) ([]model.Server, error) {
 	return servers, err
 }
 
+// FindByParentID 获取指定落地节点下的所有中转节点
+func (r *ServerRepository) FindByParentID(parentID int64) ([]model.Server, error) {
+	var servers []model.Server
+	err := r.db.Where("parent_id = ?", parentID).Order("sort ASC").Find(&servers).Error
+	return servers, err
+}
+
 // UpdateHostID 更新节点的主机绑定
 func (r *ServerRepository) UpdateHostID(serverID int64, hostID *int64) error {
 	return r.db.Model(&model.Server{}).Where("id = ?", serverID).Update("host_id", hostID).Error
@@ -169,6 +176,15 @@ func NewServerRouteRepository(db *gorm.DB) *ServerRouteRepository {
 	return &ServerRouteRepository{db: db}
 }
 
+func (r *ServerRouteRepository) FindByID(id int64) (*model.ServerRoute, error) {
+	var route model.ServerRoute
+	err := r.db.First(&route, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
 func (r *ServerRouteRepository) FindByIDs(ids []int64) ([]model.ServerRoute, error) {
 	var routes []model.ServerRoute
 	err := r.db.Where("id IN ?", ids).Find(&routes).Error
@@ -180,3 +196,15 @@ func (r *ServerRouteRepository) GetAll() ([]model.ServerRoute, error) {
 	err := r.db.Find(&routes).Error
 	return routes, err
 }
+
+func (r *ServerRouteRepository) Create(route *model.ServerRoute) error {
+	return r.db.Create(route).Error
+}
+
+func (r *ServerRouteRepository) Update(route *model.ServerRoute) error {
+	return r.db.Save(route).Error
+}
+
+func (r *ServerRouteRepository) Delete(id int64) error {
+	return r.db.Delete(&model.ServerRoute{}, id).Error
+}
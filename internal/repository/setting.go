@@ -56,3 +56,44 @@ func (r *SettingRepository) GetAll() (map[string]string, error) {
 func (r *SettingRepository) Delete(key string) error {
 	return r.db.Where("`key` = ?", key).Delete(&model.Setting{}).Error
 }
+
+type SubscribeTemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewSubscribeTemplateRepository(db *gorm.DB) *SubscribeTemplateRepository {
+	return &SubscribeTemplateRepository{db: db}
+}
+
+func (r *SubscribeTemplateRepository) FindByName(name string) (*model.SubscribeTemplate, error) {
+	var tpl model.SubscribeTemplate
+	err := r.db.Where("name = ?", name).First(&tpl).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+func (r *SubscribeTemplateRepository) GetAll() ([]model.SubscribeTemplate, error) {
+	var templates []model.SubscribeTemplate
+	err := r.db.Order("name ASC").Find(&templates).Error
+	return templates, err
+}
+
+func (r *SubscribeTemplateRepository) Save(name, content string) error {
+	var tpl model.SubscribeTemplate
+	err := r.db.Where("name = ?", name).First(&tpl).Error
+	if err == gorm.ErrRecordNotFound {
+		tpl = model.SubscribeTemplate{Name: name, Content: content}
+		return r.db.Create(&tpl).Error
+	}
+	if err != nil {
+		return err
+	}
+	tpl.Content = content
+	return r.db.Save(&tpl).Error
+}
+
+func (r *SubscribeTemplateRepository) Delete(name string) error {
+	return r.db.Where("name = ?", name).Delete(&model.SubscribeTemplate{}).Error
+}
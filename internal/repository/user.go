@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -83,14 +84,14 @@ func (r *UserRepository) GetAvailableUsers(groupIDs []int64) ([]model.User, erro
 
 	// 流控检查：
 	// 1. transfer_enable = 0 表示无限流量
-	// 2. u + d < transfer_enable 表示还有剩余流量
-	query = query.Where("(transfer_enable = 0 OR u + d < transfer_enable)")
+	// 2. u + d < transfer_enable + pack_traffic 表示还有剩余流量（含流量包）
+	query = query.Where("(transfer_enable = 0 OR u + d < transfer_enable + pack_traffic)")
 
 	// 过期检查
 	query = query.Where("(expired_at IS NULL OR expired_at = 0 OR expired_at >= ?)", now)
 
 	// 只选择必要的字段
-	err := query.Select("id", "uuid", "speed_limit", "device_limit", "u", "d", "transfer_enable").Find(&users).Error
+	err := query.Select("id", "uuid", "speed_limit", "device_limit", "u", "d", "transfer_enable", "pack_traffic").Find(&users).Error
 	return users, err
 }
 
@@ -100,13 +101,36 @@ func (r *UserRepository) GetAllAvailableUsers() ([]model.User, error) {
 	now := getCurrentTimestamp()
 	err := r.db.
 		Where("banned = ?", false).
-		Where("(transfer_enable = 0 OR u + d < transfer_enable)"). // 流量0表示无限制
+		Where("(transfer_enable = 0 OR u + d < transfer_enable + pack_traffic)"). // 流量0表示无限制
 		Where("(expired_at IS NULL OR expired_at = 0 OR expired_at >= ?)", now).
-		Select("id", "uuid", "speed_limit", "device_limit", "u", "d", "transfer_enable").
+		Select("id", "uuid", "speed_limit", "device_limit", "u", "d", "transfer_enable", "pack_traffic").
 		Find(&users).Error
 	return users, err
 }
 
+// WithTx 返回在事务中执行的仓库
+func (r *UserRepository) WithTx(tx *gorm.DB) *UserRepository {
+	return &UserRepository{db: tx}
+}
+
+// Transaction 在事务中执行
+func (r *UserRepository) Transaction(fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(fn)
+}
+
+// FindByIDForUpdate 在事务中加锁读取用户（SQLite 下忽略行锁）
+func (r *UserRepository) FindByIDForUpdate(id int64) (*model.User, error) {
+	var user model.User
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 // UpdateTraffic 更新用户流量
 func (r *UserRepository) UpdateTraffic(userID int64, u, d int64) error {
 	return r.db.Model(&model.User{}).
@@ -200,6 +224,17 @@ func (r *UserRepository) CountByInviteUserID(inviteUserID int64) (int64, error)
 	return count, err
 }
 
+// CountDownline 统计指定层级的下线人数，tier 为 1 时即直接邀请人数
+func (r *UserRepository) CountDownline(userID int64, tier int) (int64, error) {
+	query := r.db.Model(&model.User{}).Select("id").Where("invite_user_id = ?", userID)
+	for i := 1; i < tier; i++ {
+		query = r.db.Model(&model.User{}).Select("id").Where("invite_user_id IN (?)", query)
+	}
+	var count int64
+	err := r.db.Model(&model.User{}).Where("id IN (?)", query).Count(&count).Error
+	return count, err
+}
+
 // GetUsersNeedTrafficReset 获取需要重置流量的用户
 func (r *UserRepository) GetUsersNeedTrafficReset() ([]model.User, error) {
 	var users []model.User
@@ -222,11 +257,25 @@ func (r *UserRepository) GetUsersExpiringSoon(days int) ([]model.User, error) {
 	return users, err
 }
 
+// GetAutoRenewUsers 获取开启自动续费且即将到期的用户
+func (r *UserRepository) GetAutoRenewUsers(days int) ([]model.User, error) {
+	var users []model.User
+	now := time.Now().Unix()
+	threshold := now + int64(days*86400)
+	err := r.db.Where("auto_renew = ?", true).
+		Where("plan_id IS NOT NULL").
+		Where("expired_at > ?", now).
+		Where("expired_at <= ?", threshold).
+		Where("banned = ?", false).
+		Find(&users).Error
+	return users, err
+}
+
 // GetUsersWithHighTrafficUsage 获取流量使用率高的用告
 func (r *UserRepository) GetUsersWithHighTrafficUsage(percentage int) ([]model.User, error) {
 	var users []model.User
 	err := r.db.Where("transfer_enable > 0").
-		Where("(u + d) * 100 / transfer_enable >= ?", percentage).
+		Where("(u + d) * 100 / (transfer_enable + pack_traffic) >= ?", percentage).
 		Where("banned = ?", false).
 		Find(&users).Error
 	return users, err
@@ -276,6 +325,35 @@ func (r *UserRepository) CountByRegisterIP(ip string) (int64, error) {
 	return count, err
 }
 
+// CountTrialByEmailDomain 统计邮箱域名在指定时间后领取试用的用户数
+func (r *UserRepository) CountTrialByEmailDomain(domain string, since int64) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.User{}).
+		Where("email LIKE ?", "%@"+domain).
+		Where("trial_at >= ?", since).
+		Count(&count).Error
+	return count, err
+}
+
+// CountTrialConversion 统计时间段内领取试用的用户数，以及其中已有付费订单的用户数
+func (r *UserRepository) CountTrialConversion(startAt, endAt int64) (int64, int64, error) {
+	var trial, converted int64
+	query := r.db.Model(&model.User{}).Where("trial_at >= ? AND trial_at < ?", startAt, endAt)
+	if err := query.Count(&trial).Error; err != nil {
+		return 0, 0, err
+	}
+
+	paid := r.db.Model(&model.Order{}).Select("1").
+		Where("v2_order.user_id = v2_user.id").
+		Where("v2_order.status IN ?", paidOrderStatuses).
+		Where("v2_order.total_amount > 0")
+	err := r.db.Model(&model.User{}).
+		Where("trial_at >= ? AND trial_at < ?", startAt, endAt).
+		Where("EXISTS (?)", paid).
+		Count(&converted).Error
+	return trial, converted, err
+}
+
 // FindByUUIDPrefix 根据 UUID 前缀查找用户
 func (r *UserRepository) FindByUUIDPrefix(prefix string) (*model.User, error) {
 	var user model.User
@@ -21,19 +21,27 @@ type HostService struct {
 	nodeRepo   *repository.ServerNodeRepository
 	userRepo   *repository.UserRepository
 	serverRepo *repository.ServerRepository
+	routeRepo  *repository.ServerRouteRepository
 	cache      *cache.Client
+	wireguard  *WireGuardService
 }
 
-func NewHostService(hostRepo *repository.HostRepository, nodeRepo *repository.ServerNodeRepository, userRepo *repository.UserRepository, serverRepo *repository.ServerRepository, cacheClient *cache.Client) *HostService {
+func NewHostService(hostRepo *repository.HostRepository, nodeRepo *repository.ServerNodeRepository, userRepo *repository.UserRepository, serverRepo *repository.ServerRepository, routeRepo *repository.ServerRouteRepository, cacheClient *cache.Client) *HostService {
 	return &HostService{
 		hostRepo:   hostRepo,
 		nodeRepo:   nodeRepo,
 		userRepo:   userRepo,
 		serverRepo: serverRepo,
+		routeRepo:  routeRepo,
 		cache:      cacheClient,
 	}
 }
 
+// SetWireGuardService 设置 WireGuard 服务
+func (s *HostService) SetWireGuardService(wireguard *WireGuardService) {
+	s.wireguard = wireguard
+}
+
 // CreateHost 创建主机
 func (s *HostService) CreateHost(name string) (*model.Host, error) {
 	token := generateHostToken()
@@ -118,6 +126,16 @@ func (s *HostService) GetServersByHostID(hostID int64) ([]model.Server, error) {
 
 // CreateNode 创建节点
 func (s *HostService) CreateNode(node *model.ServerNode) error {
+	if _, err := model.ParseRateTimeRanges(node.RateTimeRanges); err != nil {
+		return err
+	}
+	if node.Type == model.NodeTypeWireGuard {
+		ps, err := ensureWireGuardServerKey(&node.WireGuardKey, node.ProtocolSettings)
+		if err != nil {
+			return err
+		}
+		node.ProtocolSettings = ps
+	}
 	node.CreatedAt = time.Now().Unix()
 	node.UpdatedAt = time.Now().Unix()
 	return s.nodeRepo.Create(node)
@@ -125,6 +143,16 @@ func (s *HostService) CreateNode(node *model.ServerNode) error {
 
 // UpdateNode 更新节点
 func (s *HostService) UpdateNode(node *model.ServerNode) error {
+	if _, err := model.ParseRateTimeRanges(node.RateTimeRanges); err != nil {
+		return err
+	}
+	if node.Type == model.NodeTypeWireGuard {
+		ps, err := ensureWireGuardServerKey(&node.WireGuardKey, node.ProtocolSettings)
+		if err != nil {
+			return err
+		}
+		node.ProtocolSettings = ps
+	}
 	node.UpdatedAt = time.Now().Unix()
 	return s.nodeRepo.Update(node)
 }
@@ -147,6 +175,10 @@ func (s *HostService) GetNodeByID(nodeID int64) (*model.ServerNode, error) {
 // GenerateSingBoxConfig 生成 sing-box 配置
 func (s *HostService) GenerateSingBoxConfig(hostID int64) (map[string]interface{}, error) {
 	inbounds := make([]map[string]interface{}, 0)
+	endpoints := make([]map[string]interface{}, 0)
+	relayOutbounds := make([]map[string]interface{}, 0)
+	relayRules := make([]map[string]interface{}, 0)
+	routes := newRouteConfig("", s.parseSocksOutbound)
 	processedServerIDs := make(map[int64]bool) // 记录已处理的 Server ID，避免重复
 
 	// 1. 从绑定到主机的Server 获取配置
@@ -156,11 +188,37 @@ func (s *HostService) GenerateSingBoxConfig(hostID int64) (map[string]interface{
 			if processedServerIDs[server.ID] {
 				continue
 			}
-			inbound := s.buildInboundFromServer(&server)
-			if inbound != nil {
-				inbounds = append(inbounds, inbound)
+			if server.Type == model.ServerTypeWireGuard {
+				if endpoint := s.buildWireGuardEndpoint(server.Type+"-in-"+fmt.Sprintf("%d", server.ID), server.ServerPort, server.WireGuardKey, server.ProtocolSettings, server.GetGroupIDsAsInt64()); endpoint != nil {
+					endpoints = append(endpoints, endpoint)
+					routes.attach(endpoint["tag"].(string), server.GetRouteIDsAsInt64())
+				}
 				processedServerIDs[server.ID] = true
+				continue
 			}
+			inbound := s.buildInboundFromServer(&server)
+			if inbound == nil {
+				continue
+			}
+			// 中转节点：入站流量转发至落地节点，落地节点不可用时不启动入站
+			if server.ParentID != nil {
+				parent, err := s.serverRepo.FindByID(*server.ParentID)
+				if err != nil {
+					continue
+				}
+				outbound := buildRelayOutbound(&server, parent)
+				if outbound == nil {
+					continue
+				}
+				relayOutbounds = append(relayOutbounds, outbound)
+				relayRules = append(relayRules, map[string]interface{}{
+					"inbound":  []string{inbound["tag"].(string)},
+					"outbound": outbound["tag"],
+				})
+			}
+			inbounds = append(inbounds, inbound)
+			routes.attach(inbound["tag"].(string), server.GetRouteIDsAsInt64())
+			processedServerIDs[server.ID] = true
 		}
 	}
 
@@ -168,9 +226,17 @@ func (s *HostService) GenerateSingBoxConfig(hostID int64) (map[string]interface{
 	nodes, err := s.nodeRepo.FindByHostID(hostID)
 	if err == nil {
 		for _, node := range nodes {
+			if node.Type == model.NodeTypeWireGuard {
+				if endpoint := s.buildWireGuardEndpoint(node.Type+"-in-"+fmt.Sprintf("%d", node.ID), node.ListenPort, node.WireGuardKey, node.ProtocolSettings, node.GetGroupIDsAsInt64()); endpoint != nil {
+					endpoints = append(endpoints, endpoint)
+					routes.attach(endpoint["tag"].(string), node.GetRouteIDsAsInt64())
+				}
+				continue
+			}
 			inbound := s.buildInbound(&node)
 			if inbound != nil {
 				inbounds = append(inbounds, inbound)
+				routes.attach(inbound["tag"].(string), node.GetRouteIDsAsInt64())
 			}
 		}
 	}
@@ -186,6 +252,7 @@ func (s *HostService) GenerateSingBoxConfig(hostID int64) (map[string]interface{
 		{"type": "direct", "tag": "direct"},
 		{"type": "block", "tag": "block"},
 	}
+	outbounds = append(outbounds, relayOutbounds...)
 
 	// 如果配置告SOCKS 出口，添告SOCKS outbound 并设置为默认出口
 	finalOutbound := "direct"
@@ -194,9 +261,23 @@ func (s *HostService) GenerateSingBoxConfig(hostID int64) (map[string]interface{
 		if socksOutbound != nil {
 			outbounds = append([]map[string]interface{}{socksOutbound}, outbounds...)
 			finalOutbound = "socks-out" // 使用 SOCKS 作为默认出口
+			routes.socksOut = "socks-out"
 		}
 	}
 
+	// 节点绑定的路由规则
+	if err := routes.load(s.routeRepo); err != nil {
+		return nil, err
+	}
+	routeResult := routes.build()
+	outbounds = append(outbounds, routeResult.outbounds...)
+
+	rules := []map[string]interface{}{
+		{"ip_is_private": true, "outbound": "block"},
+	}
+	rules = append(rules, routeResult.rules...)
+	rules = append(rules, relayRules...)
+
 	config := map[string]interface{}{
 		"log": map[string]interface{}{
 			"level":     "info",
@@ -205,9 +286,7 @@ func (s *HostService) GenerateSingBoxConfig(hostID int64) (map[string]interface{
 		"inbounds":  inbounds,
 		"outbounds": outbounds,
 		"route": map[string]interface{}{
-			"rules": []map[string]interface{}{
-				{"ip_is_private": true, "outbound": "block"},
-			},
+			"rules": rules,
 			"final": finalOutbound, // 使用配置的默认出告
 		},
 		"experimental": map[string]interface{}{
@@ -217,11 +296,84 @@ func (s *HostService) GenerateSingBoxConfig(hostID int64) (map[string]interface{
 		},
 	}
 
+	if len(routeResult.ruleSets) > 0 {
+		config["route"].(map[string]interface{})["rule_set"] = routeResult.ruleSets
+	}
+	if routeResult.dns != nil {
+		config["dns"] = routeResult.dns
+	}
+
+	// WireGuard 使用 sing-box endpoint
+	if len(endpoints) > 0 {
+		config["endpoints"] = endpoints
+	}
+
 	return config, nil
 }
 
+// buildWireGuardEndpoint 构建 WireGuard endpoint，每个可用用户一个 peer
+func (s *HostService) buildWireGuardEndpoint(tag string, port int, privateKey string, ps model.JSONMap, groupIDs []int64) map[string]interface{} {
+	if s.wireguard == nil {
+		return nil
+	}
+	if privateKey == "" {
+		return nil
+	}
+	address, err := s.wireguard.ServerAddress()
+	if err != nil {
+		return nil
+	}
+
+	var users []model.User
+	if len(groupIDs) == 0 {
+		users, err = s.userRepo.GetAllAvailableUsers()
+	} else {
+		users, err = s.userRepo.GetAvailableUsers(groupIDs)
+	}
+	if err != nil {
+		return nil
+	}
+	peerMap, err := s.wireguard.GetPeers(users)
+	if err != nil {
+		return nil
+	}
+
+	peers := make([]map[string]interface{}, 0, len(users))
+	for _, user := range users {
+		peer, ok := peerMap[user.ID]
+		if !ok {
+			continue
+		}
+		peers = append(peers, map[string]interface{}{
+			"public_key":  peer.PublicKey,
+			"allowed_ips": []string{peer.IP + "/32"},
+		})
+	}
+
+	mtu := 1420
+	if m, ok := ps["mtu"].(float64); ok && m > 0 {
+		mtu = int(m)
+	}
+
+	return map[string]interface{}{
+		"type":        "wireguard",
+		"tag":         tag,
+		"system":      false,
+		"mtu":         mtu,
+		"address":     []string{address},
+		"private_key": privateKey,
+		"listen_port": port,
+		"peers":       peers,
+	}
+}
+
 // buildInboundFromServer 告Server 构建 inbound 配置
 func (s *HostService) buildInboundFromServer(server *model.Server) map[string]interface{} {
+	// mieru 由 mita 承载，不生成 sing-box inbound
+	if server.Type == model.ServerTypeMieru {
+		return nil
+	}
+
 	tag := server.Type + "-in-" + fmt.Sprintf("%d", server.ID)
 
 	inbound := map[string]interface{}{
@@ -247,12 +399,7 @@ func (s *HostService) buildInboundFromServer(server *model.Server) map[string]in
 	// Shadowsocks 需要特殊处告
 	if server.Type == model.ServerTypeShadowsocks {
 		// 获取加密方式
-		cipher := ""
-		if c, ok := server.ProtocolSettings["method"].(string); ok {
-			cipher = c
-		} else if c, ok := server.ProtocolSettings["cipher"].(string); ok {
-			cipher = c
-		}
+		cipher := shadowsocksCipher(server.ProtocolSettings)
 
 		// 确保 method 字段存在，删告cipher 字段
 		inbound["method"] = cipher
@@ -298,6 +445,11 @@ func (s *HostService) buildInbound(node *model.ServerNode) map[string]interface{
 	nodeType := node.Type
 	createdAt := node.CreatedAt
 
+	// mieru 由 mita 承载，不生成 sing-box inbound
+	if nodeType == model.NodeTypeMieru {
+		return nil
+	}
+
 	tag := nodeType + "-in-" + fmt.Sprintf("%d", node.ID)
 
 	inbound := map[string]interface{}{
@@ -324,12 +476,7 @@ func (s *HostService) buildInbound(node *model.ServerNode) map[string]interface{
 	// Shadowsocks 需要特殊处告
 	if nodeType == model.NodeTypeShadowsocks {
 		// 获取加密方式
-		cipher := ""
-		if c, ok := protocolSettings["method"].(string); ok {
-			cipher = c
-		} else if c, ok := protocolSettings["cipher"].(string); ok {
-			cipher = c
-		}
+		cipher := shadowsocksCipher(protocolSettings)
 
 		// 确保 method 字段存在
 		inbound["method"] = cipher
@@ -469,6 +616,9 @@ func (s *HostService) GetUsersForNode(node *model.ServerNode) ([]map[string]inte
 		case model.NodeTypeNaive:
 			userConfig["username"] = user.UUID[:8]
 			userConfig["password"] = user.UUID
+		case model.NodeTypeMieru:
+			userConfig["name"] = user.UUID[:8]
+			userConfig["password"] = user.UUID
 		default:
 			userConfig["name"] = user.UUID[:8]
 			userConfig["password"] = user.UUID
@@ -477,6 +627,9 @@ func (s *HostService) GetUsersForNode(node *model.ServerNode) ([]map[string]inte
 		result = append(result, userConfig)
 	}
 
+	if nodeType == model.NodeTypeWireGuard {
+		s.attachWireGuardAddresses(users, result)
+	}
 	return result, nil
 }
 
@@ -488,24 +641,14 @@ func (s *HostService) generateSS2022Password(node *model.ServerNode, user *model
 // generateSS2022PasswordWithConfig 根据配置生成 SS2022 密码
 // 返回格式: serverKey:userKey (用于客户端订告
 func (s *HostService) generateSS2022PasswordWithConfig(ps model.JSONMap, createdAt int64, user *model.User) string {
-	cipher := ""
-	if c, ok := ps["method"].(string); ok {
-		cipher = c
-	} else if c, ok := ps["cipher"].(string); ok {
-		cipher = c
-	}
+	cipher := shadowsocksCipher(ps)
 
 	return utils.GenerateSS2022Password(cipher, createdAt, user.UUID)
 }
 
 // getSS2022UserKey 获取 SS2022 用户密钥 (用于服务端用户列告
 func (s *HostService) getSS2022UserKey(ps model.JSONMap, user *model.User) string {
-	cipher := ""
-	if c, ok := ps["method"].(string); ok {
-		cipher = c
-	} else if c, ok := ps["cipher"].(string); ok {
-		cipher = c
-	}
+	cipher := shadowsocksCipher(ps)
 
 	return utils.GetSS2022UserPassword(cipher, user.UUID)
 }
@@ -622,6 +765,24 @@ func (s *HostService) GetDefaultNodeConfig(nodeType string) map[string]interface
 				"detour_method":    "2022-blake3-aes-128-gcm",
 			},
 		}
+	case model.NodeTypeWireGuard:
+		return map[string]interface{}{
+			"name":        "WireGuard节点",
+			"listen_port": 51820,
+			"protocol_settings": map[string]interface{}{
+				"mtu": 1420, // 服务端密钥保存时自动生成
+			},
+		}
+	case model.NodeTypeMieru:
+		return map[string]interface{}{
+			"name":        "Mieru节点",
+			"listen_port": 2999,
+			"protocol_settings": map[string]interface{}{
+				"transport":    "TCP",
+				"multiplexing": "MULTIPLEXING_LOW",
+				"mtu":          1400,
+			},
+		}
 	case model.NodeTypeNaive:
 		return map[string]interface{}{
 			"name":        "NaiveProxy节点",
@@ -647,6 +808,7 @@ func (s *HostService) GetAllNodes() ([]model.ServerNode, error) {
 // AgentConfig Agent 配置
 type AgentConfig struct {
 	SingBoxConfig map[string]interface{} `json:"singbox_config"`
+	MieruConfig   map[string]interface{} `json:"mieru_config,omitempty"`
 	Nodes         []AgentNodeConfig      `json:"nodes"`
 }
 
@@ -668,6 +830,7 @@ func (s *HostService) GetAgentConfig(hostID int64) (*AgentConfig, error) {
 
 	nodeConfigs := make([]AgentNodeConfig, 0)
 	processedServerIDs := make(map[int64]bool) // 记录已处理的 Server ID，避免重告
+	mieru := newMieruServerConfig()
 
 	// 1. 从绑定到主机告Server 获取配置
 	servers, err := s.serverRepo.GetByHostID(hostID)
@@ -677,6 +840,9 @@ func (s *HostService) GetAgentConfig(hostID int64) (*AgentConfig, error) {
 				continue
 			}
 			users, _ := s.GetUsersForServer(&server)
+			if server.Type == model.ServerTypeMieru {
+				mieru.add(server.ServerPort, server.ProtocolSettings, users)
+			}
 			nodeConfigs = append(nodeConfigs, AgentNodeConfig{
 				ID:    server.ID,
 				Type:  server.Type,
@@ -693,6 +859,9 @@ func (s *HostService) GetAgentConfig(hostID int64) (*AgentConfig, error) {
 	if err == nil {
 		for _, node := range nodes {
 			users, _ := s.GetUsersForNode(&node)
+			if node.Type == model.NodeTypeMieru {
+				mieru.add(node.ListenPort, node.ProtocolSettings, users)
+			}
 			nodeConfigs = append(nodeConfigs, AgentNodeConfig{
 				ID:    node.ID,
 				Type:  node.Type,
@@ -705,10 +874,71 @@ func (s *HostService) GetAgentConfig(hostID int64) (*AgentConfig, error) {
 
 	return &AgentConfig{
 		SingBoxConfig: config,
+		MieruConfig:   mieru.build(),
 		Nodes:         nodeConfigs,
 	}, nil
 }
 
+// mieruServerConfig 合并同一主机上所有 mieru 节点的 mita 配置
+type mieruServerConfig struct {
+	portBindings []map[string]interface{}
+	users        []map[string]interface{}
+	userNames    map[string]bool
+	mtu          int
+}
+
+func newMieruServerConfig() *mieruServerConfig {
+	return &mieruServerConfig{userNames: make(map[string]bool)}
+}
+
+func (m *mieruServerConfig) add(port int, ps model.JSONMap, users []map[string]interface{}) {
+	transport := "TCP"
+	if t, ok := ps["transport"].(string); ok && t != "" {
+		transport = strings.ToUpper(t)
+	}
+
+	binding := map[string]interface{}{"protocol": transport}
+	if pr, ok := ps["port_range"].(string); ok && pr != "" {
+		binding["portRange"] = pr
+	} else {
+		binding["port"] = port
+	}
+	m.portBindings = append(m.portBindings, binding)
+
+	if mtu, ok := ps["mtu"].(float64); ok && mtu > 0 {
+		m.mtu = int(mtu)
+	}
+
+	// mita 的用户在所有端口共享，按用户名去重
+	for _, u := range users {
+		name, _ := u["name"].(string)
+		if name == "" || m.userNames[name] {
+			continue
+		}
+		m.userNames[name] = true
+		m.users = append(m.users, map[string]interface{}{
+			"name":     name,
+			"password": u["password"],
+		})
+	}
+}
+
+// build 生成 mita 服务端配置，没有 mieru 节点时返回 nil
+func (m *mieruServerConfig) build() map[string]interface{} {
+	if len(m.portBindings) == 0 {
+		return nil
+	}
+	config := map[string]interface{}{
+		"portBindings": m.portBindings,
+		"users":        m.users,
+		"loggingLevel": "INFO",
+	}
+	if m.mtu > 0 {
+		config["mtu"] = m.mtu
+	}
+	return config
+}
+
 // GetUsersForServer 获取 Server 可用的用户列告
 func (s *HostService) GetUsersForServer(server *model.Server) ([]map[string]interface{}, error) {
 	groupIDs := server.GetGroupIDsAsInt64()
@@ -728,38 +958,77 @@ func (s *HostService) GetUsersForServer(server *model.Server) ([]map[string]inte
 
 	result := make([]map[string]interface{}, 0, len(users))
 	for _, user := range users {
-		userConfig := map[string]interface{}{}
-
-		// sing-box 不同协议的用户字段不告
-		switch server.Type {
-		case model.ServerTypeShadowsocks:
-			userConfig["name"] = user.UUID[:8]
-			userConfig["password"] = s.getSS2022UserKeyForServer(server, &user)
-		case model.ServerTypeVmess, model.ServerTypeVless:
-			userConfig["name"] = user.UUID[:8]
-			userConfig["uuid"] = user.UUID
-		case model.ServerTypeTrojan, model.ServerTypeHysteria, model.ServerTypeTuic:
-			userConfig["name"] = user.UUID[:8]
-			userConfig["password"] = user.UUID
-		default:
-			userConfig["name"] = user.UUID[:8]
-			userConfig["password"] = user.UUID
-		}
+		result = append(result, s.serverUserConfig(server, &user))
+	}
+	if server.Type == model.ServerTypeWireGuard {
+		s.attachWireGuardAddresses(users, result)
+	}
 
+	// 中转节点连接本节点使用的凭据
+	relays, err := s.serverRepo.FindByParentID(server.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, relay := range relays {
+		userConfig := s.serverUserConfig(server, &model.User{UUID: relayUUID(&relay, server)})
+		userConfig["name"] = relayUserName(&relay)
 		result = append(result, userConfig)
 	}
 
 	return result, nil
 }
 
+// attachWireGuardAddresses 为 WireGuard 节点用户附带隧道地址，Agent 按连接来源地址统计用户流量
+func (s *HostService) attachWireGuardAddresses(users []model.User, result []map[string]interface{}) {
+	if s.wireguard == nil {
+		return
+	}
+	peers, err := s.wireguard.GetPeers(users)
+	if err != nil {
+		return
+	}
+	for i := range users {
+		if peer, ok := peers[users[i].ID]; ok {
+			result[i]["address"] = peer.IP
+		}
+	}
+}
+
+// serverUserConfig 构建 Server 入站的单个用户配置
+func (s *HostService) serverUserConfig(server *model.Server, user *model.User) map[string]interface{} {
+	userConfig := map[string]interface{}{}
+
+	// sing-box 不同协议的用户字段不告
+	switch server.Type {
+	case model.ServerTypeShadowsocks:
+		userConfig["name"] = user.UUID[:8]
+		userConfig["password"] = s.getSS2022UserKeyForServer(server, user)
+	case model.ServerTypeVmess, model.ServerTypeVless:
+		userConfig["name"] = user.UUID[:8]
+		userConfig["uuid"] = user.UUID
+	case model.ServerTypeTrojan, model.ServerTypeHysteria, model.ServerTypeTuic, model.ServerTypeMieru:
+		userConfig["name"] = user.UUID[:8]
+		userConfig["password"] = user.UUID
+	default:
+		userConfig["name"] = user.UUID[:8]
+		userConfig["password"] = user.UUID
+	}
+	return userConfig
+}
+
+// shadowsocksCipher 获取 Shadowsocks 加密方式，method 优先于 cipher
+// 落地节点入站、用户密钥与中转出站必须使用同一规则
+func shadowsocksCipher(ps model.JSONMap) string {
+	if c, ok := ps["method"].(string); ok {
+		return c
+	}
+	c, _ := ps["cipher"].(string)
+	return c
+}
+
 // getSS2022UserKeyForServer 获取 Server 告SS2022 用户密钥 (仅用户密钥，用于服务告
 func (s *HostService) getSS2022UserKeyForServer(server *model.Server, user *model.User) string {
-	cipher := ""
-	if c, ok := server.ProtocolSettings["method"].(string); ok {
-		cipher = c
-	} else if c, ok := server.ProtocolSettings["cipher"].(string); ok {
-		cipher = c
-	}
+	cipher := shadowsocksCipher(server.ProtocolSettings)
 
 	return utils.GetSS2022UserPassword(cipher, user.UUID)
 }
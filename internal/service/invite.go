@@ -7,6 +7,8 @@ import (
 	"dashgo/internal/model"
 	"dashgo/internal/repository"
 	"dashgo/pkg/utils"
+
+	"gorm.io/gorm"
 )
 
 // InviteService 邀请服
@@ -14,20 +16,29 @@ type InviteService struct {
 	inviteRepo     *repository.InviteCodeRepository
 	userRepo       *repository.UserRepository
 	commissionRepo *repository.CommissionLogRepository
+	orderRepo      *repository.OrderRepository
+	settingSvc     *SettingService
 }
 
 func NewInviteService(
 	inviteRepo *repository.InviteCodeRepository,
 	userRepo *repository.UserRepository,
 	commissionRepo *repository.CommissionLogRepository,
+	orderRepo *repository.OrderRepository,
 ) *InviteService {
 	return &InviteService{
 		inviteRepo:     inviteRepo,
 		userRepo:       userRepo,
 		commissionRepo: commissionRepo,
+		orderRepo:      orderRepo,
 	}
 }
 
+// SetSettingService 设置 SettingService（返佣比例与首单设置）
+func (s *InviteService) SetSettingService(settingSvc *SettingService) {
+	s.settingSvc = settingSvc
+}
+
 // GetUserInviteCodes 获取用户的邀请码
 func (s *InviteService) GetUserInviteCodes(userID int64) ([]model.InviteCode, error) {
 	return s.inviteRepo.FindByUserID(userID)
@@ -91,73 +102,249 @@ func (s *InviteService) UseInviteCode(code string, newUserID int64) error {
 	return s.inviteRepo.Update(inviteCode)
 }
 
-// CalculateCommission 计算佣金
-func (s *InviteService) CalculateCommission(order *model.Order) (int64, error) {
-	user, err := s.userRepo.FindByID(order.UserID)
+// maxCommissionTiers 最多返佣层级
+const maxCommissionTiers = 3
+
+// CommissionShare 单个邀请人应得的佣金
+type CommissionShare struct {
+	InviteUserID int64 `json:"invite_user_id"`
+	Tier         int   `json:"tier"`
+	Rate         int   `json:"rate"`
+	Amount       int64 `json:"amount"`
+}
+
+// tierRates 各层级返佣比例，默认仅直接邀请人返佣 10%
+func (s *InviteService) tierRates() [maxCommissionTiers]int {
+	rates := [maxCommissionTiers]int{10, 0, 0}
+	if s.settingSvc != nil {
+		rates[0] = s.settingSvc.GetInt(SettingCommissionRate, 10)
+		rates[1] = s.settingSvc.GetInt(SettingCommissionRateTier2, 0)
+		rates[2] = s.settingSvc.GetInt(SettingCommissionRateTier3, 0)
+	}
+	return rates
+}
+
+// firstOrderOnly 返佣类型跟随系统时是否仅首单返佣
+func (s *InviteService) firstOrderOnly() bool {
+	return s.settingSvc != nil && s.settingSvc.GetBool(SettingCommissionFirstOrderOnly, false)
+}
+
+// CalculateCommission 计算订单各层级邀请人的佣金（按基础币种）
+func (s *InviteService) CalculateCommission(order *model.Order) ([]CommissionShare, error) {
+	return s.calculate(s.userRepo, s.orderRepo, order)
+}
+
+// calculate 沿邀请关系向上最多三级计算佣金：
+//   - 直接邀请人设置了 CommissionRate 时使用个人比例，其余层级使用站点比例
+//   - 邀请人返佣类型为仅首单（或跟随系统且系统设置为仅首单）时，被邀请人已有付费订单则不返佣
+func (s *InviteService) calculate(userRepo *repository.UserRepository, orderRepo *repository.OrderRepository, order *model.Order) ([]CommissionShare, error) {
+	amount := order.ToBase(order.TotalAmount)
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	buyer, err := userRepo.FindByID(order.UserID)
+	if err != nil || buyer == nil {
+		return nil, err
+	}
+
+	paidBefore, err := orderRepo.CountPaidByUser(order.UserID, order.ID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	firstOrder := paidBefore == 0
+	rates := s.tierRates()
+
+	var shares []CommissionShare
+	seen := map[int64]bool{buyer.ID: true}
+	current := buyer
+	for tier := 1; tier <= maxCommissionTiers; tier++ {
+		if current.InviteUserID == nil || seen[*current.InviteUserID] {
+			break
+		}
+		inviter, err := userRepo.FindByID(*current.InviteUserID)
+		if err != nil || inviter == nil {
+			break
+		}
+		seen[inviter.ID] = true
+		current = inviter
 
-	if user.InviteUserID == nil {
-		return 0, nil
+		rate := rates[tier-1]
+		if tier == 1 && inviter.CommissionRate != nil {
+			rate = *inviter.CommissionRate
+		}
+		onetime := inviter.CommissionType == model.CommissionTypeOnetime ||
+			(inviter.CommissionType == model.CommissionTypeSystem && s.firstOrderOnly())
+		if rate <= 0 || (onetime && !firstOrder) {
+			continue
+		}
+		if commission := amount * int64(rate) / 100; commission > 0 {
+			shares = append(shares, CommissionShare{InviteUserID: inviter.ID, Tier: tier, Rate: rate, Amount: commission})
+		}
 	}
+	return shares, nil
+}
+
+// RecordCommission 计算订单佣金并写入待确认的佣金记录
+func (s *InviteService) RecordCommission(order *model.Order) error {
+	return s.orderRepo.Transaction(func(tx *gorm.DB) error {
+		_, err := s.recordCommission(tx, order)
+		return err
+	})
+}
 
-	inviter, err := s.userRepo.FindByID(*user.InviteUserID)
+// recordCommission 在事务中写入各层级待确认的佣金记录，返回佣金总额
+// 佣金在持有期满后由 ConfirmCommissions 发放到邀请人佣金余额
+func (s *InviteService) recordCommission(tx *gorm.DB, order *model.Order) (int64, error) {
+	commissionRepo := s.commissionRepo.WithTx(tx)
+
+	shares, err := s.calculate(s.userRepo.WithTx(tx), s.orderRepo.WithTx(tx), order)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 
-	// 计算佣金
-	var commission int64
-	switch inviter.CommissionType {
-	case 0: // 系统默认
-		// 默认 10%
-		commission = order.TotalAmount * 10 / 100
-	case 1: // 按周期
-		commission = order.TotalAmount * 10 / 100
-	case 2: // 按订单
-		if inviter.CommissionRate != nil {
-			commission = order.TotalAmount * int64(*inviter.CommissionRate) / 100
+	var total int64
+	now := time.Now().Unix()
+	for _, share := range shares {
+		if err := commissionRepo.Create(&model.CommissionLog{
+			InviteUserID: share.InviteUserID,
+			UserID:       order.UserID,
+			TradeNo:      order.TradeNo,
+			OrderAmount:  order.ToBase(order.TotalAmount),
+			GetAmount:    share.Amount,
+			Tier:         share.Tier,
+			Status:       model.CommissionStatusPending,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}); err != nil {
+			return total, err
 		}
+		total += share.Amount
 	}
+	order.CommissionBalance = total
+	order.CommissionStatus = model.CommissionStatusPending
+	return total, nil
+}
 
-	return commission, nil
+// holdDays 佣金持有天数，默认 7 天
+func (s *InviteService) holdDays() int {
+	if s.settingSvc == nil {
+		return 7
+	}
+	days := s.settingSvc.GetInt(SettingCommissionHoldDays, 7)
+	if days < 0 {
+		return 0
+	}
+	return days
 }
 
-// RecordCommission 记录佣金
-func (s *InviteService) RecordCommission(order *model.Order, commission int64) error {
-	user, err := s.userRepo.FindByID(order.UserID)
+// ConfirmCommissions 处理持有期已满的待确认佣金，返回发放与作废的订单数
+func (s *InviteService) ConfirmCommissions() (int, int, error) {
+	paidBefore := time.Now().Unix() - int64(s.holdDays())*86400
+	orders, err := s.orderRepo.FindCommissionDue(paidBefore, 500)
 	if err != nil {
-		return err
+		return 0, 0, err
+	}
+
+	confirmed, cancelled := 0, 0
+	for _, order := range orders {
+		var status int
+		err := s.orderRepo.Transaction(func(tx *gorm.DB) error {
+			var err error
+			status, err = s.settleCommission(tx, order.TradeNo)
+			return err
+		})
+		if err != nil {
+			return confirmed, cancelled, err
+		}
+		switch status {
+		case model.CommissionStatusConfirmed:
+			confirmed++
+		case model.CommissionStatusCancelled:
+			cancelled++
+		}
 	}
+	return confirmed, cancelled, nil
+}
+
+// settleCommission 确认或作废单个订单的佣金：
+// 订单已取消或已全额退款时作废；否则按邀请人汇总待确认记录（含部分退款追回的负数记录）发放到佣金余额
+func (s *InviteService) settleCommission(tx *gorm.DB, tradeNo string) (int, error) {
+	orderRepo := s.orderRepo.WithTx(tx)
+	userRepo := s.userRepo.WithTx(tx)
+	commissionRepo := s.commissionRepo.WithTx(tx)
 
-	if user.InviteUserID == nil {
-		return nil
+	order, err := orderRepo.FindByTradeNoForUpdate(tradeNo)
+	if err != nil {
+		return 0, err
+	}
+	if order.CommissionStatus != model.CommissionStatusPending {
+		return order.CommissionStatus, nil
 	}
 
-	// 创建佣金记录
-	log := &model.CommissionLog{
-		InviteUserID: *user.InviteUserID,
-		UserID:       order.UserID,
-		TradeNo:      order.TradeNo,
-		OrderAmount:  order.TotalAmount,
-		GetAmount:    commission,
-		CreatedAt:    time.Now().Unix(),
-		UpdatedAt:    time.Now().Unix(),
+	refunded := order.RefundAmount != nil && *order.RefundAmount >= order.TotalAmount
+	if order.Status == model.OrderStatusCancelled || refunded {
+		if err := commissionRepo.UpdateStatusByTradeNo(tradeNo, model.CommissionStatusPending, model.CommissionStatusCancelled); err != nil {
+			return 0, err
+		}
+		return model.CommissionStatusCancelled, orderRepo.UpdateCommission(order.ID, model.CommissionStatusCancelled, 0)
 	}
 
-	if err := s.commissionRepo.Create(log); err != nil {
-		return err
+	logs, err := commissionRepo.FindByTradeNo(tradeNo)
+	if err != nil {
+		return 0, err
+	}
+	var inviters []int64
+	net := make(map[int64]int64)
+	for _, log := range logs {
+		if log.Status != model.CommissionStatusPending {
+			continue
+		}
+		if _, ok := net[log.InviteUserID]; !ok {
+			inviters = append(inviters, log.InviteUserID)
+		}
+		net[log.InviteUserID] += log.GetAmount
+	}
+
+	var actual int64
+	for _, inviteUserID := range inviters {
+		if net[inviteUserID] <= 0 {
+			continue
+		}
+		inviter, err := userRepo.FindByIDForUpdate(inviteUserID)
+		if err != nil || inviter == nil {
+			continue
+		}
+		inviter.CommissionBalance += net[inviteUserID]
+		if err := userRepo.Update(inviter); err != nil {
+			return 0, err
+		}
+		actual += net[inviteUserID]
+	}
+	if err := commissionRepo.UpdateStatusByTradeNo(tradeNo, model.CommissionStatusPending, model.CommissionStatusConfirmed); err != nil {
+		return 0, err
 	}
+	return model.CommissionStatusConfirmed, orderRepo.UpdateCommission(order.ID, model.CommissionStatusConfirmed, actual)
+}
 
-	// 更新邀请人佣金余额
-	inviter, _ := s.userRepo.FindByID(*user.InviteUserID)
-	if inviter != nil {
-		inviter.CommissionBalance += commission
-		s.userRepo.Update(inviter)
+// SetUserCommission 设置用户返佣类型与个人返佣比例
+func (s *InviteService) SetUserCommission(userID int64, commissionType int, rate *int) error {
+	switch commissionType {
+	case model.CommissionTypeSystem, model.CommissionTypeCycle, model.CommissionTypeOnetime:
+	default:
+		return errors.New("invalid commission type")
+	}
+	if rate != nil && (*rate < 0 || *rate > 100) {
+		return errors.New("commission rate must be between 0 and 100")
 	}
 
-	return nil
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return errors.New("user not found")
+	}
+	user.CommissionType = commissionType
+	user.CommissionRate = rate
+	return s.userRepo.Update(user)
 }
 
 // GetCommissionLogs 获取佣金记录
@@ -165,22 +352,28 @@ func (s *InviteService) GetCommissionLogs(userID int64, page, pageSize int) ([]m
 	return s.commissionRepo.FindByInviteUserID(userID, page, pageSize)
 }
 
-// WithdrawCommission 提现佣金
+// WithdrawCommission 佣金转入余额
+// 加锁后只更新佣金余额与余额两列，避免覆盖并发提现申请冻结的佣金
 func (s *InviteService) WithdrawCommission(userID int64, amount int64) error {
-	user, err := s.userRepo.FindByID(userID)
-	if err != nil {
-		return err
+	if amount <= 0 {
+		return errors.New("invalid amount")
 	}
-
-	if user.CommissionBalance < amount {
-		return errors.New("insufficient commission balance")
-	}
-
-	// 转入余额
-	user.CommissionBalance -= amount
-	user.Balance += amount
-
-	return s.userRepo.Update(user)
+	return s.userRepo.Transaction(func(tx *gorm.DB) error {
+		user, err := s.userRepo.WithTx(tx).FindByIDForUpdate(userID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return errors.New("user not found")
+		}
+		if user.CommissionBalance < amount {
+			return errors.New("insufficient commission balance")
+		}
+		return tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"commission_balance": gorm.Expr("commission_balance - ?", amount),
+			"balance":            gorm.Expr("balance + ?", amount),
+		}).Error
+	})
 }
 
 // GetInviteStats 获取邀请统计
@@ -188,8 +381,9 @@ func (s *InviteService) GetInviteStats(userID int64) (map[string]interface{}, er
 	// 获取邀请人数
 	invitedCount, _ := s.userRepo.CountByInviteUserID(userID)
 
-	// 获取佣金统计
-	totalCommission, _ := s.commissionRepo.SumByInviteUserID(userID)
+	// 获取佣金统计：已发放与持有期内待确认分别统计
+	totalCommission, _ := s.commissionRepo.SumByStatus(userID, model.CommissionStatusConfirmed)
+	pendingCommission, _ := s.commissionRepo.SumByStatus(userID, model.CommissionStatusPending)
 
 	// 获取用户佣金余额
 	user, _ := s.userRepo.FindByID(userID)
@@ -198,9 +392,23 @@ func (s *InviteService) GetInviteStats(userID int64) (map[string]interface{}, er
 		commissionBalance = user.CommissionBalance
 	}
 
+	// 各层级下线人数与佣金
+	tierCommission, _ := s.commissionRepo.SumByTier(userID)
+	downline := make([]map[string]interface{}, 0, maxCommissionTiers)
+	for tier := 1; tier <= maxCommissionTiers; tier++ {
+		count, _ := s.userRepo.CountDownline(userID, tier)
+		downline = append(downline, map[string]interface{}{
+			"tier":       tier,
+			"users":      count,
+			"commission": tierCommission[tier],
+		})
+	}
+
 	return map[string]interface{}{
 		"invited_count":      invitedCount,
 		"total_commission":   totalCommission,
+		"pending_commission": pendingCommission,
 		"commission_balance": commissionBalance,
+		"downline":           downline,
 	}, nil
 }
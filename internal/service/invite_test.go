@@ -0,0 +1,100 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestMultiLevelCommission(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.Coupon{}, &model.UserTrafficPack{}, &model.CommissionLog{}, &model.Setting{})
+
+	price := int64(1000)
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100, MonthPrice: &price}
+	db.Create(plan)
+
+	// root -> alice -> bob -> carol
+	personalRate := 30
+	root := &model.User{Email: "root@example.com", UUID: "u0", Token: "t0", CommissionType: model.CommissionTypeOnetime}
+	db.Create(root)
+	alice := &model.User{Email: "alice@example.com", UUID: "u1", Token: "t1", InviteUserID: &root.ID}
+	db.Create(alice)
+	bob := &model.User{Email: "bob@example.com", UUID: "u2", Token: "t2", InviteUserID: &alice.ID, CommissionType: model.CommissionTypeCycle, CommissionRate: &personalRate}
+	db.Create(bob)
+	carol := &model.User{Email: "carol@example.com", UUID: "u3", Token: "t3", InviteUserID: &bob.ID}
+	db.Create(carol)
+
+	repos := repository.NewRepositories(db)
+	settings := NewSettingService(repos.Setting, nil)
+	settings.Set(SettingCommissionRate, "20")
+	settings.Set(SettingCommissionRateTier2, "10")
+	settings.Set(SettingCommissionRateTier3, "5")
+	settings.Set(SettingCommissionFirstOrderOnly, "1")
+	settings.Set(SettingCommissionHoldDays, "3")
+
+	invite := NewInviteService(repos.InviteCode, repos.User, repos.CommissionLog, repos.Order)
+	invite.SetSettingService(settings)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+	orders.SetInviteService(invite)
+
+	buy := func() *model.Order {
+		order, err := orders.CreateOrderWithCoupon(carol.ID, plan.ID, model.PeriodMonthly, "", "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := orders.CompleteOrder(order.TradeNo, "cb_"+order.TradeNo); err != nil {
+			t.Fatal(err)
+		}
+		return order
+	}
+
+	// 首单：bob 按个人比例 30%，alice 二级 10%，root 三级 5%
+	buy()
+	// 续费：仅每单返佣的 bob 获得佣金
+	renewal := buy()
+
+	// 持有期内佣金待确认，不计入佣金余额
+	stats, err := invite.GetInviteStats(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["pending_commission"] != int64(600) || stats["commission_balance"] != int64(0) {
+		t.Errorf("bob before hold period: %v", stats)
+	}
+	if confirmed, _, _ := invite.ConfirmCommissions(); confirmed != 0 {
+		t.Errorf("confirmed %d orders within hold period", confirmed)
+	}
+
+	// 持有期满：续费订单已取消，佣金作废
+	db.Model(&model.Order{}).Where("id = ?", renewal.ID).Update("status", model.OrderStatusCancelled)
+	db.Model(&model.Order{}).Where("1 = 1").Update("paid_at", time.Now().Add(-4*24*time.Hour).Unix())
+	confirmed, cancelled, err := invite.ConfirmCommissions()
+	if err != nil || confirmed != 1 || cancelled != 1 {
+		t.Fatalf("confirm commissions: confirmed = %d, cancelled = %d, err = %v", confirmed, cancelled, err)
+	}
+
+	want := map[int64]int64{bob.ID: 300, alice.ID: 100, root.ID: 50}
+	for id, amount := range want {
+		got, _ := repos.User.FindByID(id)
+		if got.CommissionBalance != amount {
+			t.Errorf("user %d commission = %d, want %d", id, got.CommissionBalance, amount)
+		}
+	}
+
+	var logs []model.CommissionLog
+	db.Where("invite_user_id = ?", root.ID).Find(&logs)
+	if len(logs) != 1 || logs[0].Tier != 3 {
+		t.Errorf("root commission logs = %+v", logs)
+	}
+
+	stats, err = invite.GetInviteStats(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downline := stats["downline"].([]map[string]interface{})
+	if downline[0]["users"] != int64(1) || downline[1]["users"] != int64(1) || downline[1]["commission"] != int64(100) {
+		t.Errorf("alice downline = %v", downline)
+	}
+}
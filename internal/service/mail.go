@@ -7,6 +7,7 @@ import (
 	"html/template"
 	"net/smtp"
 	"strings"
+	"time"
 
 	"dashgo/internal/config"
 	"dashgo/internal/model"
@@ -161,6 +162,23 @@ func (s *MailService) SendExpireReminder(user *model.User, daysLeft int) error {
 	return s.SendMail(user.Email, subject, body)
 }
 
+// SendRenewalFailed 发送自动续费失败（余额不足）通知
+func (s *MailService) SendRenewalFailed(user *model.User, order *model.Order, daysLeft int) error {
+	subject := "自动续费失败提醒"
+	body := fmt.Sprintf(`
+		<div style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 600px; margin: 0 auto; padding: 40px 20px;">
+			<h2 style="color: #1a1a2e; margin-bottom: 20px;">自动续费失败</h2>
+			<p style="color: #666; font-size: 16px; line-height: 1.6;">您的账户余额不足，无法自动续费。订阅将在 <strong style="color: #e74c3c;">%d 天</strong>后到期。</p>
+			<div style="background: #f8f9fa; border-radius: 12px; padding: 20px; margin: 20px 0;">
+				<p style="margin: 8px 0; color: #666;"><span style="color: #999;">续费金额：</span>¥%.2f</p>
+				<p style="margin: 8px 0; color: #666;"><span style="color: #999;">账户余额：</span>¥%.2f</p>
+			</div>
+			<p style="color: #999; font-size: 14px;">请充值后等待下次自动续费，或手动支付续费订单。</p>
+		</div>
+	`, daysLeft, float64(order.TotalAmount)/100, float64(user.Balance)/100)
+	return s.SendMail(user.Email, subject, body)
+}
+
 // SendTrafficWarning 发送流量预告
 func (s *MailService) SendTrafficWarning(user *model.User, usedPercent int) error {
 	subject := "流量使用提醒"
@@ -194,6 +212,42 @@ func (s *MailService) SendOrderPaid(user *model.User, order *model.Order) error
 	return s.SendMail(user.Email, subject, body)
 }
 
+// SendWaitlistAvailable 发送候补套餐名额释放通知
+func (s *MailService) SendWaitlistAvailable(user *model.User, plan *model.Plan, reservedUntil int64) error {
+	subject := "候补套餐已有名额"
+	body := fmt.Sprintf(`
+		<div style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 600px; margin: 0 auto; padding: 40px 20px;">
+			<h2 style="color: #1a1a2e; margin-bottom: 20px;">候补套餐已有名额</h2>
+			<p style="color: #666; font-size: 16px; line-height: 1.6;">您候补的套餐 <strong>%s</strong> 已释放名额，我们为您保留至 <strong style="color: #e74c3c;">%s</strong>。</p>
+			<p style="color: #999; font-size: 14px;">超时未购买，名额将顺延给其他用户。</p>
+		</div>
+	`, plan.Name, time.Unix(reservedUntil, 0).Format("2006-01-02 15:04"))
+	return s.SendMail(user.Email, subject, body)
+}
+
+// SendWithdrawStatus 发送佣金提现状态通知
+func (s *MailService) SendWithdrawStatus(user *model.User, withdraw *model.CommissionWithdraw) error {
+	status := withdrawStatusText(withdraw.Status)
+	note := ""
+	if withdraw.AdminNote != nil && *withdraw.AdminNote != "" {
+		note = fmt.Sprintf(`<p style="margin: 8px 0; color: #666;"><span style="color: #999;">备注：</span>%s</p>`, template.HTMLEscapeString(*withdraw.AdminNote))
+	}
+	subject := "佣金提现" + status
+	body := fmt.Sprintf(`
+		<div style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 600px; margin: 0 auto; padding: 40px 20px;">
+			<h2 style="color: #1a1a2e; margin-bottom: 20px;">佣金提现%s</h2>
+			<div style="background: #f8f9fa; border-radius: 12px; padding: 20px; margin: 20px 0;">
+				<p style="margin: 8px 0; color: #666;"><span style="color: #999;">申请编号：</span>%d</p>
+				<p style="margin: 8px 0; color: #666;"><span style="color: #999;">提现金额：</span>¥%.2f</p>
+				<p style="margin: 8px 0; color: #666;"><span style="color: #999;">手续费：</span>¥%.2f</p>
+				<p style="margin: 8px 0; color: #666;"><span style="color: #999;">实际到账：</span>¥%.2f</p>
+				%s
+			</div>
+		</div>
+	`, status, withdraw.ID, float64(withdraw.Amount)/100, float64(withdraw.Fee)/100, float64(withdraw.ActualAmount)/100, note)
+	return s.SendMail(user.Email, subject, body)
+}
+
 // MailTemplate 邮件模板
 type MailTemplate struct {
 	Name    string
@@ -2,32 +2,139 @@ package service
 
 import (
 	"errors"
+	"log"
+	"math"
+	"strings"
 	"time"
 
 	"dashgo/internal/model"
 	"dashgo/internal/repository"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type OrderService struct {
-	orderRepo  *repository.OrderRepository
-	userRepo   *repository.UserRepository
-	planRepo   *repository.PlanRepository
-	couponRepo *repository.CouponRepository
+	orderRepo    *repository.OrderRepository
+	userRepo     *repository.UserRepository
+	planRepo     *repository.PlanRepository
+	couponRepo   *repository.CouponRepository
+	groupRepo    *repository.UserGroupRepository
+	packRepo     *repository.TrafficPackRepository
+	userPackRepo *repository.UserTrafficPackRepository
+	settingSvc   *SettingService
+	waitlist     *WaitlistService
+	invite       *InviteService
+	planSvc      *PlanService
 }
 
-func NewOrderService(orderRepo *repository.OrderRepository, userRepo *repository.UserRepository, planRepo *repository.PlanRepository, couponRepo *repository.CouponRepository) *OrderService {
+func NewOrderService(orderRepo *repository.OrderRepository, userRepo *repository.UserRepository, planRepo *repository.PlanRepository, couponRepo *repository.CouponRepository, groupRepo *repository.UserGroupRepository, packRepo *repository.TrafficPackRepository, userPackRepo *repository.UserTrafficPackRepository) *OrderService {
 	return &OrderService{
-		orderRepo:  orderRepo,
-		userRepo:   userRepo,
-		planRepo:   planRepo,
-		couponRepo: couponRepo,
+		orderRepo:    orderRepo,
+		userRepo:     userRepo,
+		planRepo:     planRepo,
+		couponRepo:   couponRepo,
+		groupRepo:    groupRepo,
+		packRepo:     packRepo,
+		userPackRepo: userPackRepo,
 	}
 }
 
-// CreateOrderWithCoupon 创建订单（带优惠券）
-func (s *OrderService) CreateOrderWithCoupon(userID, planID int64, period string, couponCode string) (*model.Order, error) {
+// SetSettingService 设置 SettingService（基础币种与汇率）
+func (s *OrderService) SetSettingService(settingSvc *SettingService) {
+	s.settingSvc = settingSvc
+}
+
+// SetWaitlistService 设置候补服务（限量套餐的保留名额）
+func (s *OrderService) SetWaitlistService(waitlist *WaitlistService) {
+	s.waitlist = waitlist
+}
+
+// SetPlanService 设置套餐服务（释放名额时通知候补用户）
+func (s *OrderService) SetPlanService(planSvc *PlanService) {
+	s.planSvc = planSvc
+}
+
+// SetInviteService 设置邀请服务（订单完成时发放佣金）
+func (s *OrderService) SetInviteService(invite *InviteService) {
+	s.invite = invite
+}
+
+// canTakeSeat 检查用户能否占用限量套餐的名额
+func (s *OrderService) canTakeSeat(plan *model.Plan, userID int64) bool {
+	if s.waitlist != nil {
+		return s.waitlist.CanPurchase(plan, userID)
+	}
+	return plan.CanPurchase()
+}
+
+// baseCurrency 基础币种
+func (s *OrderService) baseCurrency() string {
+	if s.settingSvc == nil {
+		return "CNY"
+	}
+	return s.settingSvc.BaseCurrency()
+}
+
+// orderCurrency 订单币种，早期订单未记录币种时为基础币种
+func (s *OrderService) orderCurrency(order *model.Order) string {
+	if order.Currency == "" {
+		return s.baseCurrency()
+	}
+	return order.Currency
+}
+
+// currencyRate 获取下单币种的汇率，为空时使用基础币种
+// 未配置汇率的外币返回 0，只能按套餐外币定价下单
+func (s *OrderService) currencyRate(currency string) (string, float64) {
+	base := s.baseCurrency()
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" || currency == base {
+		return base, 1
+	}
+	if s.settingSvc == nil {
+		return currency, 0
+	}
+	return currency, s.settingSvc.CurrencyRates()[currency]
+}
+
+// convertAmount 将基础币种金额按汇率折算
+func convertAmount(amount int64, rate float64) int64 {
+	if rate == 1 {
+		return amount
+	}
+	return int64(math.Round(float64(amount) * rate))
+}
+
+// OrderQuote 订单金额明细（结算页展示），金额均为下单币种
+type OrderQuote struct {
+	PlanID              int64   `json:"plan_id"`
+	Period              string  `json:"period"`
+	Type                int     `json:"type"`
+	Currency            string  `json:"currency"`
+	CurrencyRate        float64 `json:"currency_rate"`
+	Price               int64   `json:"price"`                 // 套餐原价
+	GroupDiscountAmount int64   `json:"group_discount_amount"` // 用户组价格优惠，为负表示加价
+	UserDiscountAmount  int64   `json:"user_discount_amount"`  // 用户折扣
+	DiscountAmount      int64   `json:"discount_amount"`       // 优惠券抵扣
+	SurplusAmount       int64   `json:"surplus_amount"`        // 旧订单剩余价值抵扣（升级）
+	SurplusOrderIDs     []int64 `json:"surplus_order_ids"`     // 被折抵的旧订单
+	TotalAmount         int64   `json:"total_amount"`          // 订单金额
+	BalanceAmount       int64   `json:"balance_amount"`        // 余额抵扣
+	PayAmount           int64   `json:"pay_amount"`            // 余额抵扣后应付金额（不含手续费）
+	CouponID            *int64  `json:"-"`
+}
+
+// Quote 按定价流水线计算订单金额，每一步作用于上一步的结果：
+//  1. 套餐原价：外币订单优先使用套餐外币定价，否则按汇率折算
+//  2. 用户组价格：用户所在组为该套餐周期设置了覆盖价格时替换原价
+//  3. 用户折扣：按 User.Discount 百分比减免
+//  4. 优惠券：固定金额或百分比，百分比按前一步金额计算
+//  5. 升级折抵：旧订单未使用部分的价值
+//  6. 余额抵扣：useBalance 为 true 时使用账户余额抵扣剩余金额
+//
+// 每一步的金额分别记录在订单对应字段中，订单金额 = 原价 - 各项优惠（不含余额抵扣）
+func (s *OrderService) Quote(userID, planID int64, period string, couponCode string, currency string, useBalance bool) (*OrderQuote, error) {
 	// 获取套餐
 	plan, err := s.planRepo.FindByID(planID)
 	if err != nil {
@@ -35,20 +142,29 @@ func (s *OrderService) CreateOrderWithCoupon(userID, planID int64, period string
 	}
 
 	// 获取价格
-	price := plan.GetPriceByPeriod(period)
-	if price <= 0 {
+	basePrice := plan.GetPriceByPeriod(period)
+	if basePrice <= 0 {
 		return nil, errors.New("invalid period")
 	}
 
 	// 获取用户
 	user, err := s.userRepo.FindByID(userID)
-	if err != nil {
+	if err != nil || user == nil {
 		return nil, errors.New("user not found")
 	}
 
 	// 确定订单类型
 	orderType := model.OrderTypeNewPurchase
-	if user.PlanID != nil {
+	if period == model.PeriodResetTraffic {
+		// 流量重置仅限当前有效套餐
+		if !hasActivePlan(user) {
+			return nil, errors.New("no active plan to reset traffic")
+		}
+		if *user.PlanID != planID {
+			return nil, errors.New("traffic reset is only available for the current plan")
+		}
+		orderType = model.OrderTypeResetTraffic
+	} else if user.PlanID != nil {
 		if *user.PlanID == planID {
 			orderType = model.OrderTypeRenewal
 		} else {
@@ -56,28 +172,217 @@ func (s *OrderService) CreateOrderWithCoupon(userID, planID int64, period string
 		}
 	}
 
-	// 处理优惠告
-	var discountAmount int64
-	var couponID *int64
+	// 新购或更换套餐需要占用名额，续费沿用已有名额
+	if (orderType == model.OrderTypeNewPurchase || orderType == model.OrderTypeUpgrade) && !s.canTakeSeat(plan, userID) {
+		return nil, errors.New("plan is sold out")
+	}
+
+	// 1. 套餐原价
+	price := basePrice
+	currency, rate := s.currencyRate(currency)
+	if p := plan.GetCurrencyPrice(currency, period); p > 0 && currency != s.baseCurrency() {
+		if rate == 0 {
+			// 未配置汇率时按定价推算，用于折算收入
+			rate = float64(p) / float64(basePrice)
+		}
+		price = p
+	} else if rate == 0 {
+		return nil, errors.New("unsupported currency")
+	} else {
+		price = convertAmount(basePrice, rate)
+	}
+
+	quote := &OrderQuote{
+		PlanID:          planID,
+		Period:          period,
+		Type:            orderType,
+		Currency:        currency,
+		CurrencyRate:    rate,
+		Price:           price,
+		SurplusOrderIDs: []int64{},
+	}
+	amount := price
+
+	// 2. 用户组价格
+	if user.GroupID != nil && s.groupRepo != nil {
+		if group, err := s.groupRepo.FindByID(*user.GroupID); err == nil {
+			if groupPrice := group.GetPlanPrice(planID, period); groupPrice > 0 {
+				quote.GroupDiscountAmount = amount - convertAmount(groupPrice, rate)
+				amount -= quote.GroupDiscountAmount
+			}
+		}
+	}
+
+	// 3. 用户折扣
+	if user.Discount != nil && *user.Discount > 0 && *user.Discount <= 100 {
+		quote.UserDiscountAmount = int64(math.Round(float64(amount) * float64(*user.Discount) / 100))
+		amount -= quote.UserDiscountAmount
+	}
+
+	// 4. 优惠券
 	if couponCode != "" && s.couponRepo != nil {
 		coupon, err := s.couponRepo.FindByCode(couponCode)
 		if err == nil {
-			// 验证优惠告
+			// 验证优惠券
 			now := time.Now().Unix()
 			if coupon.StartedAt <= now && coupon.EndedAt >= now {
 				// 计算折扣
 				switch coupon.Type {
-				case 1: // 固定金额
-					discountAmount = coupon.Value
-				case 2: // 百分告
-					discountAmount = price * coupon.Value / 100
+				case model.CouponTypeAmount: // 固定金额（基础币种）
+					quote.DiscountAmount = convertAmount(coupon.Value, rate)
+				case model.CouponTypePercent:
+					quote.DiscountAmount = amount * coupon.Value / 100
 				}
-				if discountAmount > price {
-					discountAmount = price
+				if quote.DiscountAmount > amount {
+					quote.DiscountAmount = amount
 				}
-				couponID = &coupon.ID
+				amount -= quote.DiscountAmount
+				quote.CouponID = &coupon.ID
+			}
+		}
+	}
+
+	// 5. 升级：旧订单未使用部分折抵新订单
+	if orderType == model.OrderTypeUpgrade {
+		surplus, orderIDs, err := s.getSurplus(user)
+		if err != nil {
+			return nil, err
+		}
+		surplus = convertAmount(surplus, rate)
+		if surplus > amount {
+			surplus = amount
+		}
+		quote.SurplusAmount = surplus
+		quote.SurplusOrderIDs = orderIDs
+		amount -= surplus
+	}
+	quote.TotalAmount = amount
+
+	// 6. 余额抵扣
+	if useBalance {
+		quote.BalanceAmount = balanceDeduction(user.Balance, amount, rate)
+	}
+	quote.PayAmount = amount - quote.BalanceAmount
+	return quote, nil
+}
+
+// balanceDeduction 计算可用余额（基础币种）可抵扣的订单金额（下单币种）
+func balanceDeduction(balance, amount int64, rate float64) int64 {
+	if balance <= 0 || amount <= 0 {
+		return 0
+	}
+	available := int64(float64(balance) * rate)
+	if available > amount {
+		return amount
+	}
+	return available
+}
+
+// hasActivePlan 用户是否有未过期的套餐（到期时间为空或 0 表示不限期）
+func hasActivePlan(user *model.User) bool {
+	if user.PlanID == nil {
+		return false
+	}
+	return user.ExpiredAt == nil || *user.ExpiredAt == 0 || *user.ExpiredAt > time.Now().Unix()
+}
+
+// getSurplus 计算用户当前套餐未使用部分的价值（基础币种）
+// 周期套餐从最近的订单向前按剩余时间逐笔折算：尚未开始的续费订单全额折抵，
+// 生效中的订单按剩余时间与剩余流量各占一半折算；一次性套餐按最近订单的剩余流量折算
+func (s *OrderService) getSurplus(user *model.User) (int64, []int64, error) {
+	orders, err := s.orderRepo.FindCompletedByUserID(user.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	onetime := user.ExpiredAt == nil || *user.ExpiredAt == 0
+	trafficRatio := 0.0
+	if user.TransferEnable > 0 {
+		trafficRatio = float64(user.TransferEnable-user.U-user.D) / float64(user.TransferEnable)
+	}
+	trafficRatio = math.Min(math.Max(trafficRatio, 0), 1)
+
+	var remaining int64
+	if !onetime {
+		remaining = *user.ExpiredAt - time.Now().Unix()
+	}
+
+	var surplus int64
+	orderIDs := make([]int64, 0)
+	for i := len(orders) - 1; i >= 0; i-- {
+		o := orders[i]
+		if !isPlanOrder(&o) || (o.Period == model.PeriodOnetime) != onetime {
+			continue
+		}
+		value := orderValue(&o)
+
+		if onetime {
+			// 一次性套餐新购时重置流量，只有最近一笔订单仍在使用
+			if credit := int64(float64(value) * trafficRatio); credit > 0 {
+				surplus = credit
+				orderIDs = append(orderIDs, o.ID)
 			}
+			break
 		}
+
+		if remaining <= 0 {
+			break
+		}
+		period := int64(model.GetPeriodDays(o.Period)) * 86400
+		if period <= 0 {
+			continue
+		}
+		if remaining >= period {
+			surplus += value
+		} else {
+			timeRatio := float64(remaining) / float64(period)
+			surplus += int64(float64(value) * (timeRatio + trafficRatio) / 2)
+		}
+		orderIDs = append(orderIDs, o.ID)
+		remaining -= period
+		// 升级订单从开通时起算，更早的订单已折抵
+		if o.Type == model.OrderTypeUpgrade {
+			break
+		}
+	}
+	if surplus <= 0 {
+		return 0, []int64{}, nil
+	}
+	return surplus, orderIDs, nil
+}
+
+// isPlanOrder 是否为开通套餐的订单（新购、续费、升级），流量重置与流量包不计入套餐价值
+func isPlanOrder(o *model.Order) bool {
+	switch o.Type {
+	case model.OrderTypeNewPurchase, model.OrderTypeRenewal, model.OrderTypeUpgrade:
+		return true
+	}
+	return false
+}
+
+// orderValue 订单实际价值（基础币种）：实付 + 该订单自身获得的折抵 - 已退款
+func orderValue(o *model.Order) int64 {
+	amount := o.TotalAmount
+	if o.SurplusAmount != nil {
+		amount += *o.SurplusAmount
+	}
+	if o.RefundAmount != nil {
+		amount -= *o.RefundAmount
+	}
+	return o.ToBase(amount)
+}
+
+// CreateOrderWithCoupon 创建订单（带优惠券），currency 为空时使用基础币种
+// useBalance 为 true 时下单即扣除余额，余额足额抵扣时订单直接完成，取消订单时退回
+func (s *OrderService) CreateOrderWithCoupon(userID, planID int64, period string, couponCode string, currency string, useBalance bool) (*model.Order, error) {
+	quote, err := s.Quote(userID, planID, period, couponCode, currency, useBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
 	}
 
 	order := &model.Order{
@@ -85,86 +390,146 @@ func (s *OrderService) CreateOrderWithCoupon(userID, planID int64, period string
 		PlanID:         planID,
 		Period:         period,
 		TradeNo:        uuid.New().String(),
-		TotalAmount:    price - discountAmount,
-		DiscountAmount: &discountAmount,
-		CouponID:       couponID,
-		Type:           orderType,
+		Currency:       quote.Currency,
+		CurrencyRate:   quote.CurrencyRate,
+		PlanAmount:     &quote.Price,
+		TotalAmount:    quote.TotalAmount,
+		DiscountAmount: &quote.DiscountAmount,
+		CouponID:       quote.CouponID,
+		Type:           quote.Type,
 		Status:         model.OrderStatusPending,
 		CreatedAt:      time.Now().Unix(),
 		UpdatedAt:      time.Now().Unix(),
 	}
+	if quote.GroupDiscountAmount != 0 {
+		order.GroupDiscountAmount = &quote.GroupDiscountAmount
+	}
+	if quote.UserDiscountAmount > 0 {
+		order.UserDiscountAmount = &quote.UserDiscountAmount
+	}
+
+	// 记录升级折抵
+	if quote.SurplusAmount > 0 {
+		surplusOrderIDs := make(model.JSONArray, len(quote.SurplusOrderIDs))
+		for i, id := range quote.SurplusOrderIDs {
+			surplusOrderIDs[i] = id
+		}
+		order.SurplusAmount = &quote.SurplusAmount
+		order.SurplusOrderIDs = surplusOrderIDs
+	}
 
 	// 设置邀请人
 	if user.InviteUserID != nil {
 		order.InviteUserID = user.InviteUserID
 	}
 
-	if err := s.orderRepo.Create(order); err != nil {
+	if useBalance {
+		if err := s.createWithBalance(order); err != nil {
+			return nil, err
+		}
+		if order.DueAmount() == 0 {
+			// 余额已足额抵扣，订单已完成
+			if completed, err := s.orderRepo.FindByID(order.ID); err == nil {
+				order = completed
+			}
+		}
+	} else if err := s.orderRepo.Create(order); err != nil {
 		return nil, err
 	}
 
 	// 记录优惠券使告
-	if couponID != nil && s.couponRepo != nil {
-		s.couponRepo.RecordUsage(*couponID, order.ID, userID)
+	if quote.CouponID != nil && s.couponRepo != nil {
+		s.couponRepo.RecordUsage(*quote.CouponID, order.ID, userID)
 	}
 
 	return order, nil
 }
 
-// CreateOrder 创建订单
-func (s *OrderService) CreateOrder(userID, planID int64, period string) (*model.Order, error) {
-	// 获取套餐
-	plan, err := s.planRepo.FindByID(planID)
+// createWithBalance 在同一事务中扣除余额并创建订单，足额抵扣时直接完成订单
+// 余额以加锁后的最新值重新计算，可能少于报价时的抵扣金额
+func (s *OrderService) createWithBalance(order *model.Order) error {
+	var released int64
+	err := s.orderRepo.Transaction(func(tx *gorm.DB) error {
+		userRepo := s.userRepo.WithTx(tx)
+		user, err := userRepo.FindByIDForUpdate(order.UserID)
+		if err != nil || user == nil {
+			return errors.New("user not found")
+		}
+
+		if amount := balanceDeduction(user.Balance, order.TotalAmount, order.CurrencyRate); amount > 0 {
+			order.BalanceAmount = &amount
+			user.Balance -= order.ToBase(amount)
+			if err := userRepo.Update(user); err != nil {
+				return err
+			}
+		}
+		if err := s.orderRepo.WithTx(tx).Create(order); err != nil {
+			return err
+		}
+		if order.BalanceAmount != nil && order.DueAmount() == 0 {
+			var err error
+			released, err = s.completeOrder(tx, order.TradeNo, "balance_"+order.TradeNo)
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errors.New("plan not found")
+		return err
 	}
+	s.releaseSeat(released)
+	return nil
+}
 
-	// 获取价格
-	price := plan.GetPriceByPeriod(period)
-	if price <= 0 {
-		return nil, errors.New("invalid period")
+// CreateTrafficPackOrder 创建流量包订单，仅限有有效套餐且套餐限流量的用户
+// 外币订单按汇率折算流量包价格
+func (s *OrderService) CreateTrafficPackOrder(userID, packID int64, currency string) (*model.Order, error) {
+	pack, err := s.packRepo.FindByID(packID)
+	if err != nil || !pack.Sell {
+		return nil, errors.New("traffic pack not available")
+	}
+
+	currency, rate := s.currencyRate(currency)
+	if rate == 0 {
+		return nil, errors.New("unsupported currency")
 	}
 
-	// 获取用户
 	user, err := s.userRepo.FindByID(userID)
-	if err != nil {
+	if err != nil || user == nil {
 		return nil, errors.New("user not found")
 	}
-
-	// 确定订单类型
-	orderType := model.OrderTypeNewPurchase
-	if user.PlanID != nil {
-		if *user.PlanID == planID {
-			orderType = model.OrderTypeRenewal
-		} else {
-			orderType = model.OrderTypeUpgrade
-		}
+	if !hasActivePlan(user) {
+		return nil, errors.New("no active plan for traffic pack")
 	}
-
-	order := &model.Order{
-		UserID:      userID,
-		PlanID:      planID,
-		Period:      period,
-		TradeNo:     uuid.New().String(),
-		TotalAmount: price,
-		Type:        orderType,
-		Status:      model.OrderStatusPending,
-		CreatedAt:   time.Now().Unix(),
-		UpdatedAt:   time.Now().Unix(),
+	if user.TransferEnable == 0 {
+		return nil, errors.New("current plan has unlimited traffic")
 	}
 
-	// 设置邀请人
-	if user.InviteUserID != nil {
-		order.InviteUserID = user.InviteUserID
+	order := &model.Order{
+		UserID:        userID,
+		PlanID:        *user.PlanID,
+		TrafficPackID: &pack.ID,
+		Period:        model.PeriodTrafficPack,
+		TradeNo:       uuid.New().String(),
+		Currency:      currency,
+		CurrencyRate:  rate,
+		TotalAmount:   convertAmount(pack.Price, rate),
+		Type:          model.OrderTypeTrafficPack,
+		Status:        model.OrderStatusPending,
+		InviteUserID:  user.InviteUserID,
+		CreatedAt:     time.Now().Unix(),
+		UpdatedAt:     time.Now().Unix(),
 	}
-
 	if err := s.orderRepo.Create(order); err != nil {
 		return nil, err
 	}
-
 	return order, nil
 }
 
+// CreateOrder 创建订单（基础币种）
+func (s *OrderService) CreateOrder(userID, planID int64, period string) (*model.Order, error) {
+	return s.CreateOrderWithCoupon(userID, planID, period, "", "", false)
+}
+
 // GetByID 根据 ID 获取订单
 func (s *OrderService) GetByID(id int64) (*model.Order, error) {
 	return s.orderRepo.FindByID(id)
@@ -191,52 +556,244 @@ func (s *OrderService) CancelOrder(orderID int64, userID int64) error {
 		return errors.New("permission denied")
 	}
 
-	if order.Status != model.OrderStatusPending {
-		return errors.New("order cannot be cancelled")
+	return s.cancelOrder(order.TradeNo)
+}
+
+// CancelExpiredOrders 取消超时未支付的订单，使用了余额抵扣的订单逐个取消并退回余额
+func (s *OrderService) CancelExpiredOrders(expireSeconds int64) (int64, error) {
+	orders, err := s.orderRepo.FindExpiredWithBalance(expireSeconds)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, order := range orders {
+		if err := s.cancelOrder(order.TradeNo); err != nil {
+			log.Printf("[Order] Failed to cancel expired order %s: %v", order.TradeNo, err)
+			continue
+		}
+		count++
 	}
 
-	order.Status = model.OrderStatusCancelled
-	return s.orderRepo.Update(order)
+	n, err := s.orderRepo.CancelExpiredOrders(expireSeconds)
+	return count + n, err
 }
 
-// CompleteOrder 完成订单（支付成功后调用告
+// cancelOrder 加锁后取消待支付订单，并退回下单时抵扣的余额
+func (s *OrderService) cancelOrder(tradeNo string) error {
+	return s.orderRepo.Transaction(func(tx *gorm.DB) error {
+		orderRepo := s.orderRepo.WithTx(tx)
+		order, err := orderRepo.FindByTradeNoForUpdate(tradeNo)
+		if err != nil {
+			return errors.New("order not found")
+		}
+		if order.Status != model.OrderStatusPending {
+			return errors.New("order cannot be cancelled")
+		}
+
+		if order.BalanceAmount != nil && *order.BalanceAmount > 0 {
+			userRepo := s.userRepo.WithTx(tx)
+			user, err := userRepo.FindByIDForUpdate(order.UserID)
+			if err != nil || user == nil {
+				return errors.New("user not found")
+			}
+			user.Balance += order.ToBase(*order.BalanceAmount)
+			if err := userRepo.Update(user); err != nil {
+				return err
+			}
+		}
+
+		order.Status = model.OrderStatusCancelled
+		return orderRepo.Update(order)
+	})
+}
+
+// ErrOrderProcessed 订单已处理（重复的支付通知）
+var ErrOrderProcessed = errors.New("order already processed")
+
+// CompleteOrder 完成订单（支付成功后调用）
+// 在同一事务中锁定订单后开通套餐，重复或并发的支付通知只会生效一次
 func (s *OrderService) CompleteOrder(tradeNo string, callbackNo string) error {
-	order, err := s.orderRepo.FindByTradeNo(tradeNo)
+	var released int64
+	err := s.orderRepo.Transaction(func(tx *gorm.DB) error {
+		var err error
+		released, err = s.completeOrder(tx, tradeNo, callbackNo)
+		return err
+	})
 	if err != nil {
-		return errors.New("order not found")
+		return err
 	}
+	s.releaseSeat(released)
+	return nil
+}
 
-	if order.Status != model.OrderStatusPending {
-		return errors.New("order already processed")
+// releaseSeat 事务提交后释放原套餐名额并通知候补用户
+// 释放前名额多计一个，只会少卖不会超卖
+func (s *OrderService) releaseSeat(planID int64) {
+	if planID == 0 {
+		return
+	}
+	var err error
+	if s.planSvc != nil {
+		err = s.planSvc.DecrementSoldCount(planID)
+	} else {
+		err = s.planRepo.DecrementSoldCount(planID)
 	}
+	if err != nil {
+		log.Printf("[Order] Failed to release seat of plan %d: %v", planID, err)
+	}
+}
 
-	// 获取套餐
-	plan, err := s.planRepo.FindByID(order.PlanID)
+// completeOrder 在事务中开通订单，返回需在事务提交后释放名额的原套餐 ID
+func (s *OrderService) completeOrder(tx *gorm.DB, tradeNo string, callbackNo string) (int64, error) {
+	orderRepo := s.orderRepo.WithTx(tx)
+	userRepo := s.userRepo.WithTx(tx)
+	userPackRepo := s.userPackRepo.WithTx(tx)
+
+	order, err := orderRepo.FindByTradeNoForUpdate(tradeNo)
 	if err != nil {
-		return errors.New("plan not found")
+		return 0, errors.New("order not found")
 	}
 
-	// 获取用户
-	user, err := s.userRepo.FindByID(order.UserID)
+	if order.Status != model.OrderStatusPending {
+		return 0, ErrOrderProcessed
+	}
+
+	// 获取用户（加锁，避免与流量上报等并发写入互相覆盖）
+	user, err := userRepo.FindByIDForUpdate(order.UserID)
+	if err != nil || user == nil {
+		return 0, errors.New("user not found")
+	}
+
+	// 流量重置：只清零已用流量，不改变套餐与到期时间
+	if order.Type == model.OrderTypeResetTraffic {
+		if err := settleTrafficPacks(userPackRepo, user, true); err != nil {
+			return 0, err
+		}
+		user.U = 0
+		user.D = 0
+		if err := userRepo.Update(user); err != nil {
+			return 0, err
+		}
+		return 0, s.finishOrder(tx, order, callbackNo)
+	}
+
+	// 流量包：叠加到套餐流量之上，不改变套餐与到期时间
+	if order.Type == model.OrderTypeTrafficPack {
+		if err := s.grantTrafficPack(userPackRepo, user, order); err != nil {
+			return 0, err
+		}
+		if err := userRepo.Update(user); err != nil {
+			return 0, err
+		}
+		return 0, s.finishOrder(tx, order, callbackNo)
+	}
+
+	// 获取套餐
+	plan, err := s.planRepo.FindByID(order.PlanID)
 	if err != nil {
-		return errors.New("user not found")
+		return 0, errors.New("plan not found")
 	}
 
-	// 计算过期时间
+	// 计算过期时间（升级时旧套餐剩余时间已折抵，从当前时间开始计算）
 	days := model.GetPeriodDays(order.Period)
 	var expiredAt int64
 	if days > 0 {
-		if user.ExpiredAt != nil && *user.ExpiredAt > time.Now().Unix() {
+		if order.Type != model.OrderTypeUpgrade && user.ExpiredAt != nil && *user.ExpiredAt > time.Now().Unix() {
 			expiredAt = *user.ExpiredAt + int64(days*86400)
 		} else {
 			expiredAt = time.Now().Unix() + int64(days*86400)
 		}
 	}
 
+	// 新购或升级会清零已用流量，先按原套餐流量结算流量包用量
+	resetUsage := order.Type == model.OrderTypeNewPurchase || order.Type == model.OrderTypeUpgrade
+	if resetUsage {
+		if err := settleTrafficPacks(userPackRepo, user, true); err != nil {
+			return 0, err
+		}
+	}
+
+	// 占用新套餐名额，原套餐名额在事务提交后释放并通知候补
+	var released int64
+	if resetUsage {
+		if err := s.planRepo.WithTx(tx).IncrementSoldCount(plan.ID); err != nil {
+			return 0, err
+		}
+		if user.PlanID != nil && *user.PlanID != plan.ID {
+			released = *user.PlanID
+		}
+		if s.waitlist != nil {
+			if err := s.waitlist.MarkPurchased(tx, plan.ID, user.ID); err != nil {
+				return 0, err
+			}
+		}
+	}
+
 	// 更新用户
-	user.PlanID = &order.PlanID
+	applyPlan(user, plan)
+	if days > 0 {
+		user.ExpiredAt = &expiredAt
+	} else if days < 0 && order.Type == model.OrderTypeUpgrade {
+		// 升级为一次性套餐，不再有到期时间
+		user.ExpiredAt = nil
+	}
+
+	// 重置流量（新购或升级）
+	if resetUsage {
+		user.U = 0
+		user.D = 0
+	}
 
-	// 如果套餐配置了升级组，则升级用户告
+	if err := userRepo.Update(user); err != nil {
+		return 0, err
+	}
+
+	// 升级：标记被折抵的旧套餐订单，流量包与流量重置订单不参与折抵
+	for _, id := range order.GetSurplusOrderIDsAsInt64() {
+		old, err := orderRepo.FindByID(id)
+		if err != nil || old.UserID != order.UserID || old.Status != model.OrderStatusCompleted || !isPlanOrder(old) {
+			continue
+		}
+		old.Status = model.OrderStatusDiscounted
+		if err := orderRepo.Update(old); err != nil {
+			return 0, err
+		}
+	}
+
+	return released, s.finishOrder(tx, order, callbackNo)
+}
+
+// grantTrafficPack 为用户开通订单对应的流量包
+func (s *OrderService) grantTrafficPack(userPackRepo *repository.UserTrafficPackRepository, user *model.User, order *model.Order) error {
+	if order.TrafficPackID == nil {
+		return errors.New("traffic pack not found")
+	}
+	pack, err := s.packRepo.FindByID(*order.TrafficPackID)
+	if err != nil {
+		return errors.New("traffic pack not found")
+	}
+
+	traffic := pack.Traffic * 1024 * 1024 * 1024 // GB to Bytes
+	if err := userPackRepo.Create(&model.UserTrafficPack{
+		UserID:    user.ID,
+		PackID:    &pack.ID,
+		OrderID:   &order.ID,
+		Traffic:   traffic,
+		ExpiredAt: time.Now().Unix() + int64(pack.Days*86400),
+		Status:    model.TrafficPackActive,
+	}); err != nil {
+		return err
+	}
+	user.PackTraffic += traffic
+	return nil
+}
+
+// applyPlan 为用户设置套餐、权限组、流量与限速限设备（不处理到期时间）
+func applyPlan(user *model.User, plan *model.Plan) {
+	user.PlanID = &plan.ID
+
+	// 如果套餐配置了升级组，则升级用户组
 	if plan.UpgradeGroupID != nil && *plan.UpgradeGroupID > 0 {
 		user.GroupID = plan.UpgradeGroupID
 	} else {
@@ -244,31 +801,30 @@ func (s *OrderService) CompleteOrder(tradeNo string, callbackNo string) error {
 	}
 
 	user.TransferEnable = plan.TransferEnable * 1024 * 1024 * 1024 // GB to Bytes
-	if days > 0 {
-		user.ExpiredAt = &expiredAt
-	}
 	if plan.SpeedLimit != nil {
 		user.SpeedLimit = plan.SpeedLimit
 	}
 	if plan.DeviceLimit != nil {
 		user.DeviceLimit = plan.DeviceLimit
 	}
+}
 
-	// 重置流量（新购或升级告
-	if order.Type == model.OrderTypeNewPurchase || order.Type == model.OrderTypeUpgrade {
-		user.U = 0
-		user.D = 0
-	}
-
-	if err := s.userRepo.Update(user); err != nil {
-		return err
+// finishOrder 发放邀请佣金并标记订单完成
+func (s *OrderService) finishOrder(tx *gorm.DB, order *model.Order, callbackNo string) error {
+	if s.invite != nil {
+		if _, err := s.invite.recordCommission(tx, order); err != nil {
+			return err
+		}
 	}
+	return markOrderCompleted(s.orderRepo.WithTx(tx), order, callbackNo)
+}
 
-	// 更新订单状告
+// markOrderCompleted 更新订单为已完成
+func markOrderCompleted(orderRepo *repository.OrderRepository, order *model.Order, callbackNo string) error {
 	now := time.Now().Unix()
 	order.Status = model.OrderStatusCompleted
 	order.PaidAt = &now
 	order.CallbackNo = &callbackNo
 
-	return s.orderRepo.Update(order)
+	return orderRepo.Update(order)
 }
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestCompleteOrderIdempotent(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.UserTrafficPack{})
+
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100}
+	db.Create(plan)
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1"}
+	db.Create(user)
+	order := &model.Order{UserID: user.ID, PlanID: plan.ID, Period: model.PeriodMonthly, TradeNo: "T1", TotalAmount: 1000, Type: model.OrderTypeNewPurchase}
+	db.Create(order)
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- orders.CompleteOrder("T1", "callback")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	completed := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			completed++
+		case ErrOrderProcessed:
+		default:
+			t.Errorf("CompleteOrder: %v", err)
+		}
+	}
+	if completed != 1 {
+		t.Fatalf("completed %d times, want 1", completed)
+	}
+
+	got, _ := repos.User.FindByID(user.ID)
+	want := int64(model.GetPeriodDays(model.PeriodMonthly) * 86400)
+	if got.ExpiredAt == nil || *got.ExpiredAt-got.CreatedAt > want+60 {
+		t.Errorf("subscription extended more than once: expired_at = %v", got.ExpiredAt)
+	}
+}
+
+func TestForeignCurrencyOrder(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.UserTrafficPack{})
+
+	price := int64(1000)
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100, MonthPrice: &price, CurrencyPrices: model.PriceTable{"USD": {model.PeriodMonthly: 150}}}
+	db.Create(plan)
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1", Balance: 1000}
+	db.Create(user)
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+	payments := NewPaymentService(repos.Payment, repos.Order, orders, repos.PaymentCallback)
+
+	// 未定价且未配置汇率的币种不可下单
+	if _, err := orders.Quote(user.ID, plan.ID, model.PeriodMonthly, "", "EUR", false); err == nil {
+		t.Error("quoted a currency without price or rate")
+	}
+
+	order, err := orders.CreateOrderWithCoupon(user.ID, plan.ID, model.PeriodMonthly, "", "usd", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Currency != "USD" || order.TotalAmount != 150 || order.ToBase(order.TotalAmount) != 1000 {
+		t.Fatalf("order: currency = %s, total = %d, rate = %v", order.Currency, order.TotalAmount, order.CurrencyRate)
+	}
+
+	// 余额以基础币种扣除
+	if err := payments.PayWithBalance(order.TradeNo, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := repos.User.FindByID(user.ID)
+	if got.Balance != 0 {
+		t.Errorf("balance = %d, want 0", got.Balance)
+	}
+
+	// 收入统计折算为基础币种
+	_, total, _ := repos.Order.GetDailyStats(0, order.CreatedAt+1)
+	if total != 1000 {
+		t.Errorf("revenue = %d, want 1000", total)
+	}
+}
+
+func TestOrderPricingPipeline(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.Coupon{}, &model.UserGroup{}, &model.UserTrafficPack{})
+
+	price := int64(1000)
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100, MonthPrice: &price}
+	db.Create(plan)
+	group := &model.UserGroup{Name: "partner", PlanPrices: model.PriceTable{strconv.FormatInt(plan.ID, 10): {model.PeriodMonthly: 800}}}
+	db.Create(group)
+	discount := 10
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1", GroupID: &group.ID, Discount: &discount, Balance: 100}
+	db.Create(user)
+	db.Create(&model.Coupon{Code: "HALF", Type: model.CouponTypePercent, Value: 50, EndedAt: time.Now().Add(time.Hour).Unix()})
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+
+	// 1000 -> 用户组 800 -> 用户九折 720 -> 优惠券五折 360 -> 余额抵扣 100
+	order, err := orders.CreateOrderWithCoupon(user.ID, plan.ID, model.PeriodMonthly, "HALF", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *order.PlanAmount != 1000 || *order.GroupDiscountAmount != 200 || *order.UserDiscountAmount != 80 ||
+		*order.DiscountAmount != 360 || order.TotalAmount != 360 || *order.BalanceAmount != 100 || order.PayAmount() != 260 {
+		t.Fatalf("unexpected breakdown: %+v", order)
+	}
+
+	// 取消订单退回余额
+	if err := orders.CancelOrder(order.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := repos.User.FindByID(user.ID)
+	if got.Balance != 100 {
+		t.Errorf("balance after cancel = %d, want 100", got.Balance)
+	}
+
+	// 余额足额抵扣时直接完成
+	db.Model(&model.User{}).Where("id = ?", user.ID).Update("balance", 1000)
+	order, err = orders.CreateOrderWithCoupon(user.ID, plan.ID, model.PeriodMonthly, "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = repos.User.FindByID(user.ID)
+	if order.Status != model.OrderStatusCompleted || got.Balance != 280 || got.PlanID == nil {
+		t.Errorf("status = %d, balance = %d", order.Status, got.Balance)
+	}
+}
+
+func TestUpgradeSurplus(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.UserTrafficPack{})
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100}
+	db.Create(plan)
+	// 剩余 15 天、已用四分之一流量
+	expiredAt := time.Now().Add(15 * 24 * time.Hour).Unix()
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1", PlanID: &plan.ID, ExpiredAt: &expiredAt, TransferEnable: 1000, U: 100, D: 150}
+	db.Create(user)
+	first := &model.Order{UserID: user.ID, PlanID: plan.ID, Period: model.PeriodMonthly, TradeNo: "T1", TotalAmount: 3000, Type: model.OrderTypeNewPurchase, Status: model.OrderStatusCompleted}
+	db.Create(first)
+	db.Create(&model.Order{UserID: user.ID, PlanID: plan.ID, Period: model.PeriodMonthly, TradeNo: "T2", TotalAmount: 500, Type: model.OrderTypeResetTraffic, Status: model.OrderStatusCompleted})
+
+	near := func(got, want int64) bool { return got >= want-5 && got <= want+5 }
+
+	// 生效中的订单按剩余时间 1/2 与剩余流量 3/4 各占一半折算
+	surplus, ids, err := orders.getSurplus(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(surplus, 1875) || len(ids) != 1 || ids[0] != first.ID {
+		t.Errorf("partly used: surplus = %d, orders = %v", surplus, ids)
+	}
+
+	// 续费一个月后尚未开始的续费订单全额折抵，不按全部订单平均
+	renewal := &model.Order{UserID: user.ID, PlanID: plan.ID, Period: model.PeriodMonthly, TradeNo: "T3", TotalAmount: 3000, Type: model.OrderTypeRenewal, Status: model.OrderStatusCompleted}
+	db.Create(renewal)
+	expiredAt += 30 * 86400
+	surplus, ids, err = orders.getSurplus(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(surplus, 4875) || len(ids) != 2 || ids[0] != renewal.ID || ids[1] != first.ID {
+		t.Errorf("bought twice: surplus = %d, orders = %v", surplus, ids)
+	}
+
+	// 一次性套餐按最近订单的剩余流量折算
+	user.ExpiredAt = nil
+	onetime := &model.Order{UserID: user.ID, PlanID: plan.ID, Period: model.PeriodOnetime, TradeNo: "T4", TotalAmount: 2000, Type: model.OrderTypeNewPurchase, Status: model.OrderStatusCompleted}
+	db.Create(onetime)
+	surplus, ids, _ = orders.getSurplus(user)
+	if surplus != 1500 || len(ids) != 1 || ids[0] != onetime.ID {
+		t.Errorf("onetime: surplus = %d, orders = %v", surplus, ids)
+	}
+}
+
+func TestUpgradeAfterTrafficPack(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.TrafficPack{}, &model.UserTrafficPack{})
+
+	basicPrice, proPrice := int64(1000), int64(3000)
+	basic := &model.Plan{Name: "basic", TransferEnable: 100, MonthPrice: &basicPrice}
+	pro := &model.Plan{Name: "pro", TransferEnable: 300, MonthPrice: &proPrice}
+	db.Create(basic)
+	db.Create(pro)
+	pack := &model.TrafficPack{Name: "50G", Traffic: 50, Days: 30, Price: 500, Sell: true}
+	db.Create(pack)
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1"}
+	db.Create(user)
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+
+	planOrder, err := orders.CreateOrderWithCoupon(user.ID, basic.ID, model.PeriodMonthly, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.CompleteOrder(planOrder.TradeNo, "cb1"); err != nil {
+		t.Fatal(err)
+	}
+	packOrder, err := orders.CreateTrafficPackOrder(user.ID, pack.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.CompleteOrder(packOrder.TradeNo, "cb2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只折抵套餐订单，流量包不计入升级抵扣
+	upgrade, err := orders.CreateOrderWithCoupon(user.ID, pro.ID, model.PeriodMonthly, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgrade.Type != model.OrderTypeUpgrade || upgrade.SurplusAmount == nil || *upgrade.SurplusAmount > basicPrice {
+		t.Fatalf("upgrade: type = %d, surplus = %v", upgrade.Type, upgrade.SurplusAmount)
+	}
+	ids := upgrade.GetSurplusOrderIDsAsInt64()
+	if len(ids) != 1 || ids[0] != planOrder.ID {
+		t.Fatalf("surplus orders = %v, want [%d]", ids, planOrder.ID)
+	}
+
+	// 即使折抵列表中混入流量包订单也不会被标记为已折抵
+	upgrade.SurplusOrderIDs = append(upgrade.SurplusOrderIDs, packOrder.ID)
+	db.Save(upgrade)
+	if err := orders.CompleteOrder(upgrade.TradeNo, "cb3"); err != nil {
+		t.Fatal(err)
+	}
+	gotPlan, _ := repos.Order.FindByID(planOrder.ID)
+	gotPack, _ := repos.Order.FindByID(packOrder.ID)
+	if gotPlan.Status != model.OrderStatusDiscounted || gotPack.Status != model.OrderStatusCompleted {
+		t.Errorf("plan order status = %d, pack order status = %d", gotPlan.Status, gotPack.Status)
+	}
+}
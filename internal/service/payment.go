@@ -1,37 +1,40 @@
 package service
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
-	"sort"
 	"strings"
+	"time"
 
 	"dashgo/internal/model"
+	"dashgo/internal/payment"
 	"dashgo/internal/repository"
+	"dashgo/pkg/utils"
+
+	"gorm.io/gorm"
 )
 
-// PaymentService 支付服务
+// PaymentService 支付服务，具体支付逻辑由 internal/payment 中注册的网关实现
 type PaymentService struct {
-	paymentRepo *repository.PaymentRepository
-	orderRepo   *repository.OrderRepository
-	orderSvc    *OrderService
+	paymentRepo  *repository.PaymentRepository
+	orderRepo    *repository.OrderRepository
+	orderSvc     *OrderService
+	callbackRepo *repository.PaymentCallbackRepository
 }
 
 func NewPaymentService(
 	paymentRepo *repository.PaymentRepository,
 	orderRepo *repository.OrderRepository,
 	orderSvc *OrderService,
+	callbackRepo *repository.PaymentCallbackRepository,
 ) *PaymentService {
 	return &PaymentService{
-		paymentRepo: paymentRepo,
-		orderRepo:   orderRepo,
-		orderSvc:    orderSvc,
+		paymentRepo:  paymentRepo,
+		orderRepo:    orderRepo,
+		orderSvc:     orderSvc,
+		callbackRepo: callbackRepo,
 	}
 }
 
@@ -42,11 +45,104 @@ type PaymentResult struct {
 	PaymentID int64  `json:"payment_id"`
 }
 
+// GatewayInfo 支付网关及其配置项
+type GatewayInfo struct {
+	Name   string          `json:"name"`
+	Fields []payment.Field `json:"fields"`
+}
+
 // GetEnabledPayments 获取启用的支付方告
 func (s *PaymentService) GetEnabledPayments() ([]model.Payment, error) {
 	return s.paymentRepo.GetEnabled()
 }
 
+// GetAllPayments 获取所有支付方式
+func (s *PaymentService) GetAllPayments() ([]model.Payment, error) {
+	return s.paymentRepo.GetAll()
+}
+
+// GetPaymentMethod 获取支付方式
+func (s *PaymentService) GetPaymentMethod(id int64) (*model.Payment, error) {
+	return s.paymentRepo.FindByID(id)
+}
+
+// GetGateways 获取支持的支付网关，供后台渲染配置表单
+func (s *PaymentService) GetGateways() []GatewayInfo {
+	gateways := payment.List()
+	result := make([]GatewayInfo, 0, len(gateways))
+	for _, g := range gateways {
+		result = append(result, GatewayInfo{Name: g.Name(), Fields: g.Fields()})
+	}
+	return result
+}
+
+// CreatePaymentMethod 创建支付方式
+func (s *PaymentService) CreatePaymentMethod(method *model.Payment) error {
+	if err := validatePaymentMethod(method); err != nil {
+		return err
+	}
+	method.UUID = utils.GenerateToken(32)
+	return s.paymentRepo.Create(method)
+}
+
+// UpdatePaymentMethod 更新支付方式
+func (s *PaymentService) UpdatePaymentMethod(method *model.Payment) error {
+	if err := validatePaymentMethod(method); err != nil {
+		return err
+	}
+	return s.paymentRepo.Update(method)
+}
+
+// DeletePaymentMethod 删除支付方式
+func (s *PaymentService) DeletePaymentMethod(id int64) error {
+	return s.paymentRepo.Delete(id)
+}
+
+// validatePaymentMethod 按网关配置项校验支付方式
+func validatePaymentMethod(method *model.Payment) error {
+	if strings.TrimSpace(method.Name) == "" {
+		return errors.New("payment name is required")
+	}
+	config, err := paymentConfig(method)
+	if err != nil {
+		return err
+	}
+	return payment.ValidateConfig(method.Payment, config)
+}
+
+// paymentConfig 解析支付方式配置
+func paymentConfig(method *model.Payment) (payment.Config, error) {
+	config := payment.Config{}
+	if method.Config == "" {
+		return config, nil
+	}
+	if err := json.Unmarshal([]byte(method.Config), &config); err != nil {
+		return nil, errors.New("invalid payment config")
+	}
+	return config, nil
+}
+
+// gateway 获取支付方式对应的网关与配置
+func (s *PaymentService) gateway(method *model.Payment) (payment.Gateway, payment.Config, error) {
+	g, ok := payment.Get(method.Payment)
+	if !ok {
+		return nil, nil, errors.New("unsupported payment method")
+	}
+	config, err := paymentConfig(method)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, config, nil
+}
+
+// notifyURL 异步通知地址，配置了通知域名时优先使用
+func notifyURL(method *model.Payment, config payment.Config) string {
+	if method.NotifyDomain != nil && *method.NotifyDomain != "" {
+		return strings.TrimRight(*method.NotifyDomain, "/") + "/api/v1/payment/notify/" + method.UUID
+	}
+	return config["notify_url"]
+}
+
 // CreatePayment 创建支付
 func (s *PaymentService) CreatePayment(tradeNo string, paymentID int64) (*PaymentResult, error) {
 	order, err := s.orderRepo.FindByTradeNo(tradeNo)
@@ -58,157 +154,205 @@ func (s *PaymentService) CreatePayment(tradeNo string, paymentID int64) (*Paymen
 		return nil, errors.New("order is not pending")
 	}
 
-	payment, err := s.paymentRepo.FindByID(paymentID)
+	method, err := s.paymentRepo.FindByID(paymentID)
 	if err != nil {
 		return nil, errors.New("payment method not found")
 	}
 
-	if !payment.Enable {
+	if !method.Enable {
 		return nil, errors.New("payment method is disabled")
 	}
 
+	g, config, err := s.gateway(method)
+	if err != nil {
+		return nil, err
+	}
+
+	// 手续费不计入订单金额
+	handlingAmount := method.HandlingFeeAt(order.DueAmount(), order.CurrencyRate)
+	order.HandlingAmount = &handlingAmount
+
+	result, err := g.Create(config, &payment.Request{
+		TradeNo:   order.TradeNo,
+		Amount:    order.PayAmount(),
+		Currency:  s.orderSvc.orderCurrency(order),
+		Subject:   "订阅服务",
+		NotifyURL: notifyURL(method, config),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 网关取整产生的差额计入手续费，保证回调金额校验一致
+	if result.Amount > 0 && result.Amount != order.PayAmount() {
+		handlingAmount += result.Amount - order.PayAmount()
+		order.HandlingAmount = &handlingAmount
+	}
+
 	// 更新订单支付方式
 	order.PaymentID = &paymentID
+	order.CallbackNo = nil
+	if result.CallbackNo != "" {
+		order.CallbackNo = &result.CallbackNo
+	}
 	if err := s.orderRepo.Update(order); err != nil {
 		return nil, err
 	}
 
-	// 根据支付方式创建支付
-	var config map[string]string
-	json.Unmarshal([]byte(payment.Config), &config)
+	return &PaymentResult{
+		Type:      result.Type,
+		Data:      result.Data,
+		PaymentID: method.ID,
+	}, nil
+}
 
-	switch payment.Payment {
-	case "epay":
-		return s.createEpayPayment(order, payment, config)
-	case "stripe":
-		return s.createStripePayment(order, payment, config)
-	case "alipay":
-		return s.createAlipayPayment(order, payment, config)
-	default:
-		return nil, errors.New("unsupported payment method")
+// HandleCallback 处理支付回调，签名校验由网关完成，无法校验的回调一律拒绝
+// 每次回调均写入回调日志，同一网关交易号只会成功处理一次
+func (s *PaymentService) HandleCallback(paymentUUID string, n *payment.Notification) error {
+	if n.ReceivedAt.IsZero() {
+		n.ReceivedAt = time.Now()
 	}
-}
+	callback := newPaymentCallback(n)
 
-// HandleCallback 处理支付回调
-func (s *PaymentService) HandleCallback(paymentUUID string, params map[string]string) error {
-	payment, err := s.paymentRepo.FindByUUID(paymentUUID)
+	method, err := s.paymentRepo.FindByUUID(paymentUUID)
 	if err != nil {
-		return errors.New("payment not found")
+		msg := "payment not found"
+		callback.Outcome = model.CallbackOutcomeRejected
+		callback.Error = &msg
+		s.callbackRepo.Create(callback)
+		return errors.New(msg)
 	}
+	return s.processCallback(method, callback, n)
+}
 
-	var config map[string]string
-	json.Unmarshal([]byte(payment.Config), &config)
-
-	// 验证签名
-	switch payment.Payment {
-	case "epay":
-		if !s.verifyEpaySign(params, config["key"]) {
-			return errors.New("invalid signature")
-		}
+// ReplayCallback 重放已记录的回调，重新校验签名后按正常流程处理
+func (s *PaymentService) ReplayCallback(id int64) (*model.PaymentCallback, error) {
+	original, err := s.callbackRepo.FindByID(id)
+	if err != nil {
+		return nil, errors.New("callback not found")
+	}
+	method, err := s.paymentRepo.FindByID(original.PaymentID)
+	if err != nil {
+		return nil, errors.New("payment not found")
 	}
 
-	// 获取订单告
-	tradeNo := params["out_trade_no"]
-	if tradeNo == "" {
-		return errors.New("trade_no not found")
+	n := &payment.Notification{
+		Params:     map[string]string{},
+		Body:       []byte(original.Body),
+		Header:     http.Header{},
+		ReceivedAt: time.Unix(original.ReceivedAt, 0),
 	}
+	json.Unmarshal([]byte(original.Params), &n.Params)
+	json.Unmarshal([]byte(original.Headers), &n.Header)
 
-	// 完成订单
-	callbackNo := params["trade_no"]
-	return s.orderSvc.CompleteOrder(tradeNo, callbackNo)
+	callback := newPaymentCallback(n)
+	callback.ReplayOf = &original.ID
+	err = s.processCallback(method, callback, n)
+	return callback, err
 }
 
-// createEpayPayment 创建易支告
-func (s *PaymentService) createEpayPayment(order *model.Order, payment *model.Payment, config map[string]string) (*PaymentResult, error) {
-	apiURL := config["url"]
-	pid := config["pid"]
-	key := config["key"]
+// ListCallbacks 分页获取回调日志
+func (s *PaymentService) ListCallbacks(tradeNo string, page, pageSize int) ([]model.PaymentCallback, int64, error) {
+	return s.callbackRepo.List(tradeNo, page, pageSize)
+}
 
-	notifyURL := config["notify_url"]
-	if payment.NotifyDomain != nil && *payment.NotifyDomain != "" {
-		notifyURL = *payment.NotifyDomain + "/api/v1/payment/notify/" + payment.UUID
+// newPaymentCallback 根据原始通知创建回调日志
+func newPaymentCallback(n *payment.Notification) *model.PaymentCallback {
+	headers, _ := json.Marshal(n.Header)
+	params, _ := json.Marshal(n.Params)
+	return &model.PaymentCallback{
+		Headers:    string(headers),
+		Params:     string(params),
+		Body:       string(n.Body),
+		Outcome:    model.CallbackOutcomeReceived,
+		ReceivedAt: n.ReceivedAt.Unix(),
 	}
+}
 
-	params := map[string]string{
-		"pid":          pid,
-		"type":         "alipay",
-		"out_trade_no": order.TradeNo,
-		"notify_url":   notifyURL,
-		"return_url":   config["return_url"],
-		"name":         "订阅服务",
-		"money":        fmt.Sprintf("%.2f", float64(order.TotalAmount)/100),
+// processCallback 处理回调并记录结果
+func (s *PaymentService) processCallback(method *model.Payment, callback *model.PaymentCallback, n *payment.Notification) error {
+	callback.PaymentID = method.ID
+	callback.Gateway = method.Payment
+	if err := s.callbackRepo.Create(callback); err != nil {
+		return err
 	}
 
-	// 生成签名
-	params["sign"] = s.generateEpaySign(params, key)
-	params["sign_type"] = "MD5"
-
-	// 构建支付 URL
-	payURL := apiURL + "/submit.php?" + s.buildQuery(params)
-
-	return &PaymentResult{
-		Type:      "redirect",
-		Data:      payURL,
-		PaymentID: payment.ID,
-	}, nil
+	err := s.handleNotification(method, callback, n)
+	if err != nil {
+		msg := err.Error()
+		callback.Error = &msg
+		if callback.Outcome == model.CallbackOutcomeReceived {
+			callback.Outcome = model.CallbackOutcomeFailed
+		}
+	}
+	s.callbackRepo.Update(callback)
+	return err
 }
 
-// createStripePayment 创建 Stripe 支付
-func (s *PaymentService) createStripePayment(order *model.Order, payment *model.Payment, config map[string]string) (*PaymentResult, error) {
-	// TODO: 实现 Stripe 支付
-	return nil, errors.New("stripe payment not implemented")
-}
+func (s *PaymentService) handleNotification(method *model.Payment, callback *model.PaymentCallback, n *payment.Notification) error {
+	g, config, err := s.gateway(method)
+	if err != nil {
+		callback.Outcome = model.CallbackOutcomeRejected
+		return err
+	}
 
-// createAlipayPayment 创建支付宝支告
-func (s *PaymentService) createAlipayPayment(order *model.Order, payment *model.Payment, config map[string]string) (*PaymentResult, error) {
-	// TODO: 实现支付宝支告
-	return nil, errors.New("alipay payment not implemented")
-}
+	trade, err := g.Notify(config, n)
+	if err != nil {
+		callback.Outcome = model.CallbackOutcomeRejected
+		return err
+	}
+	callback.Verified = true
+	callback.TradeNo = trade.TradeNo
+	callback.CallbackNo = trade.CallbackNo
 
-// generateEpaySign 生成易支付签告
-func (s *PaymentService) generateEpaySign(params map[string]string, key string) string {
-	// 告key 排序
-	keys := make([]string, 0, len(params))
-	for k := range params {
-		if k != "sign" && k != "sign_type" && params[k] != "" {
-			keys = append(keys, k)
-		}
+	if !trade.Paid {
+		callback.Outcome = model.CallbackOutcomeIgnored
+		return nil
 	}
-	sort.Strings(keys)
 
-	// 拼接字符告
-	var buf strings.Builder
-	for i, k := range keys {
-		if i > 0 {
-			buf.WriteString("&")
+	// 按网关交易号去重
+	if trade.CallbackNo != "" {
+		done, err := s.callbackRepo.ExistsCompleted(method.ID, trade.CallbackNo)
+		if err != nil {
+			return err
+		}
+		if done {
+			callback.Outcome = model.CallbackOutcomeDuplicate
+			return nil
 		}
-		buf.WriteString(k)
-		buf.WriteString("=")
-		buf.WriteString(params[k])
 	}
-	buf.WriteString(key)
 
-	// MD5
-	hash := md5.Sum([]byte(buf.String()))
-	return hex.EncodeToString(hash[:])
-}
-
-// verifyEpaySign 验证易支付签告
-func (s *PaymentService) verifyEpaySign(params map[string]string, key string) bool {
-	sign := params["sign"]
-	if sign == "" {
-		return false
+	if err := s.completeTrade(method, trade); err != nil {
+		if errors.Is(err, ErrOrderProcessed) {
+			callback.Outcome = model.CallbackOutcomeDuplicate
+			return nil
+		}
+		return err
 	}
-	return s.generateEpaySign(params, key) == sign
+	callback.Outcome = model.CallbackOutcomeCompleted
+	return nil
 }
 
-// buildQuery 构建查询字符告
-func (s *PaymentService) buildQuery(params map[string]string) string {
-	values := url.Values{}
-	for k, v := range params {
-		values.Set(k, v)
+// completeTrade 校验网关交易与订单一致后完成订单
+func (s *PaymentService) completeTrade(method *model.Payment, trade *payment.Trade) error {
+	order, err := s.orderRepo.FindByTradeNo(trade.TradeNo)
+	if err != nil {
+		return errors.New("order not found")
+	}
+	if order.Status != model.OrderStatusPending {
+		return ErrOrderProcessed
 	}
-	return values.Encode()
+	if order.PaymentID == nil || *order.PaymentID != method.ID {
+		return errors.New("payment method mismatch")
+	}
+	if currency := s.orderSvc.orderCurrency(order); trade.Currency != "" && !strings.EqualFold(trade.Currency, currency) {
+		return fmt.Errorf("payment currency mismatch: expected %s, got %s", currency, trade.Currency)
+	}
+	if trade.Amount != order.PayAmount() {
+		return fmt.Errorf("payment amount mismatch: expected %d, got %d", order.PayAmount(), trade.Amount)
+	}
+
+	return s.orderSvc.CompleteOrder(order.TradeNo, trade.CallbackNo)
 }
 
 // CheckPaymentStatus 检查支付状态（主动查询告
@@ -226,90 +370,115 @@ func (s *PaymentService) CheckPaymentStatus(tradeNo string) (bool, error) {
 		return false, nil
 	}
 
-	payment, err := s.paymentRepo.FindByID(*order.PaymentID)
+	method, err := s.paymentRepo.FindByID(*order.PaymentID)
 	if err != nil {
 		return false, err
 	}
 
-	var config map[string]string
-	json.Unmarshal([]byte(payment.Config), &config)
-
-	switch payment.Payment {
-	case "epay":
-		return s.queryEpayStatus(order, config)
+	g, config, err := s.gateway(method)
+	if err != nil {
+		return false, err
 	}
 
-	return false, nil
-}
-
-// queryEpayStatus 查询易支付状告
-func (s *PaymentService) queryEpayStatus(order *model.Order, config map[string]string) (bool, error) {
-	apiURL := config["url"] + "/api.php"
-	params := map[string]string{
-		"act":          "order",
-		"pid":          config["pid"],
-		"key":          config["key"],
-		"out_trade_no": order.TradeNo,
+	req := &payment.Request{TradeNo: order.TradeNo, Amount: order.PayAmount(), Currency: s.orderSvc.orderCurrency(order)}
+	if order.CallbackNo != nil {
+		req.CallbackNo = *order.CallbackNo
 	}
-
-	resp, err := http.Get(apiURL + "?" + s.buildQuery(params))
+	trade, err := g.Query(config, req)
 	if err != nil {
 		return false, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var result map[string]interface{}
-	json.Unmarshal(body, &result)
-
-	if status, ok := result["status"].(float64); ok && status == 1 {
-		// 支付成功，完成订告
-		callbackNo := ""
-		if tn, ok := result["trade_no"].(string); ok {
-			callbackNo = tn
-		}
-		s.orderSvc.CompleteOrder(order.TradeNo, callbackNo)
-		return true, nil
+	if !trade.Paid {
+		return false, nil
 	}
 
-	return false, nil
+	trade.TradeNo = order.TradeNo
+	if err := s.completeTrade(method, trade); err != nil && !errors.Is(err, ErrOrderProcessed) {
+		return false, err
+	}
+	return true, nil
 }
 
-// PayWithBalance 使用余额支付
-func (s *PaymentService) PayWithBalance(tradeNo string, userID int64) error {
-	order, err := s.orderRepo.FindByTradeNo(tradeNo)
+// RefundToGateway 通过支付网关原路退款，返回网关退款单号
+func (s *PaymentService) RefundToGateway(order *model.Order, amount int64, refundNo string) (string, error) {
+	if order.PaymentID == nil {
+		return "", errors.New("order was not paid through a payment gateway")
+	}
+	method, err := s.paymentRepo.FindByID(*order.PaymentID)
 	if err != nil {
-		return errors.New("order not found")
+		return "", errors.New("payment method not found")
 	}
 
-	if order.Status != model.OrderStatusPending {
-		return errors.New("order is not pending")
+	g, config, err := s.gateway(method)
+	if err != nil {
+		return "", err
 	}
 
-	if order.UserID != userID {
-		return errors.New("permission denied")
+	req := &payment.RefundRequest{
+		TradeNo:  order.TradeNo,
+		RefundNo: refundNo,
+		Amount:   amount,
+		Currency: s.orderSvc.orderCurrency(order),
 	}
-
-	// 获取用户
-	user, err := s.orderSvc.userRepo.FindByID(userID)
-	if err != nil {
-		return errors.New("user not found")
+	if order.CallbackNo != nil {
+		req.CallbackNo = *order.CallbackNo
 	}
+	return g.Refund(config, req)
+}
 
-	// 检查余告
-	if user.Balance < order.TotalAmount {
-		return errors.New("insufficient balance")
-	}
+// PayWithBalance 使用余额支付，扣款与开通在同一事务中完成
+func (s *PaymentService) PayWithBalance(tradeNo string, userID int64) error {
+	var released int64
+	err := s.orderRepo.Transaction(func(tx *gorm.DB) error {
+		orderRepo := s.orderRepo.WithTx(tx)
+		userRepo := s.orderSvc.userRepo.WithTx(tx)
+
+		order, err := orderRepo.FindByTradeNoForUpdate(tradeNo)
+		if err != nil {
+			return errors.New("order not found")
+		}
 
-	// 扣除余额
-	user.Balance -= order.TotalAmount
-	if err := s.orderSvc.userRepo.Update(user); err != nil {
-		return err
-	}
+		if order.Status != model.OrderStatusPending {
+			return errors.New("order is not pending")
+		}
+
+		if order.UserID != userID {
+			return errors.New("permission denied")
+		}
+
+		// 获取用户
+		user, err := userRepo.FindByIDForUpdate(userID)
+		if err != nil || user == nil {
+			return errors.New("user not found")
+		}
+
+		// 检查余额（余额以基础币种计，外币订单按下单汇率折算），已抵扣部分不再扣除
+		amount := order.ToBase(order.DueAmount())
+		if user.Balance < amount {
+			return errors.New("insufficient balance")
+		}
+
+		// 扣除余额
+		user.Balance -= amount
+		if err := userRepo.Update(user); err != nil {
+			return err
+		}
 
-	// 记录余额支付
-	order.BalanceAmount = &order.TotalAmount
+		// 记录余额支付，余额支付不收取手续费
+		order.BalanceAmount = &order.TotalAmount
+		order.HandlingAmount = nil
+		order.PaymentID = nil
+		if err := orderRepo.Update(order); err != nil {
+			return err
+		}
 
-	// 完成订单
-	return s.orderSvc.CompleteOrder(tradeNo, "balance_"+tradeNo)
+		// 完成订单
+		released, err = s.orderSvc.completeOrder(tx, tradeNo, "balance_"+tradeNo)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.orderSvc.releaseSeat(released)
+	return nil
 }
@@ -1,6 +1,9 @@
 package service
 
 import (
+	"log"
+	"strings"
+
 	"dashgo/internal/model"
 	"dashgo/internal/repository"
 )
@@ -8,6 +11,7 @@ import (
 type PlanService struct {
 	planRepo *repository.PlanRepository
 	userRepo *repository.UserRepository
+	waitlist *WaitlistService
 }
 
 func NewPlanService(planRepo *repository.PlanRepository, userRepo *repository.UserRepository) *PlanService {
@@ -17,6 +21,21 @@ func NewPlanService(planRepo *repository.PlanRepository, userRepo *repository.Us
 	}
 }
 
+// SetWaitlistService 设置候补服务，名额释放时通知候补用户
+func (s *PlanService) SetWaitlistService(waitlist *WaitlistService) {
+	s.waitlist = waitlist
+}
+
+// releaseWaitlist 套餐可能有空闲名额时通知候补用户
+func (s *PlanService) releaseWaitlist(planID int64) {
+	if s.waitlist == nil {
+		return
+	}
+	if _, err := s.waitlist.Release(planID); err != nil {
+		log.Printf("[Plan] Failed to release waitlist for plan %d: %v", planID, err)
+	}
+}
+
 // GetAll 获取所有套餐
 func (s *PlanService) GetAll() ([]model.Plan, error) {
 	return s.planRepo.GetAll()
@@ -34,12 +53,40 @@ func (s *PlanService) GetByID(id int64) (*model.Plan, error) {
 
 // Create 创建套餐
 func (s *PlanService) Create(plan *model.Plan) error {
+	normalizeCurrencyPrices(plan)
 	return s.planRepo.Create(plan)
 }
 
 // Update 更新套餐
 func (s *PlanService) Update(plan *model.Plan) error {
-	return s.planRepo.Update(plan)
+	normalizeCurrencyPrices(plan)
+	if err := s.planRepo.Update(plan); err != nil {
+		return err
+	}
+	// 上限提高或重新开售时释放名额
+	s.releaseWaitlist(plan.ID)
+	return nil
+}
+
+// normalizeCurrencyPrices 币种代码统一为大写，并去除无效价格
+func normalizeCurrencyPrices(plan *model.Plan) {
+	if len(plan.CurrencyPrices) == 0 {
+		return
+	}
+	prices := make(model.PriceTable)
+	for currency, periods := range plan.CurrencyPrices {
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		for period, price := range periods {
+			if currency == "" || price <= 0 {
+				continue
+			}
+			if prices[currency] == nil {
+				prices[currency] = make(map[string]int64)
+			}
+			prices[currency][period] = price
+		}
+	}
+	plan.CurrencyPrices = prices
 }
 
 // Delete 删除套餐
@@ -80,6 +127,9 @@ func (s *PlanService) GetPlanInfo(plan *model.Plan) map[string]interface{} {
 	if plan.OnetimePrice != nil && *plan.OnetimePrice > 0 {
 		prices[model.PeriodOnetime] = *plan.OnetimePrice
 	}
+	if plan.ResetPrice != nil && *plan.ResetPrice > 0 {
+		prices[model.PeriodResetTraffic] = *plan.ResetPrice
+	}
 
 	return map[string]interface{}{
 		"id":                   plan.ID,
@@ -95,6 +145,7 @@ func (s *PlanService) GetPlanInfo(plan *model.Plan) map[string]interface{} {
 		"content":              plan.Content,
 		"sort":                 plan.Sort,
 		"prices":               prices,
+		"currency_prices":      plan.CurrencyPrices,
 		"reset_traffic_method": plan.ResetTrafficMethod,
 		"capacity_limit":       plan.CapacityLimit,
 		"sold_count":           plan.SoldCount,
@@ -110,7 +161,11 @@ func (s *PlanService) IncrementSoldCount(planID int64) error {
 
 // DecrementSoldCount 减少已售数量
 func (s *PlanService) DecrementSoldCount(planID int64) error {
-	return s.planRepo.DecrementSoldCount(planID)
+	if err := s.planRepo.DecrementSoldCount(planID); err != nil {
+		return err
+	}
+	s.releaseWaitlist(planID)
+	return nil
 }
 
 var ErrPlanInUse = &PlanError{Message: "plan is in use by users"}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+	"dashgo/pkg/utils"
+
+	"gorm.io/gorm"
+)
+
+// redeemTrafficPackDays 流量兑换码发放的流量包有效天数
+const redeemTrafficPackDays = 365
+
+// RedeemService 兑换码服务
+type RedeemService struct {
+	codeRepo *repository.RedeemCodeRepository
+	logRepo  *repository.RedeemLogRepository
+	userRepo *repository.UserRepository
+	planRepo *repository.PlanRepository
+	packRepo *repository.UserTrafficPackRepository
+	waitlist *WaitlistService
+	planSvc  *PlanService
+}
+
+func NewRedeemService(codeRepo *repository.RedeemCodeRepository, logRepo *repository.RedeemLogRepository, userRepo *repository.UserRepository, planRepo *repository.PlanRepository, packRepo *repository.UserTrafficPackRepository) *RedeemService {
+	return &RedeemService{
+		codeRepo: codeRepo,
+		logRepo:  logRepo,
+		userRepo: userRepo,
+		planRepo: planRepo,
+		packRepo: packRepo,
+	}
+}
+
+// SetWaitlistService 设置 WaitlistService 依赖（限量套餐名额与候补）
+func (s *RedeemService) SetWaitlistService(waitlist *WaitlistService) {
+	s.waitlist = waitlist
+}
+
+// Redeem 用户兑换，在同一事务中占用次数、发放权益并写入兑换记录
+func (s *RedeemService) Redeem(userID int64, code string) (*model.RedeemLog, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil, errors.New("redeem code is required")
+	}
+
+	var redeemLog *model.RedeemLog
+	var released int64
+	err := s.codeRepo.Transaction(func(tx *gorm.DB) error {
+		codeRepo := s.codeRepo.WithTx(tx)
+		logRepo := s.logRepo.WithTx(tx)
+		userRepo := s.userRepo.WithTx(tx)
+
+		redeemCode, err := codeRepo.FindByCode(code)
+		if err != nil {
+			return errors.New("redeem code not found")
+		}
+
+		now := time.Now().Unix()
+		if redeemCode.StartedAt > now {
+			return errors.New("redeem code not started")
+		}
+		if redeemCode.EndedAt > 0 && redeemCode.EndedAt < now {
+			return errors.New("redeem code expired")
+		}
+
+		// 锁定用户，避免同一用户并发兑换绕过单用户次数限制
+		user, err := userRepo.FindByIDForUpdate(userID)
+		if err != nil || user == nil {
+			return errors.New("user not found")
+		}
+
+		// 先占用次数，防止并发超发
+		ok, err := codeRepo.IncrementUsed(redeemCode.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("redeem code usage limit reached")
+		}
+
+		if redeemCode.LimitUseWithUser != nil && *redeemCode.LimitUseWithUser > 0 {
+			used, err := logRepo.CountByUser(redeemCode.ID, userID)
+			if err != nil {
+				return err
+			}
+			if used >= int64(*redeemCode.LimitUseWithUser) {
+				return errors.New("you have reached the usage limit for this redeem code")
+			}
+		}
+
+		previous := user.PlanID
+		if err := s.grant(tx, user, redeemCode); err != nil {
+			return err
+		}
+		if redeemCode.Type == model.RedeemTypePlan && previous != nil && *previous != *user.PlanID {
+			released = *previous
+		}
+		if err := userRepo.Update(user); err != nil {
+			return err
+		}
+
+		redeemLog = &model.RedeemLog{
+			CodeID:    redeemCode.ID,
+			UserID:    userID,
+			Code:      redeemCode.Code,
+			Type:      redeemCode.Type,
+			PlanID:    redeemCode.PlanID,
+			Value:     redeemCode.Value,
+			CreatedAt: now,
+		}
+		return logRepo.Create(redeemLog)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if released > 0 {
+		s.releaseSeat(released)
+	}
+	return redeemLog, nil
+}
+
+// grant 按兑换码类型发放权益
+func (s *RedeemService) grant(tx *gorm.DB, user *model.User, code *model.RedeemCode) error {
+	now := time.Now().Unix()
+	seconds := code.Value * 86400
+
+	switch code.Type {
+	case model.RedeemTypePlan:
+		planRepo := s.planRepo.WithTx(tx)
+		plan, err := planRepo.FindByID(*code.PlanID)
+		if err != nil {
+			return errors.New("plan not found")
+		}
+		// 与当前有效套餐相同时顺延，否则更换套餐并从现在开始计算
+		expiredAt := now + seconds
+		if user.PlanID != nil && *user.PlanID == plan.ID && user.ExpiredAt != nil && *user.ExpiredAt > now {
+			expiredAt = *user.ExpiredAt + seconds
+		} else {
+			// 与新购相同：占用新套餐名额，原套餐名额在事务提交后释放；
+			// 已过期的同一套餐与续费相同，沿用已有名额
+			if user.PlanID == nil || *user.PlanID != plan.ID {
+				if !s.canTakeSeat(plan, user.ID) {
+					return errors.New("plan is sold out")
+				}
+				if err := planRepo.IncrementSoldCount(plan.ID); err != nil {
+					return err
+				}
+				if s.waitlist != nil {
+					if err := s.waitlist.MarkPurchased(tx, plan.ID, user.ID); err != nil {
+						return err
+					}
+				}
+			}
+			if err := settleTrafficPacks(s.packRepo.WithTx(tx), user, true); err != nil {
+				return err
+			}
+			user.U = 0
+			user.D = 0
+		}
+		applyPlan(user, plan)
+		user.ExpiredAt = &expiredAt
+
+	case model.RedeemTypeTime:
+		if user.PlanID == nil {
+			return errors.New("no plan to extend")
+		}
+		if user.ExpiredAt == nil || *user.ExpiredAt == 0 {
+			return errors.New("current plan does not expire")
+		}
+		expiredAt := *user.ExpiredAt
+		if expiredAt < now {
+			expiredAt = now
+		}
+		expiredAt += seconds
+		user.ExpiredAt = &expiredAt
+
+	case model.RedeemTypeTraffic:
+		// 以流量包发放，叠加在套餐流量之上，续费或更换套餐时不会被覆盖
+		if user.PlanID == nil {
+			return errors.New("no plan to add traffic to")
+		}
+		if user.TransferEnable == 0 {
+			return errors.New("current plan has unlimited traffic")
+		}
+		traffic := code.Value * 1024 * 1024 * 1024 // GB to Bytes
+		if err := s.packRepo.WithTx(tx).Create(&model.UserTrafficPack{
+			UserID:    user.ID,
+			Traffic:   traffic,
+			ExpiredAt: now + redeemTrafficPackDays*86400,
+			Status:    model.TrafficPackActive,
+		}); err != nil {
+			return err
+		}
+		user.PackTraffic += traffic
+
+	case model.RedeemTypeBalance:
+		user.Balance += code.Value
+
+	default:
+		return errors.New("invalid redeem code type")
+	}
+	return nil
+}
+
+// SetPlanService 设置套餐服务（释放名额时通知候补用户）
+func (s *RedeemService) SetPlanService(planSvc *PlanService) {
+	s.planSvc = planSvc
+}
+
+// releaseSeat 事务提交后释放原套餐名额并通知候补用户
+func (s *RedeemService) releaseSeat(planID int64) {
+	var err error
+	if s.planSvc != nil {
+		err = s.planSvc.DecrementSoldCount(planID)
+	} else {
+		err = s.planRepo.DecrementSoldCount(planID)
+	}
+	if err != nil {
+		log.Printf("[Redeem] Failed to release seat of plan %d: %v", planID, err)
+	}
+}
+
+// canTakeSeat 检查用户能否占用限量套餐的名额
+func (s *RedeemService) canTakeSeat(plan *model.Plan, userID int64) bool {
+	if s.waitlist != nil {
+		return s.waitlist.CanPurchase(plan, userID)
+	}
+	return plan.CanPurchase()
+}
+
+// validate 校验兑换码配置
+func (s *RedeemService) validate(code *model.RedeemCode) error {
+	if code.Value <= 0 {
+		return errors.New("redeem value must be positive")
+	}
+	switch code.Type {
+	case model.RedeemTypePlan:
+		if code.PlanID == nil {
+			return errors.New("plan_id is required")
+		}
+		if _, err := s.planRepo.FindByID(*code.PlanID); err != nil {
+			return errors.New("plan not found")
+		}
+	case model.RedeemTypeTime, model.RedeemTypeTraffic, model.RedeemTypeBalance:
+		code.PlanID = nil
+	default:
+		return errors.New("invalid redeem code type")
+	}
+	if code.EndedAt > 0 && code.EndedAt <= code.StartedAt {
+		return errors.New("ended_at must be after started_at")
+	}
+	return nil
+}
+
+// GenerateCodes 按模板批量生成兑换码，同一批次共享批次号
+// 未设置总次数时默认为一次性兑换码
+func (s *RedeemService) GenerateCodes(template *model.RedeemCode, count int) ([]model.RedeemCode, error) {
+	if count <= 0 || count > 10000 {
+		return nil, errors.New("count must be between 1 and 10000")
+	}
+	if err := s.validate(template); err != nil {
+		return nil, err
+	}
+	if template.LimitUse == nil {
+		limit := 1
+		template.LimitUse = &limit
+	}
+
+	batchNo := strings.ToUpper(utils.GenerateToken(16))
+	codes := make([]model.RedeemCode, 0, count)
+	for len(codes) < count {
+		code := *template
+		code.ID = 0
+		code.BatchNo = batchNo
+		code.Code = generateRedeemCode()
+		code.UsedCount = 0
+		if err := s.codeRepo.Create(&code); err != nil {
+			// 极小概率重复，重新生成
+			if _, findErr := s.codeRepo.FindByCode(code.Code); findErr == nil {
+				continue
+			}
+			return codes, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// ExportCSV 导出批次兑换码
+func (s *RedeemService) ExportCSV(batchNo string) ([]byte, error) {
+	codes, err := s.codeRepo.FindByBatchNo(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, errors.New("batch not found")
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"code", "name", "type", "plan_id", "value", "limit_use", "used_count", "ended_at"})
+	for _, code := range codes {
+		planID, limitUse := "", ""
+		if code.PlanID != nil {
+			planID = strconv.FormatInt(*code.PlanID, 10)
+		}
+		if code.LimitUse != nil {
+			limitUse = strconv.Itoa(*code.LimitUse)
+		}
+		endedAt := ""
+		if code.EndedAt > 0 {
+			endedAt = time.Unix(code.EndedAt, 0).Format(time.RFC3339)
+		}
+		w.Write([]string{
+			code.Code,
+			code.Name,
+			strconv.Itoa(code.Type),
+			planID,
+			strconv.FormatInt(code.Value, 10),
+			limitUse,
+			strconv.Itoa(code.UsedCount),
+			endedAt,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// List 分页获取兑换码
+func (s *RedeemService) List(batchNo string, page, pageSize int) ([]model.RedeemCode, int64, error) {
+	return s.codeRepo.List(batchNo, page, pageSize)
+}
+
+// Update 更新兑换码
+func (s *RedeemService) Update(code *model.RedeemCode) error {
+	if err := s.validate(code); err != nil {
+		return err
+	}
+	return s.codeRepo.Update(code)
+}
+
+// GetByID 根据 ID 获取兑换码
+func (s *RedeemService) GetByID(id int64) (*model.RedeemCode, error) {
+	return s.codeRepo.FindByID(id)
+}
+
+// Delete 删除兑换码
+func (s *RedeemService) Delete(id int64) error {
+	return s.codeRepo.Delete(id)
+}
+
+// GetLogs 分页获取兑换记录
+func (s *RedeemService) GetLogs(codeID, userID int64, page, pageSize int) ([]model.RedeemLog, int64, error) {
+	return s.logRepo.List(codeID, userID, page, pageSize)
+}
+
+// generateRedeemCode 生成 16 位兑换码（去除易混淆字符）
+func generateRedeemCode() string {
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	result := make([]byte, 16)
+	for i := range result {
+		n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		result[i] = charset[n.Int64()]
+	}
+	return string(result)
+}
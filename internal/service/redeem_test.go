@@ -0,0 +1,185 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestRedeemLimits(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.RedeemCode{}, &model.RedeemLog{}, &model.UserTrafficPack{})
+
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100}
+	db.Create(plan)
+	alice := &model.User{Email: "alice@example.com", UUID: "u1", Token: "t1"}
+	bob := &model.User{Email: "bob@example.com", UUID: "u2", Token: "t2"}
+	db.Create(alice)
+	db.Create(bob)
+
+	repos := repository.NewRepositories(db)
+	redeem := NewRedeemService(repos.RedeemCode, repos.RedeemLog, repos.User, repos.Plan, repos.UserTrafficPack)
+
+	// 一次性套餐码：第二个用户无法再兑换
+	codes, err := redeem.GenerateCodes(&model.RedeemCode{Type: model.RedeemTypePlan, PlanID: &plan.ID, Value: 30}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redeem.Redeem(alice.ID, codes[0].Code); err != nil {
+		t.Fatalf("redeem plan: %v", err)
+	}
+	if _, err := redeem.Redeem(bob.ID, codes[0].Code); err == nil {
+		t.Error("single-use code redeemed twice")
+	}
+
+	got, _ := repos.User.FindByID(alice.ID)
+	if got.PlanID == nil || *got.PlanID != plan.ID || got.ExpiredAt == nil || got.TransferEnable != 100*1024*1024*1024 {
+		t.Errorf("plan not granted: %+v", got)
+	}
+
+	// 多次余额码：每个用户限用一次
+	limitUse, perUser := 10, 1
+	codes, err = redeem.GenerateCodes(&model.RedeemCode{Type: model.RedeemTypeBalance, Value: 500, LimitUse: &limitUse, LimitUseWithUser: &perUser}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redeem.Redeem(bob.ID, codes[0].Code); err != nil {
+		t.Fatalf("redeem balance: %v", err)
+	}
+	if _, err := redeem.Redeem(bob.ID, codes[0].Code); err == nil {
+		t.Error("per-user limit not enforced")
+	}
+
+	got, _ = repos.User.FindByID(bob.ID)
+	if got.Balance != 500 {
+		t.Errorf("balance = %d, want 500", got.Balance)
+	}
+	code, _ := repos.RedeemCode.FindByID(codes[0].ID)
+	if code.UsedCount != 1 {
+		t.Errorf("used_count = %d, want 1 after rejected redemption", code.UsedCount)
+	}
+}
+
+func TestRedeemPlanCapacity(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.RedeemCode{}, &model.RedeemLog{}, &model.UserTrafficPack{}, &model.PlanWaitlist{})
+
+	capacity := 1
+	limited := &model.Plan{Name: "limited", TransferEnable: 100, CapacityLimit: &capacity}
+	other := &model.Plan{Name: "other", TransferEnable: 50}
+	db.Create(limited)
+	db.Create(other)
+	alice := &model.User{Email: "alice@example.com", UUID: "u1", Token: "t1"}
+	bob := &model.User{Email: "bob@example.com", UUID: "u2", Token: "t2"}
+	db.Create(alice)
+	db.Create(bob)
+
+	repos := repository.NewRepositories(db)
+	redeem := NewRedeemService(repos.RedeemCode, repos.RedeemLog, repos.User, repos.Plan, repos.UserTrafficPack)
+	redeem.SetWaitlistService(NewWaitlistService(repos.PlanWaitlist, repos.Plan, repos.User, nil, nil))
+
+	limitUse := 10
+	codes, err := redeem.GenerateCodes(&model.RedeemCode{Type: model.RedeemTypePlan, PlanID: &limited.ID, Value: 30, LimitUse: &limitUse}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soldCount := func(id int64) int {
+		plan, _ := repos.Plan.FindByID(id)
+		return plan.SoldCount
+	}
+
+	// 兑换限量套餐占用名额，售罄后其他用户不能兑换
+	if _, err := redeem.Redeem(alice.ID, codes[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	if soldCount(limited.ID) != 1 {
+		t.Errorf("sold_count = %d, want 1", soldCount(limited.ID))
+	}
+	if _, err := redeem.Redeem(bob.ID, codes[0].Code); err == nil {
+		t.Error("redeemed a sold-out plan")
+	}
+
+	// 同一套餐顺延不重复占用名额
+	if _, err := redeem.Redeem(alice.ID, codes[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	if soldCount(limited.ID) != 1 {
+		t.Errorf("sold_count after extension = %d, want 1", soldCount(limited.ID))
+	}
+
+	// 同一套餐过期后再次兑换沿用原名额
+	db.Model(&model.User{}).Where("id = ?", alice.ID).Update("expired_at", time.Now().Add(-time.Hour).Unix())
+	if _, err := redeem.Redeem(alice.ID, codes[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	if soldCount(limited.ID) != 1 {
+		t.Errorf("sold_count after expired renewal = %d, want 1", soldCount(limited.ID))
+	}
+
+	// 更换套餐释放原套餐名额
+	codes, err = redeem.GenerateCodes(&model.RedeemCode{Type: model.RedeemTypePlan, PlanID: &other.ID, Value: 30}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redeem.Redeem(alice.ID, codes[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	if soldCount(limited.ID) != 0 || soldCount(other.ID) != 1 {
+		t.Errorf("sold_count: limited = %d, other = %d", soldCount(limited.ID), soldCount(other.ID))
+	}
+}
+
+func TestRedeemTraffic(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.RedeemCode{}, &model.RedeemLog{}, &model.UserTrafficPack{})
+
+	const gb = int64(1024 * 1024 * 1024)
+	limited := &model.Plan{Name: "limited", TransferEnable: 100}
+	unlimited := &model.Plan{Name: "unlimited", TransferEnable: 0}
+	db.Create(limited)
+	db.Create(unlimited)
+	expiredAt := time.Now().Add(24 * time.Hour).Unix()
+	alice := &model.User{Email: "alice@example.com", UUID: "u1", Token: "t1", PlanID: &limited.ID, ExpiredAt: &expiredAt, TransferEnable: 100 * gb}
+	bob := &model.User{Email: "bob@example.com", UUID: "u2", Token: "t2", PlanID: &unlimited.ID, ExpiredAt: &expiredAt}
+	db.Create(alice)
+	db.Create(bob)
+
+	repos := repository.NewRepositories(db)
+	redeem := NewRedeemService(repos.RedeemCode, repos.RedeemLog, repos.User, repos.Plan, repos.UserTrafficPack)
+
+	limitUse := 10
+	codes, err := redeem.GenerateCodes(&model.RedeemCode{Type: model.RedeemTypeTraffic, Value: 10, LimitUse: &limitUse}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不限流量的套餐不能兑换流量，也不占用次数
+	if _, err := redeem.Redeem(bob.ID, codes[0].Code); err == nil {
+		t.Error("traffic redeemed on an unlimited plan")
+	}
+	if got, _ := repos.User.FindByID(bob.ID); got.TransferEnable != 0 || got.PackTraffic != 0 {
+		t.Errorf("unlimited plan capped: transfer = %d, pack = %d", got.TransferEnable, got.PackTraffic)
+	}
+	if code, _ := repos.RedeemCode.FindByID(codes[0].ID); code.UsedCount != 0 {
+		t.Errorf("used_count = %d, want 0", code.UsedCount)
+	}
+
+	// 流量以流量包发放，续费重置套餐流量后仍然保留
+	if _, err := redeem.Redeem(alice.ID, codes[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	renewal, err := redeem.GenerateCodes(&model.RedeemCode{Type: model.RedeemTypePlan, PlanID: &limited.ID, Value: 30}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redeem.Redeem(alice.ID, renewal[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := repos.User.FindByID(alice.ID)
+	if got.TransferEnable != 100*gb || got.PackTraffic != 10*gb || got.TotalTraffic() != 110*gb {
+		t.Errorf("after renewal: transfer = %d, pack = %d", got.TransferEnable, got.PackTraffic)
+	}
+	packs, _ := repos.UserTrafficPack.FindActiveByUserID(alice.ID)
+	if len(packs) != 1 || packs[0].Traffic != 10*gb {
+		t.Errorf("traffic packs = %+v", packs)
+	}
+}
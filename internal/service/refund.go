@@ -0,0 +1,354 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// RefundService 订单退款服务
+type RefundService struct {
+	orderRepo      *repository.OrderRepository
+	refundRepo     *repository.OrderRefundRepository
+	userRepo       *repository.UserRepository
+	planRepo       *repository.PlanRepository
+	commissionRepo *repository.CommissionLogRepository
+	userPackRepo   *repository.UserTrafficPackRepository
+	paymentSvc     *PaymentService
+}
+
+func NewRefundService(orderRepo *repository.OrderRepository, refundRepo *repository.OrderRefundRepository, userRepo *repository.UserRepository, planRepo *repository.PlanRepository, commissionRepo *repository.CommissionLogRepository, userPackRepo *repository.UserTrafficPackRepository, paymentSvc *PaymentService) *RefundService {
+	return &RefundService{
+		orderRepo:      orderRepo,
+		refundRepo:     refundRepo,
+		userRepo:       userRepo,
+		planRepo:       planRepo,
+		commissionRepo: commissionRepo,
+		userPackRepo:   userPackRepo,
+		paymentSvc:     paymentSvc,
+	}
+}
+
+// RefundRequest 退款参数，Amount 为 0 时退还全部剩余金额
+// 原路退款未填写 ExternalNo 时通过支付网关发起退款，网关只退还网关实收部分，
+// 订单中以余额抵扣的部分退回余额
+type RefundRequest struct {
+	Amount     int64
+	Method     string
+	ExternalNo string
+	Reason     string
+	OperatorID int64
+}
+
+// Refund 对已完成订单进行全额或部分退款
+// 按退款比例回收套餐时长与流量，并追回邀请人佣金
+// 先占用退款额度并完成网关退款，再在同一事务中更新用户、追回佣金并写入退款记录
+func (s *RefundService) Refund(orderID int64, req RefundRequest) (*model.OrderRefund, error) {
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, errors.New("order not found")
+	}
+	if order.Status != model.OrderStatusCompleted {
+		return nil, errors.New("only completed orders can be refunded")
+	}
+
+	refunded := int64(0)
+	if order.RefundAmount != nil {
+		refunded = *order.RefundAmount
+	}
+	remaining := order.TotalAmount - refunded
+	if remaining <= 0 {
+		return nil, errors.New("order has no refundable amount")
+	}
+	amount := req.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount < 0 || amount > remaining {
+		return nil, errors.New("invalid refund amount")
+	}
+
+	refund := &model.OrderRefund{
+		OrderID: order.ID,
+		TradeNo: order.TradeNo,
+		UserID:  order.UserID,
+		Amount:  amount,
+		Method:  req.Method,
+		Reason:  strings.TrimSpace(req.Reason),
+	}
+	switch req.Method {
+	case model.RefundMethodBalance:
+	case model.RefundMethodExternal:
+		if externalNo := strings.TrimSpace(req.ExternalNo); externalNo != "" {
+			refund.ExternalNo = &externalNo
+		}
+	default:
+		return nil, errors.New("invalid refund method")
+	}
+	if req.OperatorID > 0 {
+		refund.OperatorID = &req.OperatorID
+	}
+
+	// 网关退款金额不能超过网关实收且尚未原路退还的金额，其余部分退回余额
+	gateway := req.Method == model.RefundMethodExternal && refund.ExternalNo == nil
+	gatewayAmount := int64(0)
+	if gateway {
+		captured, err := s.gatewayRefundable(order)
+		if err != nil {
+			return nil, err
+		}
+		gatewayAmount = amount
+		if gatewayAmount > captured {
+			gatewayAmount = captured
+		}
+		refund.BalanceAmount = amount - gatewayAmount
+	} else if req.Method == model.RefundMethodBalance {
+		refund.BalanceAmount = amount
+	}
+
+	if user, err := s.userRepo.FindByID(order.UserID); err != nil || user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	// 先占用退款额度，防止并发重复退款
+	ok, err := s.orderRepo.AddRefund(order.ID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("refund amount exceeds paid amount")
+	}
+
+	if gatewayAmount > 0 {
+		externalNo, err := s.refundToGateway(order, gatewayAmount)
+		if err != nil {
+			// 网关退款失败，释放占用的退款额度
+			s.releaseRefund(order, amount)
+			return nil, err
+		}
+		refund.ExternalNo = &externalNo
+	}
+
+	ratio := float64(amount) / float64(order.TotalAmount)
+	err = s.userRepo.Transaction(func(tx *gorm.DB) error {
+		user, err := s.userRepo.WithTx(tx).FindByIDForUpdate(order.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return errors.New("user not found")
+		}
+
+		refund.RollbackSeconds, refund.RollbackTraffic = s.rollback(s.userPackRepo.WithTx(tx), user, order, ratio)
+		updates := map[string]interface{}{
+			"expired_at":      user.ExpiredAt,
+			"transfer_enable": user.TransferEnable,
+			"pack_traffic":    user.PackTraffic,
+		}
+		if refund.BalanceAmount > 0 {
+			updates["balance"] = gorm.Expr("balance + ?", order.ToBase(refund.BalanceAmount))
+		}
+		if err := tx.Model(&model.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		refund.CommissionAmount, err = s.reverseCommission(tx, order, amount, ratio)
+		if err != nil {
+			return err
+		}
+
+		refund.CreatedAt = time.Now().Unix()
+		refund.UpdatedAt = time.Now().Unix()
+		return s.refundRepo.WithTx(tx).Create(refund)
+	})
+	if err != nil {
+		if gatewayAmount > 0 {
+			// 网关已退款，保留占用的额度避免重复退款，由管理员核对后处理
+			log.Printf("[Refund] Order %s refunded via gateway (%s) but failed to record: %v", order.TradeNo, *refund.ExternalNo, err)
+		} else {
+			s.releaseRefund(order, amount)
+		}
+		return nil, err
+	}
+	return refund, nil
+}
+
+// releaseRefund 释放占用的退款额度，失败时记录日志以便人工核对
+func (s *RefundService) releaseRefund(order *model.Order, amount int64) {
+	if _, err := s.orderRepo.AddRefund(order.ID, -amount); err != nil {
+		log.Printf("[Refund] Failed to release reserved refund %d of order %s: %v", amount, order.TradeNo, err)
+	}
+}
+
+// gatewayRefundable 网关实收（扣除余额抵扣）且尚未原路退还的金额
+func (s *RefundService) gatewayRefundable(order *model.Order) (int64, error) {
+	refunds, err := s.refundRepo.FindByOrderID(order.ID)
+	if err != nil {
+		return 0, err
+	}
+	captured := order.DueAmount()
+	for _, r := range refunds {
+		if r.Method == model.RefundMethodExternal {
+			captured -= r.Amount - r.BalanceAmount
+		}
+	}
+	if captured < 0 {
+		captured = 0
+	}
+	return captured, nil
+}
+
+// refundToGateway 通过支付网关原路退款，退款请求号由订单号与退款序号组成
+func (s *RefundService) refundToGateway(order *model.Order, amount int64) (string, error) {
+	if s.paymentSvc == nil {
+		return "", errors.New("payment service not available")
+	}
+	refunds, err := s.refundRepo.FindByOrderID(order.ID)
+	if err != nil {
+		return "", err
+	}
+	refundNo := fmt.Sprintf("%s-R%d", order.TradeNo, len(refunds)+1)
+	return s.paymentSvc.RefundToGateway(order, amount, refundNo)
+}
+
+// rollback 按比例回收订单开通的套餐时长与流量，仅当用户仍在使用该套餐时生效
+func (s *RefundService) rollback(userPackRepo *repository.UserTrafficPackRepository, user *model.User, order *model.Order, ratio float64) (int64, int64) {
+	if order.Type == model.OrderTypeTrafficPack {
+		return 0, rollbackTrafficPack(userPackRepo, user, order, ratio)
+	}
+	if order.Type == model.OrderTypeResetTraffic || user.PlanID == nil || *user.PlanID != order.PlanID {
+		return 0, 0
+	}
+
+	var seconds, traffic int64
+	if days := model.GetPeriodDays(order.Period); days > 0 && user.ExpiredAt != nil {
+		seconds = int64(float64(days*86400) * ratio)
+		expiredAt := *user.ExpiredAt - seconds
+		user.ExpiredAt = &expiredAt
+	}
+
+	if plan, err := s.planRepo.FindByID(order.PlanID); err == nil {
+		traffic = int64(float64(plan.TransferEnable*1024*1024*1024) * ratio)
+		if traffic > user.TransferEnable {
+			traffic = user.TransferEnable
+		}
+		user.TransferEnable -= traffic
+	}
+	return seconds, traffic
+}
+
+// rollbackTrafficPack 按比例回收流量包未使用的流量
+func rollbackTrafficPack(userPackRepo *repository.UserTrafficPackRepository, user *model.User, order *model.Order, ratio float64) int64 {
+	pack, err := userPackRepo.FindByOrderID(order.ID)
+	if err != nil || pack.Status != model.TrafficPackActive {
+		return 0
+	}
+
+	traffic := int64(float64(pack.Traffic) * ratio)
+	if remaining := pack.Traffic - pack.Used; traffic > remaining {
+		traffic = remaining
+	}
+	if traffic > user.PackTraffic {
+		traffic = user.PackTraffic
+	}
+	if traffic <= 0 {
+		return 0
+	}
+	pack.Traffic -= traffic
+	if err := userPackRepo.Update(pack); err != nil {
+		return 0
+	}
+	user.PackTraffic -= traffic
+	return traffic
+}
+
+// reverseCommission 按比例追回订单产生的佣金，写入负数佣金记录
+// 佣金仍在持有期内时只写入待确认的负数记录，确认时与原佣金合并发放；
+// 已发放的佣金从佣金余额扣除，佣金余额允许为负，后续佣金到账时自动抵扣
+func (s *RefundService) reverseCommission(tx *gorm.DB, order *model.Order, amount int64, ratio float64) (int64, error) {
+	if order.CommissionStatus == model.CommissionStatusCancelled {
+		return 0, nil
+	}
+	pending := order.CommissionStatus == model.CommissionStatusPending
+
+	commissionRepo := s.commissionRepo.WithTx(tx)
+	logs, err := commissionRepo.FindByTradeNo(order.TradeNo)
+	if err != nil {
+		return 0, err
+	}
+
+	// 按邀请人汇总原始佣金与扣除已追回部分后的净额
+	var inviters []int64
+	original := make(map[int64]int64)
+	net := make(map[int64]int64)
+	tiers := make(map[int64]int)
+	for _, log := range logs {
+		if log.Status == model.CommissionStatusCancelled {
+			continue
+		}
+		if _, ok := net[log.InviteUserID]; !ok {
+			inviters = append(inviters, log.InviteUserID)
+			tiers[log.InviteUserID] = log.Tier
+		}
+		if log.GetAmount > 0 {
+			original[log.InviteUserID] += log.GetAmount
+		}
+		net[log.InviteUserID] += log.GetAmount
+	}
+
+	var total int64
+	for _, inviteUserID := range inviters {
+		reverse := int64(float64(original[inviteUserID]) * ratio)
+		if reverse > net[inviteUserID] {
+			reverse = net[inviteUserID]
+		}
+		if reverse <= 0 {
+			continue
+		}
+
+		status := model.CommissionStatusPending
+		if !pending {
+			result := tx.Model(&model.User{}).Where("id = ?", inviteUserID).
+				Update("commission_balance", gorm.Expr("commission_balance - ?", reverse))
+			if result.Error != nil {
+				return total, result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			status = model.CommissionStatusConfirmed
+		}
+		if err := commissionRepo.Create(&model.CommissionLog{
+			InviteUserID: inviteUserID,
+			UserID:       order.UserID,
+			TradeNo:      order.TradeNo,
+			OrderAmount:  -order.ToBase(amount),
+			GetAmount:    -reverse,
+			Tier:         tiers[inviteUserID],
+			Status:       status,
+			CreatedAt:    time.Now().Unix(),
+			UpdatedAt:    time.Now().Unix(),
+		}); err != nil {
+			return total, err
+		}
+		total += reverse
+	}
+	return total, nil
+}
+
+// GetRefunds 获取订单的退款记录
+func (s *RefundService) GetRefunds(orderID int64) ([]model.OrderRefund, error) {
+	return s.refundRepo.FindByOrderID(orderID)
+}
+
+// List 分页获取退款记录
+func (s *RefundService) List(page, pageSize int) ([]model.OrderRefund, int64, error) {
+	return s.refundRepo.List(page, pageSize)
+}
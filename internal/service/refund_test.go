@@ -0,0 +1,129 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/payment"
+	"dashgo/internal/repository"
+)
+
+func TestOrderRefund(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.OrderRefund{}, &model.CommissionLog{}, &model.UserTrafficPack{})
+
+	const gb = int64(1024 * 1024 * 1024)
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100}
+	db.Create(plan)
+	inviter := &model.User{Email: "inviter@example.com", UUID: "u1", Token: "t1", CommissionBalance: 300}
+	db.Create(inviter)
+	expiredAt := time.Now().Add(30 * 24 * time.Hour).Unix()
+	user := &model.User{Email: "user@example.com", UUID: "u2", Token: "t2", PlanID: &plan.ID, ExpiredAt: &expiredAt, TransferEnable: 100 * gb, InviteUserID: &inviter.ID}
+	db.Create(user)
+	order := &model.Order{UserID: user.ID, PlanID: plan.ID, Period: model.PeriodMonthly, TradeNo: "T1", TotalAmount: 1000, Type: model.OrderTypeNewPurchase, Status: model.OrderStatusCompleted, CommissionStatus: model.CommissionStatusConfirmed}
+	db.Create(order)
+	db.Create(&model.CommissionLog{InviteUserID: inviter.ID, UserID: user.ID, TradeNo: "T1", OrderAmount: 1000, GetAmount: 200, Status: model.CommissionStatusConfirmed})
+
+	repos := repository.NewRepositories(db)
+	refunds := NewRefundService(repos.Order, repos.OrderRefund, repos.User, repos.Plan, repos.CommissionLog, repos.UserTrafficPack, nil)
+
+	// 退还一半到余额：回收一半时长与流量，追回一半已发放佣金
+	refund, err := refunds.Refund(order.ID, RefundRequest{Amount: 500, Method: model.RefundMethodBalance, OperatorID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.RollbackSeconds != 15*86400 || refund.RollbackTraffic != 50*gb || refund.CommissionAmount != 100 {
+		t.Errorf("refund = %+v", refund)
+	}
+	got, _ := repos.User.FindByID(user.ID)
+	if got.Balance != 500 || got.TransferEnable != 50*gb || *got.ExpiredAt != expiredAt-15*86400 {
+		t.Errorf("user: balance = %d, transfer = %d, expired_at = %v", got.Balance, got.TransferEnable, got.ExpiredAt)
+	}
+	gotInviter, _ := repos.User.FindByID(inviter.ID)
+	if gotInviter.CommissionBalance != 200 {
+		t.Errorf("inviter commission = %d, want 200", gotInviter.CommissionBalance)
+	}
+
+	// 超出剩余可退金额
+	if _, err := refunds.Refund(order.ID, RefundRequest{Amount: 600, Method: model.RefundMethodBalance}); err == nil {
+		t.Error("refunded more than paid")
+	}
+
+	// 用户不存在时不占用退款额度
+	db.Delete(&model.User{}, user.ID)
+	if _, err := refunds.Refund(order.ID, RefundRequest{Method: model.RefundMethodBalance}); err == nil {
+		t.Error("refunded order of a missing user")
+	}
+	gotOrder, _ := repos.Order.FindByID(order.ID)
+	if gotOrder.RefundAmount == nil || *gotOrder.RefundAmount != 500 {
+		t.Errorf("refund amount = %v, want 500", gotOrder.RefundAmount)
+	}
+	if list, _ := refunds.GetRefunds(order.ID); len(list) != 1 {
+		t.Errorf("refund records = %d, want 1", len(list))
+	}
+}
+
+// refundGateway 记录原路退款金额的测试网关
+type refundGateway struct {
+	refunds []int64
+}
+
+func (g *refundGateway) Name() string            { return "refund_test" }
+func (g *refundGateway) Fields() []payment.Field { return nil }
+func (g *refundGateway) Create(payment.Config, *payment.Request) (*payment.Result, error) {
+	return nil, nil
+}
+func (g *refundGateway) Notify(payment.Config, *payment.Notification) (*payment.Trade, error) {
+	return nil, nil
+}
+func (g *refundGateway) Query(payment.Config, *payment.Request) (*payment.Trade, error) {
+	return nil, nil
+}
+func (g *refundGateway) Refund(_ payment.Config, req *payment.RefundRequest) (string, error) {
+	g.refunds = append(g.refunds, req.Amount)
+	return req.RefundNo, nil
+}
+
+func TestMixedPaymentRefund(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.OrderRefund{}, &model.CommissionLog{}, &model.UserTrafficPack{}, &model.Payment{}, &model.PaymentCallback{})
+
+	gateway := &refundGateway{}
+	payment.Register(gateway)
+	method := &model.Payment{UUID: "p1", Payment: gateway.Name(), Name: "test", Enable: true}
+	db.Create(method)
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1"}
+	db.Create(user)
+	// 实付 1000，其中 400 为余额抵扣，网关实收 600
+	balanceAmount := int64(400)
+	order := &model.Order{UserID: user.ID, PlanID: 1, Period: model.PeriodMonthly, TradeNo: "T1", TotalAmount: 1000, BalanceAmount: &balanceAmount, PaymentID: &method.ID, Type: model.OrderTypeNewPurchase, Status: model.OrderStatusCompleted, CommissionStatus: model.CommissionStatusCancelled}
+	db.Create(order)
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+	payments := NewPaymentService(repos.Payment, repos.Order, orders, repos.PaymentCallback)
+	refunds := NewRefundService(repos.Order, repos.OrderRefund, repos.User, repos.Plan, repos.CommissionLog, repos.UserTrafficPack, payments)
+
+	first, err := refunds.Refund(order.ID, RefundRequest{Amount: 500, Method: model.RefundMethodExternal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.BalanceAmount != 0 {
+		t.Errorf("first refund balance part = %d, want 0", first.BalanceAmount)
+	}
+
+	// 剩余 500 中网关只能退 100，余额抵扣的 400 退回余额
+	second, err := refunds.Refund(order.ID, RefundRequest{Method: model.RefundMethodExternal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Amount != 500 || second.BalanceAmount != 400 {
+		t.Errorf("second refund: amount = %d, balance part = %d", second.Amount, second.BalanceAmount)
+	}
+	if len(gateway.refunds) != 2 || gateway.refunds[0] != 500 || gateway.refunds[1] != 100 {
+		t.Errorf("gateway refunds = %v, want [500 100]", gateway.refunds)
+	}
+	got, _ := repos.User.FindByID(user.ID)
+	if got.Balance != 400 {
+		t.Errorf("balance = %d, want 400", got.Balance)
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"dashgo/internal/model"
+	"dashgo/internal/protocol"
+	"dashgo/internal/repository"
+	"dashgo/pkg/utils"
+)
+
+// 中转节点通过 ParentID 指向落地节点：
+// 用户连接中转节点（前置主机），前置主机的 sing-box 再以专用凭据连接落地节点。
+// 流量在中转节点按中转节点倍率计费，落地节点上的中转凭据不对应任何用户。
+
+// relayUUID 中转节点连接落地节点使用的凭据，由双方节点信息确定性派生
+func relayUUID(relay, parent *model.Server) string {
+	h := utils.SHA256(fmt.Sprintf("dashgo-relay-%d-%d-%d-%d", relay.ID, relay.CreatedAt, parent.ID, parent.CreatedAt))
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// relayUserName 落地节点上中转凭据的用户名，不会与用户 UUID 前缀冲突
+func relayUserName(relay *model.Server) string {
+	return fmt.Sprintf("relay-%d", relay.ID)
+}
+
+// relayOutboundTag 前置主机上连接落地节点的出站 tag
+func relayOutboundTag(relay *model.Server) string {
+	return fmt.Sprintf("relay-out-%d", relay.ID)
+}
+
+// isRelayableType sing-box 可承载中转的节点类型
+func isRelayableType(serverType string) bool {
+	switch serverType {
+	case model.ServerTypeMieru, model.ServerTypeWireGuard:
+		return false
+	}
+	return true
+}
+
+// buildRelayOutbound 构建中转节点连接落地节点的出站
+func buildRelayOutbound(relay, parent *model.Server) map[string]interface{} {
+	uuid := relayUUID(relay, parent)
+	info := model.ServerInfo{Server: *parent, Password: uuid}
+
+	// 端口范围取起始端口，避免每次下发配置都变化
+	if strings.Contains(parent.Port, "-") {
+		info.Ports = parent.Port
+		info.Port = strings.SplitN(parent.Port, "-", 2)[0]
+	}
+
+	cipher := ""
+	if parent.Type == model.ServerTypeShadowsocks {
+		cipher = shadowsocksCipher(parent.ProtocolSettings)
+		info.Password = utils.GenerateSS2022Password(cipher, parent.CreatedAt, uuid)
+	}
+
+	outbound := protocol.BuildSingBoxOutbound(info, &model.User{UUID: uuid})
+	if outbound == nil {
+		return nil
+	}
+	// 加密方式与落地节点入站保持一致
+	if cipher != "" {
+		outbound["method"] = cipher
+	}
+	outbound["tag"] = relayOutboundTag(relay)
+	return outbound
+}
+
+// validateRelay 校验中转节点配置，禁止多级中转与不支持的协议
+func validateRelay(serverRepo *repository.ServerRepository, server *model.Server) error {
+	if server.ParentID == nil || *server.ParentID == 0 {
+		server.ParentID = nil
+		return nil
+	}
+	if server.ID != 0 && *server.ParentID == server.ID {
+		return errors.New("server cannot relay to itself")
+	}
+
+	parent, err := serverRepo.FindByID(*server.ParentID)
+	if err != nil {
+		return errors.New("parent server not found")
+	}
+	if parent.ParentID != nil {
+		return errors.New("parent server is a relay")
+	}
+	if !isRelayableType(server.Type) || !isRelayableType(parent.Type) {
+		return errors.New("server type does not support relay")
+	}
+
+	if server.ID != 0 {
+		children, err := serverRepo.FindByParentID(server.ID)
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			return errors.New("server has relay nodes")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestRelayShadowsocksCipher(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Server{})
+
+	// 同时设置 method 与 cipher 时，中转出站与落地入站必须一致
+	parent := &model.Server{Name: "landing", Type: model.ServerTypeShadowsocks, Host: "landing.example.com", Port: "8388", ServerPort: 8388,
+		ProtocolSettings: model.JSONMap{"method": "2022-blake3-aes-128-gcm", "cipher": "aes-256-gcm"}}
+	db.Create(parent)
+	relay := &model.Server{Name: "relay", Type: model.ServerTypeShadowsocks, Host: "relay.example.com", Port: "8388", ServerPort: 8388, ParentID: &parent.ID}
+	db.Create(relay)
+
+	repos := repository.NewRepositories(db)
+	hosts := NewHostService(repos.Host, repos.ServerNode, repos.User, repos.Server, repos.ServerRoute, nil)
+
+	inbound := hosts.buildInboundFromServer(parent)
+	outbound := buildRelayOutbound(relay, parent)
+	if outbound["method"] != inbound["method"] {
+		t.Fatalf("relay method = %v, landing method = %v", outbound["method"], inbound["method"])
+	}
+
+	users, err := hosts.GetUsersForServer(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := outbound["password"].(string)
+	for _, u := range users {
+		if u["name"] == relayUserName(relay) {
+			if !strings.HasSuffix(password, ":"+u["password"].(string)) || !strings.HasPrefix(password, inbound["password"].(string)+":") {
+				t.Errorf("relay password %q does not match landing keys %v / %v", password, inbound["password"], u["password"])
+			}
+			return
+		}
+	}
+	t.Error("relay credential missing on landing server")
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"log"
 	"time"
 
@@ -15,6 +16,16 @@ type SchedulerService struct {
 	statRepo    *repository.StatRepository
 	mailService *MailService
 	tgService   *TelegramService
+
+	// 自动续费依赖
+	renewalRepo    *repository.RenewalAttemptRepository
+	orderService   *OrderService
+	paymentService *PaymentService
+	settingService *SettingService
+
+	packService *TrafficPackService
+	waitlist    *WaitlistService
+	invite      *InviteService
 }
 
 func NewSchedulerService(
@@ -33,6 +44,29 @@ func NewSchedulerService(
 	}
 }
 
+// SetRenewalServices 设置自动续费依赖
+func (s *SchedulerService) SetRenewalServices(renewalRepo *repository.RenewalAttemptRepository, orderService *OrderService, paymentService *PaymentService, settingService *SettingService) {
+	s.renewalRepo = renewalRepo
+	s.orderService = orderService
+	s.paymentService = paymentService
+	s.settingService = settingService
+}
+
+// SetTrafficPackService 设置流量包服务
+func (s *SchedulerService) SetTrafficPackService(packService *TrafficPackService) {
+	s.packService = packService
+}
+
+// SetWaitlistService 设置套餐候补服务
+func (s *SchedulerService) SetWaitlistService(waitlist *WaitlistService) {
+	s.waitlist = waitlist
+}
+
+// SetInviteService 设置邀请服务（确认持有期满的佣金）
+func (s *SchedulerService) SetInviteService(invite *InviteService) {
+	s.invite = invite
+}
+
 // Start 启动定时任务
 func (s *SchedulerService) Start() {
 	// 每天凌晨执行
@@ -92,16 +126,19 @@ func (s *SchedulerService) dailyTasks() {
 		s.GenerateMonthlyStats()
 	}
 
-	// 2. 发送到期提醒
+	// 2. 自动续费（在到期提醒之前，续费成功的用户不再收到提醒）
+	s.autoRenew()
+
+	// 3. 发送到期提醒
 	s.sendExpireReminders()
 
-	// 3. 清理过期订单
+	// 4. 清理过期订单
 	s.cleanExpiredOrders()
 
-	// 4. 生成每日统计
+	// 5. 生成每日统计
 	s.generateDailyStats()
 
-	// 5. 清理旧的流量日志（每周一次）
+	// 6. 清理旧的流量日志（每周一次）
 	if time.Now().Weekday() == time.Monday {
 		s.CleanOldTrafficLogs()
 	}
@@ -109,13 +146,49 @@ func (s *SchedulerService) dailyTasks() {
 
 // hourlyTasks 每小时任务
 func (s *SchedulerService) hourlyTasks() {
-	// 1. 发送流量预警
+	// 1. 结算到期流量包
+	s.expireTrafficPacks()
+
+	// 2. 发送流量预警
 	s.sendTrafficWarnings()
+
+	// 3. 确认持有期满的邀请佣金
+	s.confirmCommissions()
+}
+
+// confirmCommissions 发放持有期满的佣金，订单已取消或全额退款的佣金作废
+func (s *SchedulerService) confirmCommissions() {
+	if s.invite == nil {
+		return
+	}
+	confirmed, cancelled, err := s.invite.ConfirmCommissions()
+	if err != nil {
+		log.Printf("[Scheduler] Failed to confirm commissions: %v", err)
+	}
+	if confirmed > 0 || cancelled > 0 {
+		log.Printf("[Scheduler] Commissions confirmed for %d orders, cancelled for %d orders", confirmed, cancelled)
+	}
 }
 
 // minutelyTasks 每分钟任务
 func (s *SchedulerService) minutelyTasks() {
-	// 可以添加需要频繁执行的任务
+	// 1. 回收超时的候补保留名额并通知下一批候补用户
+	s.processWaitlist()
+}
+
+// processWaitlist 处理套餐候补队列
+func (s *SchedulerService) processWaitlist() {
+	if s.waitlist == nil {
+		return
+	}
+	count, err := s.waitlist.ProcessExpired()
+	if err != nil {
+		log.Printf("[Scheduler] Failed to process plan waitlist: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("[Scheduler] Notified %d waitlisted users", count)
+	}
 }
 
 // resetMonthlyTraffic 重置月流量
@@ -129,9 +202,8 @@ func (s *SchedulerService) resetMonthlyTraffic() {
 	}
 
 	for _, user := range users {
-		user.U = 0
-		user.D = 0
-		if err := s.userRepo.Update(&user); err != nil {
+		// 流量包跨周期保留，清零前先结算本周期用量
+		if err := s.resetUsage(&user); err != nil {
 			log.Printf("[Scheduler] Failed to reset traffic for user %d: %v", user.ID, err)
 		}
 	}
@@ -139,6 +211,16 @@ func (s *SchedulerService) resetMonthlyTraffic() {
 	log.Printf("[Scheduler] Reset traffic for %d users", len(users))
 }
 
+// resetUsage 清零用户已用流量，未设置流量包服务时直接清零
+func (s *SchedulerService) resetUsage(user *model.User) error {
+	if s.packService != nil {
+		return s.packService.ResetUsage(user)
+	}
+	user.U = 0
+	user.D = 0
+	return s.userRepo.Update(user)
+}
+
 // sendExpireReminders 发送到期提醒
 func (s *SchedulerService) sendExpireReminders() {
 	log.Println("[Scheduler] Sending expire reminders...")
@@ -174,6 +256,124 @@ func (s *SchedulerService) sendExpireReminders() {
 	log.Printf("[Scheduler] Sent expire reminders to %d users", len(users))
 }
 
+// autoRenew 为开启自动续费且即将到期的用户创建续费订单并使用余额支付
+func (s *SchedulerService) autoRenew() {
+	if s.renewalRepo == nil || s.orderService == nil || s.paymentService == nil {
+		return
+	}
+	log.Println("[Scheduler] Running auto renewal...")
+
+	days := 3
+	if s.settingService != nil {
+		days = s.settingService.GetInt(SettingAutoRenewDays, days)
+	}
+	users, err := s.userRepo.GetAutoRenewUsers(days)
+	if err != nil {
+		log.Printf("[Scheduler] Failed to get auto renew users: %v", err)
+		return
+	}
+
+	renewed := 0
+	for i := range users {
+		attempt := s.renewUser(&users[i])
+		if attempt == nil {
+			continue
+		}
+		if err := s.renewalRepo.Create(attempt); err != nil {
+			log.Printf("[Scheduler] Failed to record renewal for user %d: %v", users[i].ID, err)
+		}
+		if attempt.Status == model.RenewalStatusPaid {
+			renewed++
+		}
+	}
+
+	log.Printf("[Scheduler] Auto renewed %d of %d users", renewed, len(users))
+}
+
+// renewUser 尝试为用户续费，返回本次尝试记录；本周期已续费时返回 nil
+// 同一到期时间的重复尝试复用之前创建且仍待支付的订单
+func (s *SchedulerService) renewUser(user *model.User) *model.RenewalAttempt {
+	attempt := &model.RenewalAttempt{
+		UserID:    user.ID,
+		ExpiredAt: *user.ExpiredAt,
+		PlanID:    *user.PlanID,
+	}
+	fail := func(err error) *model.RenewalAttempt {
+		msg := err.Error()
+		attempt.Status = model.RenewalStatusFailed
+		attempt.Error = &msg
+		log.Printf("[Scheduler] Auto renewal failed for user %d: %v", user.ID, err)
+		return attempt
+	}
+
+	latest, err := s.renewalRepo.FindLatest(user.ID, attempt.ExpiredAt)
+	if err != nil {
+		return fail(err)
+	}
+	if latest != nil && latest.Status == model.RenewalStatusPaid {
+		return nil
+	}
+
+	// 复用上次创建的待支付订单
+	var order *model.Order
+	if latest != nil && latest.OrderID != nil {
+		if prev, err := s.orderRepo.FindByID(*latest.OrderID); err == nil && prev.Status == model.OrderStatusPending {
+			order = prev
+		}
+	}
+	if order == nil {
+		last, err := s.orderRepo.FindLastCompletedByPlan(user.ID, attempt.PlanID)
+		if err != nil {
+			return fail(errors.New("no previous order to renew"))
+		}
+		if order, err = s.orderService.CreateOrder(user.ID, attempt.PlanID, last.Period); err != nil {
+			return fail(err)
+		}
+	}
+	attempt.Period = order.Period
+	attempt.OrderID = &order.ID
+	attempt.Amount = order.TotalAmount
+
+	if user.Balance < order.ToBase(order.DueAmount()) {
+		attempt.Status = model.RenewalStatusInsufficient
+		s.notifyRenewalFailed(user, order)
+		return attempt
+	}
+
+	if err := s.paymentService.PayWithBalance(order.TradeNo, user.ID); err != nil {
+		return fail(err)
+	}
+	attempt.Status = model.RenewalStatusPaid
+	return attempt
+}
+
+// notifyRenewalFailed 通知用户余额不足无法自动续费
+func (s *SchedulerService) notifyRenewalFailed(user *model.User, order *model.Order) {
+	daysLeft := int((*user.ExpiredAt - time.Now().Unix()) / 86400)
+
+	if err := s.mailService.SendRenewalFailed(user, order, daysLeft); err != nil {
+		log.Printf("[Scheduler] Failed to send renewal email to %s: %v", user.Email, err)
+	}
+	if err := s.tgService.NotifyRenewalFailed(user, order, daysLeft); err != nil {
+		log.Printf("[Scheduler] Failed to send renewal telegram to user %d: %v", user.ID, err)
+	}
+}
+
+// expireTrafficPacks 结算到期流量包
+func (s *SchedulerService) expireTrafficPacks() {
+	if s.packService == nil {
+		return
+	}
+	count, err := s.packService.ExpirePacks()
+	if err != nil {
+		log.Printf("[Scheduler] Failed to expire traffic packs: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("[Scheduler] Settled expired traffic packs for %d users", count)
+	}
+}
+
 // sendTrafficWarnings 发送流量预警
 func (s *SchedulerService) sendTrafficWarnings() {
 	// 获取流量使用超过 80% 的用户
@@ -188,8 +388,8 @@ func (s *SchedulerService) sendTrafficWarnings() {
 		}
 
 		usedPercent := 0
-		if user.TransferEnable > 0 {
-			usedPercent = int((user.U + user.D) * 100 / user.TransferEnable)
+		if total := user.TotalTraffic(); total > 0 {
+			usedPercent = int((user.U + user.D) * 100 / total)
 		}
 
 		// 发送邮件
@@ -204,8 +404,14 @@ func (s *SchedulerService) sendTrafficWarnings() {
 func (s *SchedulerService) cleanExpiredOrders() {
 	log.Println("[Scheduler] Cleaning expired orders...")
 
-	// 取消超过 24 小时未支付的订单
-	count, err := s.orderRepo.CancelExpiredOrders(24 * 60 * 60)
+	// 取消超过 24 小时未支付的订单（余额抵扣部分退回）
+	var count int64
+	var err error
+	if s.orderService != nil {
+		count, err = s.orderService.CancelExpiredOrders(24 * 60 * 60)
+	} else {
+		count, err = s.orderRepo.CancelExpiredOrders(24 * 60 * 60)
+	}
 	if err != nil {
 		log.Printf("[Scheduler] Failed to cancel expired orders: %v", err)
 		return
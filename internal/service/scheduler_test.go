@@ -0,0 +1,59 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dashgo/internal/config"
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestAutoRenewReusesPendingOrder(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.Coupon{}, &model.RenewalAttempt{})
+
+	price := int64(1000)
+	plan := &model.Plan{Name: "monthly", TransferEnable: 100, MonthPrice: &price}
+	db.Create(plan)
+	expiredAt := time.Now().Add(24 * time.Hour).Unix()
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1", PlanID: &plan.ID, ExpiredAt: &expiredAt, AutoRenew: true}
+	db.Create(user)
+	db.Create(&model.Order{UserID: user.ID, PlanID: plan.ID, Period: model.PeriodMonthly, TradeNo: "T1", TotalAmount: price, Type: model.OrderTypeNewPurchase, Status: model.OrderStatusCompleted})
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+	payments := NewPaymentService(repos.Payment, repos.Order, orders, repos.PaymentCallback)
+	scheduler := NewSchedulerService(repos.User, repos.Order, repos.Stat, NewMailService(config.MailConfig{}), NewTelegramService(config.TelegramConfig{}))
+	scheduler.SetRenewalServices(repos.RenewalAttempt, orders, payments, nil)
+
+	// 余额不足时重复执行只创建一个续费订单
+	scheduler.autoRenew()
+	scheduler.autoRenew()
+
+	var pending int64
+	db.Model(&model.Order{}).Where("status = ?", model.OrderStatusPending).Count(&pending)
+	if pending != 1 {
+		t.Fatalf("pending renewal orders = %d, want 1", pending)
+	}
+
+	// 充值后支付同一订单
+	db.Model(&model.User{}).Where("id = ?", user.ID).Update("balance", price)
+	scheduler.autoRenew()
+
+	var attempts []model.RenewalAttempt
+	db.Order("id ASC").Find(&attempts)
+	if len(attempts) != 3 {
+		t.Fatalf("attempts = %d, want 3", len(attempts))
+	}
+	if attempts[0].Status != model.RenewalStatusInsufficient || attempts[2].Status != model.RenewalStatusPaid {
+		t.Errorf("attempt statuses = %s, %s", attempts[0].Status, attempts[2].Status)
+	}
+	if *attempts[0].OrderID != *attempts[2].OrderID {
+		t.Errorf("renewal paid a different order")
+	}
+
+	got, _ := repos.User.FindByID(user.ID)
+	if got.Balance != 0 || *got.ExpiredAt <= expiredAt {
+		t.Errorf("user after renewal: balance = %d, expired_at = %d", got.Balance, *got.ExpiredAt)
+	}
+}
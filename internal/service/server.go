@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +19,8 @@ type ServerService struct {
 	userRepo   *repository.UserRepository
 	cache      *cache.Client
 	cfg        *config.Config
+	wireguard  *WireGuardService
+	settingSvc *SettingService
 }
 
 func NewServerService(serverRepo *repository.ServerRepository, userRepo *repository.UserRepository, cache *cache.Client, cfg *config.Config) *ServerService {
@@ -29,6 +32,16 @@ func NewServerService(serverRepo *repository.ServerRepository, userRepo *reposit
 	}
 }
 
+// SetWireGuardService 设置 WireGuard 服务
+func (s *ServerService) SetWireGuardService(wireguard *WireGuardService) {
+	s.wireguard = wireguard
+}
+
+// SetSettingService 设置 Setting 服务
+func (s *ServerService) SetSettingService(settingSvc *SettingService) {
+	s.settingSvc = settingSvc
+}
+
 // GetAllServers 获取所有服务器
 func (s *ServerService) GetAllServers() ([]model.Server, error) {
 	return s.serverRepo.GetAllServers()
@@ -73,6 +86,18 @@ func (s *ServerService) BuildServerInfo(server *model.Server, user *model.User)
 	// 生成用户密码
 	info.Password = s.generateServerPassword(server, user)
 
+	// 启用时段倍率的节点在名称中显示当前倍率
+	if s.settingSvc != nil {
+		info.Name = server.NameAt(s.settingSvc.RateTime())
+	}
+
+	// WireGuard 附带用户 peer
+	if server.Type == model.ServerTypeWireGuard && s.wireguard != nil {
+		if peer, err := s.wireguard.GetOrCreatePeer(user.ID); err == nil {
+			info.WireGuard = peer
+		}
+	}
+
 	return info
 }
 
@@ -202,6 +227,11 @@ func (s *ServerService) GetServerConfig(server *model.Server) map[string]interfa
 			config["server_name"] = tls["server_name"]
 		}
 		config["congestion_control"] = ps["congestion_control"]
+
+	case model.ServerTypeMieru:
+		config["transport"] = ps["transport"]
+		config["multiplexing"] = ps["multiplexing"]
+		config["mtu"] = ps["mtu"]
 	}
 
 	config["base_config"] = map[string]interface{}{
@@ -247,15 +277,48 @@ func (s *ServerService) FindServer(serverID int64, serverType string) (*model.Se
 
 // CreateServer 创建服务告
 func (s *ServerService) CreateServer(server *model.Server) error {
+	if err := validateRelay(s.serverRepo, server); err != nil {
+		return err
+	}
+	if _, err := model.ParseRateTimeRanges(server.RateTimeRanges); err != nil {
+		return err
+	}
+	if server.Type == model.ServerTypeWireGuard {
+		ps, err := ensureWireGuardServerKey(&server.WireGuardKey, server.ProtocolSettings)
+		if err != nil {
+			return err
+		}
+		server.ProtocolSettings = ps
+	}
 	return s.serverRepo.Create(server)
 }
 
 // UpdateServer 更新服务告
 func (s *ServerService) UpdateServer(server *model.Server) error {
+	if err := validateRelay(s.serverRepo, server); err != nil {
+		return err
+	}
+	if _, err := model.ParseRateTimeRanges(server.RateTimeRanges); err != nil {
+		return err
+	}
+	if server.Type == model.ServerTypeWireGuard {
+		ps, err := ensureWireGuardServerKey(&server.WireGuardKey, server.ProtocolSettings)
+		if err != nil {
+			return err
+		}
+		server.ProtocolSettings = ps
+	}
 	return s.serverRepo.Update(server)
 }
 
 // DeleteServer 删除服务告
 func (s *ServerService) DeleteServer(id int64) error {
+	children, err := s.serverRepo.FindByParentID(id)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return errors.New("server has relay nodes")
+	}
 	return s.serverRepo.Delete(id)
 }
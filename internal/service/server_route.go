@@ -0,0 +1,295 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+// ServerRouteService 路由规则服务
+type ServerRouteService struct {
+	routeRepo *repository.ServerRouteRepository
+}
+
+func NewServerRouteService(routeRepo *repository.ServerRouteRepository) *ServerRouteService {
+	return &ServerRouteService{
+		routeRepo: routeRepo,
+	}
+}
+
+// GetAll 获取所有路由规则
+func (s *ServerRouteService) GetAll() ([]model.ServerRoute, error) {
+	return s.routeRepo.GetAll()
+}
+
+// GetByID 根据 ID 获取路由规则
+func (s *ServerRouteService) GetByID(id int64) (*model.ServerRoute, error) {
+	return s.routeRepo.FindByID(id)
+}
+
+// Create 创建路由规则
+func (s *ServerRouteService) Create(route *model.ServerRoute) error {
+	if err := ValidateServerRoute(route); err != nil {
+		return err
+	}
+	route.CreatedAt = time.Now().Unix()
+	route.UpdatedAt = time.Now().Unix()
+	return s.routeRepo.Create(route)
+}
+
+// Update 更新路由规则
+func (s *ServerRouteService) Update(route *model.ServerRoute) error {
+	if err := ValidateServerRoute(route); err != nil {
+		return err
+	}
+	route.UpdatedAt = time.Now().Unix()
+	return s.routeRepo.Update(route)
+}
+
+// Delete 删除路由规则
+func (s *ServerRouteService) Delete(id int64) error {
+	return s.routeRepo.Delete(id)
+}
+
+// ValidateServerRoute 校验路由规则的动作与匹配项
+func ValidateServerRoute(route *model.ServerRoute) error {
+	matches := route.GetMatches()
+	if len(matches) == 0 {
+		return errors.New("route match is empty")
+	}
+	for _, m := range matches {
+		if _, _, err := parseRouteMatch(m); err != nil {
+			return err
+		}
+	}
+
+	actionValue := ""
+	if route.ActionValue != nil {
+		actionValue = strings.TrimSpace(*route.ActionValue)
+	}
+	switch route.Action {
+	case model.RouteActionBlock, model.RouteActionDirect, model.RouteActionSocks:
+	case model.RouteActionDNS:
+		if actionValue == "" {
+			return errors.New("dns route requires a dns server")
+		}
+	default:
+		return errors.New("invalid route action")
+	}
+	return nil
+}
+
+// parseRouteMatch 将 type:value 形式的匹配项转换为 sing-box 规则字段
+// 无前缀时按关键字匹配；geosite/geoip 转换为远程 rule-set
+func parseRouteMatch(match string) (field string, value interface{}, err error) {
+	kind, val := "keyword", match
+	if i := strings.Index(match, ":"); i > 0 {
+		kind, val = strings.ToLower(match[:i]), strings.TrimSpace(match[i+1:])
+	}
+	if val == "" {
+		return "", nil, fmt.Errorf("invalid route match: %s", match)
+	}
+
+	switch kind {
+	case "domain", "full":
+		return "domain", val, nil
+	case "domain_suffix", "suffix":
+		return "domain_suffix", val, nil
+	case "keyword", "domain_keyword":
+		return "domain_keyword", val, nil
+	case "regexp", "domain_regex":
+		return "domain_regex", val, nil
+	case "ip", "ip_cidr":
+		return "ip_cidr", val, nil
+	case "geosite":
+		return "rule_set", "geosite-" + strings.ToLower(val), nil
+	case "geoip":
+		return "rule_set", "geoip-" + strings.ToLower(val), nil
+	case "protocol":
+		return "protocol", strings.ToLower(val), nil
+	case "port":
+		port, err := strconv.Atoi(val)
+		if err != nil || port <= 0 || port > 65535 {
+			return "", nil, fmt.Errorf("invalid route match: %s", match)
+		}
+		return "port", port, nil
+	}
+	return "", nil, fmt.Errorf("invalid route match: %s", match)
+}
+
+// routeConfig 收集主机上各入站绑定的路由规则并生成 sing-box 配置
+type routeConfig struct {
+	order      []int64
+	inbounds   map[int64][]string
+	routes     map[int64]model.ServerRoute
+	socksOut   string // 主机 SOCKS 出口 tag，为空表示未配置
+	parseSocks func(string) map[string]interface{}
+}
+
+func newRouteConfig(socksOut string, parseSocks func(string) map[string]interface{}) *routeConfig {
+	return &routeConfig{
+		inbounds:   make(map[int64][]string),
+		routes:     make(map[int64]model.ServerRoute),
+		socksOut:   socksOut,
+		parseSocks: parseSocks,
+	}
+}
+
+// attach 记录入站 tag 使用的路由规则 ID
+func (r *routeConfig) attach(tag string, routeIDs []int64) {
+	for _, id := range routeIDs {
+		if _, ok := r.inbounds[id]; !ok {
+			r.order = append(r.order, id)
+		}
+		r.inbounds[id] = append(r.inbounds[id], tag)
+	}
+}
+
+// load 加载已绑定的路由规则
+func (r *routeConfig) load(routeRepo *repository.ServerRouteRepository) error {
+	if len(r.order) == 0 || routeRepo == nil {
+		return nil
+	}
+	routes, err := routeRepo.FindByIDs(r.order)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		r.routes[route.ID] = route
+	}
+	return nil
+}
+
+// routeResult 路由规则生成的 sing-box 配置片段
+type routeResult struct {
+	rules     []map[string]interface{}
+	ruleSets  []map[string]interface{}
+	outbounds []map[string]interface{}
+	dns       map[string]interface{}
+}
+
+// build 生成 route.rules / route.rule_set / dns / 额外出站
+func (r *routeConfig) build() *routeResult {
+	result := &routeResult{}
+	var (
+		dnsServers  []map[string]interface{}
+		dnsRules    []map[string]interface{}
+		ruleSetSeen = make(map[string]bool)
+		sniffTags   []string
+		sniffSeen   = make(map[string]bool)
+	)
+
+	for _, id := range r.order {
+		route, ok := r.routes[id]
+		if !ok {
+			continue
+		}
+		tags := r.inbounds[id]
+
+		rule := map[string]interface{}{"inbound": tags}
+		for _, m := range route.GetMatches() {
+			field, value, err := parseRouteMatch(m)
+			if err != nil {
+				continue
+			}
+			values, _ := rule[field].([]interface{})
+			rule[field] = append(values, value)
+			if field == "rule_set" && !ruleSetSeen[value.(string)] {
+				ruleSetSeen[value.(string)] = true
+				result.ruleSets = append(result.ruleSets, remoteRuleSet(value.(string)))
+			}
+		}
+		if len(rule) == 1 {
+			continue
+		}
+
+		actionValue := ""
+		if route.ActionValue != nil {
+			actionValue = strings.TrimSpace(*route.ActionValue)
+		}
+
+		switch route.Action {
+		case model.RouteActionBlock:
+			rule["outbound"] = "block"
+		case model.RouteActionDirect:
+			rule["outbound"] = "direct"
+		case model.RouteActionSocks:
+			if actionValue != "" {
+				out := r.parseSocks(actionValue)
+				if out == nil {
+					continue
+				}
+				out["tag"] = fmt.Sprintf("route-out-%d", route.ID)
+				result.outbounds = append(result.outbounds, out)
+				rule["outbound"] = out["tag"]
+			} else if r.socksOut != "" {
+				rule["outbound"] = r.socksOut
+			} else {
+				continue
+			}
+		case model.RouteActionDNS:
+			// DNS 规则只支持域名类匹配
+			dnsRule := map[string]interface{}{"inbound": tags}
+			for field, value := range rule {
+				switch field {
+				case "domain", "domain_suffix", "domain_keyword", "domain_regex", "rule_set":
+					dnsRule[field] = value
+				}
+			}
+			if len(dnsRule) == 1 || actionValue == "" {
+				continue
+			}
+			serverTag := fmt.Sprintf("route-dns-%d", route.ID)
+			dnsServers = append(dnsServers, map[string]interface{}{"tag": serverTag, "address": actionValue})
+			dnsRule["server"] = serverTag
+			dnsRules = append(dnsRules, dnsRule)
+			rule = nil
+		default:
+			continue
+		}
+
+		for _, tag := range tags {
+			if !sniffSeen[tag] {
+				sniffSeen[tag] = true
+				sniffTags = append(sniffTags, tag)
+			}
+		}
+		if rule != nil {
+			result.rules = append(result.rules, rule)
+		}
+	}
+
+	// 域名匹配依赖嗅探
+	if len(sniffTags) > 0 {
+		result.rules = append([]map[string]interface{}{{"inbound": sniffTags, "action": "sniff"}}, result.rules...)
+	}
+
+	if len(dnsServers) > 0 {
+		result.dns = map[string]interface{}{
+			// 第一个服务器为默认 DNS
+			"servers": append([]map[string]interface{}{{"tag": "dns-local", "address": "local"}}, dnsServers...),
+			"rules":   dnsRules,
+		}
+	}
+	return result
+}
+
+// remoteRuleSet 使用 SagerNet 官方 geosite/geoip rule-set
+func remoteRuleSet(tag string) map[string]interface{} {
+	repo := "sing-geosite"
+	if strings.HasPrefix(tag, "geoip-") {
+		repo = "sing-geoip"
+	}
+	return map[string]interface{}{
+		"type":            "remote",
+		"tag":             tag,
+		"format":          "binary",
+		"url":             fmt.Sprintf("https://raw.githubusercontent.com/SagerNet/%s/rule-set/%s.srs", repo, tag),
+		"download_detour": "direct",
+	}
+}
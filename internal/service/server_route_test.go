@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+
+	"dashgo/internal/model"
+)
+
+func TestParseRouteMatch(t *testing.T) {
+	tests := []struct {
+		match string
+		field string
+		value interface{}
+		ok    bool
+	}{
+		{"domain:example.com", "domain", "example.com", true},
+		{"domain_suffix:example.com", "domain_suffix", "example.com", true},
+		{"keyword:ads", "domain_keyword", "ads", true},
+		{"ads", "domain_keyword", "ads", true},
+		{"ip_cidr:10.0.0.0/8", "ip_cidr", "10.0.0.0/8", true},
+		{"geosite:Category-Ads-All", "rule_set", "geosite-category-ads-all", true},
+		{"protocol:bittorrent", "protocol", "bittorrent", true},
+		{"port:25", "port", 25, true},
+		{"port:abc", "", nil, false},
+		{"unknown:x", "", nil, false},
+		{"domain:", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		field, value, err := parseRouteMatch(tt.match)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseRouteMatch(%q) err = %v, want ok = %v", tt.match, err, tt.ok)
+			continue
+		}
+		if tt.ok && (field != tt.field || value != tt.value) {
+			t.Errorf("parseRouteMatch(%q) = %s, %v; want %s, %v", tt.match, field, value, tt.field, tt.value)
+		}
+	}
+}
+
+func TestRouteConfigBuild(t *testing.T) {
+	dns := "8.8.8.8"
+	routes := newRouteConfig("", (&HostService{}).parseSocksOutbound)
+	routes.attach("vless-in-1", []int64{1, 2, 3})
+	routes.attach("trojan-in-2", []int64{1})
+	routes.routes[1] = model.ServerRoute{ID: 1, Match: "protocol:bittorrent\ngeosite:category-ads-all", Action: model.RouteActionBlock}
+	routes.routes[2] = model.ServerRoute{ID: 2, Match: `["domain_suffix:netflix.com"]`, Action: model.RouteActionSocks}
+	routes.routes[3] = model.ServerRoute{ID: 3, Match: "domain_suffix:google.com", Action: model.RouteActionDNS, ActionValue: &dns}
+
+	result := routes.build()
+
+	// sniff + block；socks 规则因主机未配置 SOCKS 出口被跳过
+	if len(result.rules) != 2 {
+		t.Fatalf("rules = %v, want 2", result.rules)
+	}
+	if result.rules[0]["action"] != "sniff" {
+		t.Errorf("first rule = %v, want sniff", result.rules[0])
+	}
+	block := result.rules[1]
+	if block["outbound"] != "block" || len(block["inbound"].([]string)) != 2 {
+		t.Errorf("block rule = %v", block)
+	}
+	if len(result.ruleSets) != 1 || result.ruleSets[0]["tag"] != "geosite-category-ads-all" {
+		t.Errorf("rule sets = %v", result.ruleSets)
+	}
+	if result.dns == nil || len(result.dns["rules"].([]map[string]interface{})) != 1 {
+		t.Errorf("dns = %v", result.dns)
+	}
+
+	routes.socksOut = "socks-out"
+	result = routes.build()
+	if len(result.rules) != 3 || result.rules[2]["outbound"] != "socks-out" {
+		t.Errorf("rules with socks = %v", result.rules)
+	}
+}
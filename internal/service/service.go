@@ -7,31 +7,39 @@ import (
 )
 
 type Services struct {
-	User         *UserService
-	Server       *ServerService
-	Plan         *PlanService
-	Order        *OrderService
-	Auth         *AuthService
-	Setting      *SettingService
-	Ticket       *TicketService
-	Mail         *MailService
-	Telegram     *TelegramService
-	NodeSync     *NodeSyncService
-	Payment      *PaymentService
-	Coupon       *CouponService
-	Invite       *InviteService
-	Notice       *NoticeService
-	Knowledge    *KnowledgeService
-	Stats        *StatsService
-	Scheduler    *SchedulerService
-	Host         *HostService
-	ServerGroup  *ServerGroupService
-	UserGroup    *UserGroupService
-	Traffic      *TrafficService
-	AgentVersion *AgentVersionService
-	Security     *SecurityService
-	Resilience   *ResilienceService
-	Validation   *ValidationService
+	User              *UserService
+	Server            *ServerService
+	Plan              *PlanService
+	Order             *OrderService
+	Refund            *RefundService
+	Auth              *AuthService
+	Setting           *SettingService
+	SubscribeTemplate *SubscribeTemplateService
+	Ticket            *TicketService
+	Mail              *MailService
+	Telegram          *TelegramService
+	NodeSync          *NodeSyncService
+	Payment           *PaymentService
+	Coupon            *CouponService
+	TrafficPack       *TrafficPackService
+	Waitlist          *WaitlistService
+	Redeem            *RedeemService
+	Invite            *InviteService
+	Withdraw          *WithdrawService
+	Notice            *NoticeService
+	Knowledge         *KnowledgeService
+	Stats             *StatsService
+	Scheduler         *SchedulerService
+	Host              *HostService
+	WireGuard         *WireGuardService
+	ServerGroup       *ServerGroupService
+	ServerRoute       *ServerRouteService
+	UserGroup         *UserGroupService
+	Traffic           *TrafficService
+	AgentVersion      *AgentVersionService
+	Security          *SecurityService
+	Resilience        *ResilienceService
+	Validation        *ValidationService
 }
 
 func NewServices(repos *repository.Repositories, cache *cache.Client, cfg *config.Config) *Services {
@@ -40,40 +48,98 @@ func NewServices(repos *repository.Repositories, cache *cache.Client, cfg *confi
 	telegramService := NewTelegramService(cfg.Telegram)
 	telegramService.SetRepositories(repos.User, repos.Setting)
 	serverService := NewServerService(repos.Server, repos.User, cache, cfg)
-	orderService := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon)
+	orderService := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+	trafficPackService := NewTrafficPackService(repos.TrafficPack, repos.UserTrafficPack, repos.User)
+	trafficService := NewTrafficService(repos.User, mailService)
+	paymentService := NewPaymentService(repos.Payment, repos.Order, orderService, repos.PaymentCallback)
 	userGroupService := NewUserGroupService(repos.UserGroup, repos.Server, repos.Plan, repos.User)
 	securityService := NewSecurityService(repos.DB, mailService, telegramService)
 	resilienceService := NewResilienceService(repos.DB)
 	validationService := NewValidationService(securityService)
+	wireGuardService := NewWireGuardService(repos.WireGuardPeer, settingService)
+	schedulerService := NewSchedulerService(repos.User, repos.Order, repos.Stat, mailService, telegramService)
+	hostService := NewHostService(repos.Host, repos.ServerNode, repos.User, repos.Server, repos.ServerRoute, cache)
 
 	// 设置 UserGroupService 告ServerService 依赖
 	userGroupService.SetServerService(serverService)
 
+	// 设置 ServerService 告SettingService 依赖（时段倍率时区）
+	serverService.SetSettingService(settingService)
+
+	// 设置 WireGuard 依赖
+	serverService.SetWireGuardService(wireGuardService)
+	hostService.SetWireGuardService(wireGuardService)
+
+	// 设置注册试用依赖
+	userService := NewUserService(repos.User, cache)
+	userService.SetTrialServices(repos.Plan, settingService)
+
+	// 设置 OrderService 的 SettingService 依赖（基础币种与汇率）
+	orderService.SetSettingService(settingService)
+
+	// 设置自动续费依赖
+	schedulerService.SetRenewalServices(repos.RenewalAttempt, orderService, paymentService, settingService)
+
+	// 设置套餐候补依赖（限量套餐名额释放与保留）
+	planService := NewPlanService(repos.Plan, repos.User)
+	waitlistService := NewWaitlistService(repos.PlanWaitlist, repos.Plan, repos.User, mailService, telegramService)
+	waitlistService.SetSettingService(settingService)
+	planService.SetWaitlistService(waitlistService)
+	orderService.SetWaitlistService(waitlistService)
+	schedulerService.SetWaitlistService(waitlistService)
+	redeemService := NewRedeemService(repos.RedeemCode, repos.RedeemLog, repos.User, repos.Plan, repos.UserTrafficPack)
+	redeemService.SetWaitlistService(waitlistService)
+	userService.SetWaitlistService(waitlistService)
+	redeemService.SetPlanService(planService)
+	orderService.SetPlanService(planService)
+
+	// 设置邀请返佣依赖（订单完成时记录多级佣金，持有期满后由定时任务发放）
+	inviteService := NewInviteService(repos.InviteCode, repos.User, repos.CommissionLog, repos.Order)
+	inviteService.SetSettingService(settingService)
+	orderService.SetInviteService(inviteService)
+	schedulerService.SetInviteService(inviteService)
+
+	// 设置佣金提现依赖（提现方式、最低金额与手续费）
+	withdrawService := NewWithdrawService(repos.Withdraw, repos.User, mailService, telegramService)
+	withdrawService.SetSettingService(settingService)
+
+	// 设置流量包依赖（清零流量前结算流量包）
+	schedulerService.SetTrafficPackService(trafficPackService)
+	trafficService.SetTrafficPackService(trafficPackService)
+
 	return &Services{
-		User:         NewUserService(repos.User, cache),
-		Server:       serverService,
-		Plan:         NewPlanService(repos.Plan, repos.User),
-		Order:        orderService,
-		Auth:         NewAuthService(repos.User, cfg.JWT),
-		Setting:      settingService,
-		Ticket:       NewTicketService(repos.Ticket, repos.TicketMessage, repos.User, mailService, telegramService),
-		Mail:         mailService,
-		Telegram:     telegramService,
-		NodeSync:     NewNodeSyncService(repos.Server, repos.User, repos.Stat, cfg),
-		Payment:      NewPaymentService(repos.Payment, repos.Order, orderService),
-		Coupon:       NewCouponService(repos.Coupon, repos.Order),
-		Invite:       NewInviteService(repos.InviteCode, repos.User, repos.CommissionLog),
-		Notice:       NewNoticeService(repos.Notice),
-		Knowledge:    NewKnowledgeService(repos.Knowledge),
-		Stats:        NewStatsService(repos.User, repos.Order, repos.Server, repos.Stat, repos.Ticket),
-		Scheduler:    NewSchedulerService(repos.User, repos.Order, repos.Stat, mailService, telegramService),
-		Host:         NewHostService(repos.Host, repos.ServerNode, repos.User, repos.Server, cache),
-		ServerGroup:  NewServerGroupService(repos.ServerGroup),
-		UserGroup:    userGroupService,
-		Traffic:      NewTrafficService(repos.User, mailService),
-		AgentVersion: NewAgentVersionService(repos.DB),
-		Security:     securityService,
-		Resilience:   resilienceService,
-		Validation:   validationService,
+		User:              userService,
+		Server:            serverService,
+		Plan:              planService,
+		Order:             orderService,
+		Auth:              NewAuthService(repos.User, cfg.JWT),
+		Setting:           settingService,
+		SubscribeTemplate: NewSubscribeTemplateService(repos.SubscribeTemplate, cache),
+		Ticket:            NewTicketService(repos.Ticket, repos.TicketMessage, repos.User, mailService, telegramService),
+		Mail:              mailService,
+		Telegram:          telegramService,
+		NodeSync:          NewNodeSyncService(repos.Server, repos.User, repos.Stat, cfg),
+		Refund:            NewRefundService(repos.Order, repos.OrderRefund, repos.User, repos.Plan, repos.CommissionLog, repos.UserTrafficPack, paymentService),
+		Payment:           paymentService,
+		Coupon:            NewCouponService(repos.Coupon, repos.Order),
+		Redeem:            redeemService,
+		TrafficPack:       trafficPackService,
+		Waitlist:          waitlistService,
+		Invite:            inviteService,
+		Withdraw:          withdrawService,
+		Notice:            NewNoticeService(repos.Notice),
+		Knowledge:         NewKnowledgeService(repos.Knowledge),
+		Stats:             NewStatsService(repos.User, repos.Order, repos.Server, repos.Stat, repos.Ticket),
+		Scheduler:         schedulerService,
+		Host:              hostService,
+		WireGuard:         wireGuardService,
+		ServerGroup:       NewServerGroupService(repos.ServerGroup),
+		ServerRoute:       NewServerRouteService(repos.ServerRoute),
+		UserGroup:         userGroupService,
+		Traffic:           trafficService,
+		AgentVersion:      NewAgentVersionService(repos.DB),
+		Security:          securityService,
+		Resilience:        resilienceService,
+		Validation:        validationService,
 	}
 }
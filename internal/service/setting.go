@@ -2,7 +2,9 @@ package service
 
 import (
 	"encoding/json"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"dashgo/internal/repository"
@@ -23,6 +25,11 @@ func NewSettingService(settingRepo *repository.SettingRepository, cache *cache.C
 
 // Get 获取设置
 func (s *SettingService) Get(key string) (string, error) {
+	// 未配置缓存时直接读取数据库
+	if s.cache == nil {
+		return s.settingRepo.Get(key)
+	}
+
 	// 先从缓存获取
 	cacheKey := "setting:" + key
 	if val, err := s.cache.Get(cacheKey); err == nil {
@@ -45,6 +52,9 @@ func (s *SettingService) Set(key, value string) error {
 	if err := s.settingRepo.Set(key, value); err != nil {
 		return err
 	}
+	if s.cache == nil {
+		return nil
+	}
 
 	// 更新缓存
 	cacheKey := "setting:" + key
@@ -105,6 +115,10 @@ const (
 	SettingRegisterTrialDays    = "register_trial_days"
 	SettingRegisterTrialTraffic = "register_trial_traffic"
 	SettingRegisterIPLimit      = "register_ip_limit"
+	// 注册试用：套餐 ID、仅邮箱验证后发放、每个邮箱域名每天最多发放数量（0 不限）
+	SettingRegisterTrialPlanID      = "register_trial_plan_id"
+	SettingRegisterTrialVerify      = "register_trial_verify"
+	SettingRegisterTrialDomainLimit = "register_trial_domain_limit"
 
 	// 邮件设置
 	SettingMailEnable = "mail_enable"
@@ -118,6 +132,32 @@ const (
 	// 支付设置
 	SettingPaymentCurrency = "payment_currency"
 	SettingPaymentSymbol   = "payment_symbol"
+	// 外币汇率，JSON 对象：1 基础币种可兑换的外币金额，例如 {"USD": 0.14}
+	SettingCurrencyRates = "currency_rates"
+
+	// 邀请返佣：各层级返佣比例（%），未单独设置返佣类型的邀请人是否仅首单返佣
+	SettingCommissionRate           = "commission_rate"
+	SettingCommissionRateTier2      = "commission_rate_tier2"
+	SettingCommissionRateTier3      = "commission_rate_tier3"
+	SettingCommissionFirstOrderOnly = "commission_first_order_only"
+	// 佣金持有天数：订单完成后经过该天数才发放到佣金余额
+	SettingCommissionHoldDays = "commission_hold_days"
+	// 佣金提现：可用提现方式（逗号分隔，usdt/alipay/bank）、最低提现金额（分）、手续费比例（%）
+	SettingCommissionWithdrawMethods = "commission_withdraw_methods"
+	SettingCommissionWithdrawMin     = "commission_withdraw_min"
+	SettingCommissionWithdrawFee     = "commission_withdraw_fee"
+
+	// 自动续费：到期前多少天发起续费
+	SettingAutoRenewDays = "auto_renew_days"
+
+	// 套餐候补：释放名额后为候补用户保留的小时数
+	SettingWaitlistReserveHours = "waitlist_reserve_hours"
+
+	// WireGuard 设置
+	SettingWireGuardCIDR = "wireguard_cidr"
+
+	// 节点时段倍率时区，例如 Asia/Shanghai，为空使用服务器本地时区
+	SettingServerRateTimezone = "server_rate_timezone"
 )
 
 // SiteSettings 站点设置结构
@@ -207,6 +247,55 @@ func (s *SettingService) GetString(key, defaultVal string) string {
 	return val
 }
 
+// RateTime 获取时段倍率使用的当前时间（按配置时区）
+func (s *SettingService) RateTime() time.Time {
+	now := time.Now()
+	tz := s.GetString(SettingServerRateTimezone, "")
+	if tz == "" {
+		return now
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return now
+	}
+	return now.In(loc)
+}
+
+// BaseCurrency 基础币种，余额、佣金与收入统计均以基础币种计
+func (s *SettingService) BaseCurrency() string {
+	return strings.ToUpper(s.GetString(SettingPaymentCurrency, "CNY"))
+}
+
+// CurrencyRates 获取外币汇率，忽略无效的配置项
+func (s *SettingService) CurrencyRates() map[string]float64 {
+	rates := make(map[string]float64)
+	var raw map[string]float64
+	if err := json.Unmarshal([]byte(s.GetString(SettingCurrencyRates, "{}")), &raw); err != nil {
+		return rates
+	}
+	for code, rate := range raw {
+		if rate > 0 {
+			rates[strings.ToUpper(code)] = rate
+		}
+	}
+	return rates
+}
+
+// Currencies 可选的下单币种，基础币种在前
+func (s *SettingService) Currencies() []string {
+	base := s.BaseCurrency()
+	currencies := []string{base}
+	rates := s.CurrencyRates()
+	codes := make([]string, 0, len(rates))
+	for code := range rates {
+		if code != base {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return append(currencies, codes...)
+}
+
 // SetMultiple 批量设置
 func (s *SettingService) SetMultiple(settings map[string]string) error {
 	for key, value := range settings {
@@ -230,8 +319,12 @@ func (s *SettingService) GetPublicSettings() map[string]interface{} {
 		"footer":           site.Footer,
 		"currency":         site.Currency,
 		"currency_symbol":  site.CurrencySymbol,
+		"currencies":       s.Currencies(),
+		"currency_rates":   s.CurrencyRates(),
 		"register_enable":  s.GetBool(SettingRegisterEnable, true),
 		"invite_only":      s.GetBool(SettingRegisterInviteOnly, false),
+		"register_trial":   s.GetBool(SettingRegisterTrial, false),
+		"trial_verify":     s.GetBool(SettingRegisterTrialVerify, false),
 		"telegram_enable":  s.GetBool(SettingTelegramEnable, false),
 		"mail_verify":      s.GetBool(SettingMailVerify, false),
 	}
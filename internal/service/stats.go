@@ -109,6 +109,24 @@ func (s *StatsService) GetUserStats(startAt, endAt int64) ([]map[string]interfac
 	return result, nil
 }
 
+// GetTrialConversion 获取注册试用转化统计（时间段内领取试用的用户中有付费订单的比例）
+func (s *StatsService) GetTrialConversion(startAt, endAt int64) (map[string]interface{}, error) {
+	trial, converted, err := s.userRepo.CountTrialConversion(startAt, endAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := 0.0
+	if trial > 0 {
+		rate = float64(converted) / float64(trial)
+	}
+	return map[string]interface{}{
+		"trial_users":     trial,
+		"converted_users": converted,
+		"conversion_rate": rate,
+	}, nil
+}
+
 // GetTrafficStats 获取流量统计
 func (s *StatsService) GetTrafficStats(startAt, endAt int64) ([]map[string]interface{}, error) {
 	stats, err := s.statRepo.GetServerTrafficStats(startAt, endAt)
@@ -297,16 +315,24 @@ func (s *StatsService) GetOrderList(status *int, page, pageSize int) ([]map[stri
 		}
 
 		result = append(result, map[string]interface{}{
-			"id":           order.ID,
-			"user_id":      order.UserID,
-			"user_email":   userEmail,
-			"trade_no":     order.TradeNo,
-			"plan_id":      order.PlanID,
-			"period":       order.Period,
-			"total_amount": order.TotalAmount,
-			"status":       order.Status,
-			"type":         order.Type,
-			"created_at":   order.CreatedAt,
+			"id":                    order.ID,
+			"user_id":               order.UserID,
+			"user_email":            userEmail,
+			"trade_no":              order.TradeNo,
+			"plan_id":               order.PlanID,
+			"period":                order.Period,
+			"currency":              order.Currency,
+			"plan_amount":           order.PlanAmount,
+			"group_discount_amount": order.GroupDiscountAmount,
+			"user_discount_amount":  order.UserDiscountAmount,
+			"discount_amount":       order.DiscountAmount,
+			"surplus_amount":        order.SurplusAmount,
+			"total_amount":          order.TotalAmount,
+			"balance_amount":        order.BalanceAmount,
+			"base_amount":           order.ToBase(order.TotalAmount),
+			"status":                order.Status,
+			"type":                  order.Type,
+			"created_at":            order.CreatedAt,
 		})
 	}
 
@@ -422,14 +448,11 @@ func (s *StatsService) GetUserTrafficDetail(userID int64) (map[string]interface{
 	}
 
 	used := user.U + user.D
-	remaining := user.TransferEnable - used
-	if remaining < 0 {
-		remaining = 0
-	}
+	remaining := user.GetRemainingTraffic()
 
 	usedPercent := float64(0)
-	if user.TransferEnable > 0 {
-		usedPercent = float64(used) / float64(user.TransferEnable) * 100
+	if total := user.TotalTraffic(); total > 0 {
+		usedPercent = float64(used) / float64(total) * 100
 	}
 
 	return map[string]interface{}{
@@ -439,6 +462,7 @@ func (s *StatsService) GetUserTrafficDetail(userID int64) (map[string]interface{
 		"download":        user.D,
 		"total_used":      used,
 		"transfer_enable": user.TransferEnable,
+		"pack_traffic":    user.PackTraffic,
 		"remaining":       remaining,
 		"used_percent":    usedPercent,
 	}, nil
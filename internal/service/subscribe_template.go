@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/protocol"
+	"dashgo/internal/repository"
+	"dashgo/pkg/cache"
+)
+
+type SubscribeTemplateService struct {
+	templateRepo *repository.SubscribeTemplateRepository
+	cache        *cache.Client
+}
+
+func NewSubscribeTemplateService(templateRepo *repository.SubscribeTemplateRepository, cache *cache.Client) *SubscribeTemplateService {
+	return &SubscribeTemplateService{
+		templateRepo: templateRepo,
+		cache:        cache,
+	}
+}
+
+// SubscribeTemplateInfo 订阅模板信息
+type SubscribeTemplateInfo struct {
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	IsDefault bool   `json:"is_default"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func isTemplateName(name string) bool {
+	for _, n := range protocol.TemplateNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// List 获取所有模板，未自定义的返回内置模板
+func (s *SubscribeTemplateService) List() ([]SubscribeTemplateInfo, error) {
+	templates, err := s.templateRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	custom := make(map[string]model.SubscribeTemplate)
+	for _, t := range templates {
+		custom[t.Name] = t
+	}
+
+	result := make([]SubscribeTemplateInfo, 0, len(protocol.TemplateNames()))
+	for _, name := range protocol.TemplateNames() {
+		if t, ok := custom[name]; ok {
+			result = append(result, SubscribeTemplateInfo{Name: name, Content: t.Content, UpdatedAt: t.UpdatedAt})
+		} else {
+			result = append(result, SubscribeTemplateInfo{Name: name, Content: protocol.DefaultTemplate(name), IsDefault: true})
+		}
+	}
+	return result, nil
+}
+
+// Get 获取单个模板
+func (s *SubscribeTemplateService) Get(name string) (*SubscribeTemplateInfo, error) {
+	if !isTemplateName(name) {
+		return nil, errors.New("unknown template")
+	}
+	tpl, err := s.templateRepo.FindByName(name)
+	if err != nil {
+		return &SubscribeTemplateInfo{Name: name, Content: protocol.DefaultTemplate(name), IsDefault: true}, nil
+	}
+	return &SubscribeTemplateInfo{Name: name, Content: tpl.Content, UpdatedAt: tpl.UpdatedAt}, nil
+}
+
+// GetContent 获取订阅使用的模板内容，未自定义时返回空字符串（使用内置模板）
+func (s *SubscribeTemplateService) GetContent(name string) string {
+	if name == "" {
+		return ""
+	}
+	cacheKey := "subscribe_template:" + name
+	if val, err := s.cache.Get(cacheKey); err == nil {
+		return val
+	}
+
+	content := ""
+	if tpl, err := s.templateRepo.FindByName(name); err == nil {
+		content = tpl.Content
+	}
+	s.cache.Set(cacheKey, content, time.Hour)
+	return content
+}
+
+// Save 保存模板，保存前使用示例数据校验
+func (s *SubscribeTemplateService) Save(name, content string) error {
+	if !isTemplateName(name) {
+		return errors.New("unknown template")
+	}
+	if content == "" {
+		return errors.New("template content is empty")
+	}
+	if err := s.Validate(name, content); err != nil {
+		return err
+	}
+	if err := s.templateRepo.Save(name, content); err != nil {
+		return err
+	}
+	return s.cache.Del("subscribe_template:" + name)
+}
+
+// Reset 删除自定义模板，恢复内置模板
+func (s *SubscribeTemplateService) Reset(name string) error {
+	if !isTemplateName(name) {
+		return errors.New("unknown template")
+	}
+	if err := s.templateRepo.Delete(name); err != nil {
+		return err
+	}
+	return s.cache.Del("subscribe_template:" + name)
+}
+
+// Validate 使用示例节点渲染模板，检查语法与输出格式
+func (s *SubscribeTemplateService) Validate(name, content string) error {
+	_, err := s.Preview(name, content)
+	return err
+}
+
+// Preview 使用示例节点与示例用户渲染模板
+func (s *SubscribeTemplateService) Preview(name, content string) (string, error) {
+	return s.Render(name, content, sampleTemplateServers(), sampleTemplateUser())
+}
+
+// Render 按模板名称渲染订阅内容
+func (s *SubscribeTemplateService) Render(name, content string, servers []model.ServerInfo, user *model.User) (string, error) {
+	format := protocol.GetSubscribeFormat(name)
+	if format == nil || format.Render == nil {
+		return "", errors.New("unknown template")
+	}
+	return format.Render(content, servers, user)
+}
+
+func sampleTemplateUser() *model.User {
+	return &model.User{ID: 1, Email: "preview@example.com", UUID: "00000000-0000-0000-0000-000000000000", Token: "preview"}
+}
+
+func sampleTemplateServers() []model.ServerInfo {
+	return []model.ServerInfo{
+		{Server: model.Server{ID: 1, Name: "Sample Trojan", Type: model.ServerTypeTrojan, Host: "example.com", Port: "443", Tags: model.JSONArray{"sample"}}},
+		{Server: model.Server{ID: 2, Name: "Sample VMess", Type: model.ServerTypeVmess, Host: "example.com", Port: "8443"}},
+	}
+}
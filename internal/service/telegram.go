@@ -318,7 +318,7 @@ func (s *TelegramService) cmdTraffic(msg *TelegramMessage) error {
 		return s.SendMarkdown(msg.Chat.ID, "和请先 /bind <邮箱> 绑定")
 	}
 	used := user.U + user.D
-	total := user.TransferEnable
+	total := user.TotalTraffic()
 	percent := float64(0)
 	if total > 0 {
 		percent = float64(used) / float64(total) * 100
@@ -419,6 +419,16 @@ func (s *TelegramService) NotifyExpire(user *model.User, daysLeft int) error {
 	return s.SendMarkdown(*user.TelegramID, text)
 }
 
+// NotifyRenewalFailed 通知自动续费失败（余额不足）
+func (s *TelegramService) NotifyRenewalFailed(user *model.User, order *model.Order, daysLeft int) error {
+	if user.TelegramID == nil || *user.TelegramID == 0 {
+		return nil
+	}
+	text := fmt.Sprintf("⚠️ *自动续费失败*\n\n余额不足，续费需要 ¥%.2f，当前余额 ¥%.2f。\n订阅将在 *%d 天*后到期，请及时充值！",
+		float64(order.TotalAmount)/100, float64(user.Balance)/100, daysLeft)
+	return s.SendMarkdown(*user.TelegramID, text)
+}
+
 // NotifyTrafficWarning 通知流量预警
 func (s *TelegramService) NotifyTrafficWarning(user *model.User, usedPercent int) error {
 	if user.TelegramID == nil || *user.TelegramID == 0 {
@@ -428,6 +438,29 @@ func (s *TelegramService) NotifyTrafficWarning(user *model.User, usedPercent int
 	return s.SendMarkdown(*user.TelegramID, text)
 }
 
+// NotifyWaitlistAvailable 通知候补套餐名额释放
+func (s *TelegramService) NotifyWaitlistAvailable(user *model.User, plan *model.Plan, reservedUntil int64) error {
+	if user.TelegramID == nil || *user.TelegramID == 0 {
+		return nil
+	}
+	text := fmt.Sprintf("🎉 *候补套餐已有名额*\n\n套餐 *%s* 已为您保留至 %s，请尽快购买！",
+		plan.Name, time.Unix(reservedUntil, 0).Format("2006-01-02 15:04"))
+	return s.SendMarkdown(*user.TelegramID, text)
+}
+
+// NotifyWithdrawStatus 通知用户佣金提现状态变更
+func (s *TelegramService) NotifyWithdrawStatus(user *model.User, withdraw *model.CommissionWithdraw) error {
+	if user.TelegramID == nil || *user.TelegramID == 0 {
+		return nil
+	}
+	text := fmt.Sprintf("💸 *佣金提现%s*\n\n申请编号：%d\n提现金额：¥%.2f\n实际到账：¥%.2f",
+		withdrawStatusText(withdraw.Status), withdraw.ID, float64(withdraw.Amount)/100, float64(withdraw.ActualAmount)/100)
+	if withdraw.AdminNote != nil && *withdraw.AdminNote != "" {
+		text += "\n备注：" + *withdraw.AdminNote
+	}
+	return s.SendMarkdown(*user.TelegramID, text)
+}
+
 // NotifyNewTicket 通知管理员新工单
 func (s *TelegramService) NotifyNewTicket(subject, userEmail string) error {
 	if s.chatID == "" {
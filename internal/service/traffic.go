@@ -12,6 +12,7 @@ import (
 type TrafficService struct {
 	userRepo *repository.UserRepository
 	mailSvc  *MailService
+	packSvc  *TrafficPackService
 }
 
 func NewTrafficService(userRepo *repository.UserRepository, mailSvc *MailService) *TrafficService {
@@ -21,6 +22,11 @@ func NewTrafficService(userRepo *repository.UserRepository, mailSvc *MailService
 	}
 }
 
+// SetTrafficPackService 设置流量包服务
+func (s *TrafficService) SetTrafficPackService(packSvc *TrafficPackService) {
+	s.packSvc = packSvc
+}
+
 // CheckUserTrafficLimit 检查用户流量限告
 // 返回：是否超限，使用百分告
 func (s *TrafficService) CheckUserTrafficLimit(user *model.User) (bool, float64) {
@@ -28,10 +34,12 @@ func (s *TrafficService) CheckUserTrafficLimit(user *model.User) (bool, float64)
 		return false, 0 // 无限流量
 	}
 
+	// 总流量包含有效流量包
+	total := user.TotalTraffic()
 	used := user.U + user.D
-	percentage := float64(used) / float64(user.TransferEnable) * 100
+	percentage := float64(used) / float64(total) * 100
 
-	return used >= user.TransferEnable, percentage
+	return used >= total, percentage
 }
 
 // GetTrafficWarningUsers 获取流量预警用户告0%告0%告
@@ -60,14 +68,21 @@ func (s *TrafficService) SendTrafficWarning(user *model.User, percentage float64
 此邮件为系统自动发送，请勿回复。
 `, user.Email, percentage,
 		float64(user.U+user.D)/1024/1024/1024,
-		float64(user.TransferEnable)/1024/1024/1024,
-		float64(user.TransferEnable-user.U-user.D)/1024/1024/1024)
+		float64(user.TotalTraffic())/1024/1024/1024,
+		float64(user.GetRemainingTraffic())/1024/1024/1024)
 
 	return s.mailSvc.SendMail(user.Email, subject, body)
 }
 
 // AutoBanOverTrafficUsers 自动封禁超流量用告
 func (s *TrafficService) AutoBanOverTrafficUsers() (int, error) {
+	// 先结算已到期的流量包，避免过期流量包仍计入总流量
+	if s.packSvc != nil {
+		if _, err := s.packSvc.ExpirePacks(); err != nil {
+			return 0, err
+		}
+	}
+
 	// 获取所有用告
 	users, _, err := s.userRepo.List(1, 10000) // 简化处理，实际应该分页
 	if err != nil {
@@ -136,10 +151,17 @@ func (s *TrafficService) ResetUserTraffic(userID int64) error {
 		return err
 	}
 
-	user.U = 0
-	user.D = 0
 	user.T = time.Now().Unix()
+	return s.resetUsage(user)
+}
 
+// resetUsage 清零用户已用流量，未设置流量包服务时直接清零
+func (s *TrafficService) resetUsage(user *model.User) error {
+	if s.packSvc != nil {
+		return s.packSvc.ResetUsage(user)
+	}
+	user.U = 0
+	user.D = 0
 	return s.userRepo.Update(user)
 }
 
@@ -152,10 +174,8 @@ func (s *TrafficService) ResetAllUsersTraffic() (int, error) {
 
 	resetCount := 0
 	for _, user := range users {
-		user.U = 0
-		user.D = 0
 		user.T = time.Now().Unix()
-		if err := s.userRepo.Update(&user); err == nil {
+		if err := s.resetUsage(&user); err == nil {
 			resetCount++
 		}
 	}
@@ -179,6 +199,7 @@ func (s *TrafficService) GetUserTrafficDetail(userID int64) (map[string]interfac
 		"download":        user.D,
 		"total_used":      user.U + user.D,
 		"transfer_enable": user.TransferEnable,
+		"pack_traffic":    user.PackTraffic,
 		"remaining":       user.GetRemainingTraffic(),
 		"usage_percent":   percentage,
 		"is_over_limit":   isOver,
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// TrafficPackService 流量包服务
+type TrafficPackService struct {
+	packRepo     *repository.TrafficPackRepository
+	userPackRepo *repository.UserTrafficPackRepository
+	userRepo     *repository.UserRepository
+}
+
+func NewTrafficPackService(packRepo *repository.TrafficPackRepository, userPackRepo *repository.UserTrafficPackRepository, userRepo *repository.UserRepository) *TrafficPackService {
+	return &TrafficPackService{
+		packRepo:     packRepo,
+		userPackRepo: userPackRepo,
+		userRepo:     userRepo,
+	}
+}
+
+// GetAll 获取所有流量包商品
+func (s *TrafficPackService) GetAll() ([]model.TrafficPack, error) {
+	return s.packRepo.GetAll()
+}
+
+// GetAvailable 获取可购买的流量包商品
+func (s *TrafficPackService) GetAvailable() ([]model.TrafficPack, error) {
+	return s.packRepo.GetAvailable()
+}
+
+// GetByID 根据 ID 获取流量包商品
+func (s *TrafficPackService) GetByID(id int64) (*model.TrafficPack, error) {
+	return s.packRepo.FindByID(id)
+}
+
+// Create 创建流量包商品
+func (s *TrafficPackService) Create(pack *model.TrafficPack) error {
+	if err := validateTrafficPack(pack); err != nil {
+		return err
+	}
+	return s.packRepo.Create(pack)
+}
+
+// Update 更新流量包商品
+func (s *TrafficPackService) Update(pack *model.TrafficPack) error {
+	if err := validateTrafficPack(pack); err != nil {
+		return err
+	}
+	return s.packRepo.Update(pack)
+}
+
+// Delete 删除流量包商品，已购流量包不受影响
+func (s *TrafficPackService) Delete(id int64) error {
+	return s.packRepo.Delete(id)
+}
+
+// GetUserPacks 获取用户已购流量包
+func (s *TrafficPackService) GetUserPacks(userID int64) ([]model.UserTrafficPack, error) {
+	return s.userPackRepo.FindByUserID(userID)
+}
+
+func validateTrafficPack(pack *model.TrafficPack) error {
+	if pack.Traffic <= 0 {
+		return errors.New("traffic must be positive")
+	}
+	if pack.Days <= 0 {
+		return errors.New("days must be positive")
+	}
+	if pack.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	return nil
+}
+
+// ResetUsage 清零用户已用流量，清零前先将超出套餐的用量结算到流量包
+func (s *TrafficPackService) ResetUsage(user *model.User) error {
+	if err := settleTrafficPacks(s.userPackRepo, user, true); err != nil {
+		return err
+	}
+	user.U = 0
+	user.D = 0
+	return s.userRepo.Update(user)
+}
+
+// ExpirePacks 结算已到期的流量包，返回处理的用户数
+func (s *TrafficPackService) ExpirePacks() (int, error) {
+	userIDs, err := s.userPackRepo.GetExpiredUserIDs(time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, userID := range userIDs {
+		err := s.userRepo.Transaction(func(tx *gorm.DB) error {
+			userRepo := s.userRepo.WithTx(tx)
+			user, err := userRepo.FindByIDForUpdate(userID)
+			if err != nil || user == nil {
+				return errors.New("user not found")
+			}
+			if err := settleTrafficPacks(s.userPackRepo.WithTx(tx), user, false); err != nil {
+				return err
+			}
+			return userRepo.Update(user)
+		})
+		if err != nil {
+			log.Printf("[TrafficPack] Failed to expire packs for user %d: %v", userID, err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// settleTrafficPacks 结算流量包并重新计算 User.PackTraffic
+//
+// 已用流量超出套餐流量的部分按到期先后由流量包承担。PackTraffic 等于未过期流量包剩余流量，
+// 加上本周期内已由过期流量包承担的用量（这部分仍计在 U/D 中）。
+// 到期的流量包结算后关闭；resetUsage 为 true 时调用方随后会清零 U/D，本周期超出部分全部结算。
+func settleTrafficPacks(packRepo *repository.UserTrafficPackRepository, user *model.User, resetUsage bool) error {
+	packs, err := packRepo.FindActiveByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	var remaining int64
+	for _, p := range packs {
+		remaining += p.Traffic - p.Used
+	}
+	// 本周期已由过期流量包承担的用量
+	settled := user.PackTraffic - remaining
+	if settled < 0 {
+		settled = 0
+	}
+	var overflow int64
+	if user.TransferEnable > 0 && user.U+user.D > user.TransferEnable {
+		overflow = user.U + user.D - user.TransferEnable - settled
+	}
+	if overflow < 0 {
+		overflow = 0
+	}
+
+	now := time.Now().Unix()
+	var active int64
+	for i := range packs {
+		p := &packs[i]
+		expired := p.ExpiredAt <= now
+		if !expired && !resetUsage {
+			active += p.Traffic - p.Used
+			continue
+		}
+
+		use := p.Traffic - p.Used
+		if overflow < use {
+			use = overflow
+		}
+		if use > 0 {
+			p.Used += use
+			overflow -= use
+		}
+		if expired {
+			settled += use
+			p.Status = model.TrafficPackExpired
+		} else {
+			active += p.Traffic - p.Used
+		}
+		if err := packRepo.Update(p); err != nil {
+			return err
+		}
+	}
+
+	if resetUsage {
+		settled = 0
+	}
+	user.PackTraffic = settled + active
+	return nil
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestTrafficPackSettlement(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.UserTrafficPack{})
+
+	const gb = int64(1024 * 1024 * 1024)
+	planID := int64(1)
+	user := &model.User{Email: "user@example.com", UUID: "u1", Token: "t1", PlanID: &planID, TransferEnable: 10 * gb, PackTraffic: 8 * gb}
+	db.Create(user)
+	soon := &model.UserTrafficPack{UserID: user.ID, Traffic: 3 * gb, ExpiredAt: time.Now().Add(time.Hour).Unix()}
+	later := &model.UserTrafficPack{UserID: user.ID, Traffic: 5 * gb, ExpiredAt: time.Now().Add(48 * time.Hour).Unix()}
+	db.Create(soon)
+	db.Create(later)
+
+	repos := repository.NewRepositories(db)
+	packs := NewTrafficPackService(repos.TrafficPack, repos.UserTrafficPack, repos.User)
+
+	// 套餐 10G 已用 12G：超出的 2G 由流量包承担，总流量 18G
+	user.U, user.D = 4*gb, 8*gb
+	if !user.HasTraffic() || user.TotalTraffic() != 18*gb {
+		t.Fatalf("total = %d, has traffic = %v", user.TotalTraffic(), user.HasTraffic())
+	}
+
+	// 月度重置：超出部分计入先到期的流量包，流量包跨周期保留
+	if err := packs.ResetUsage(user); err != nil {
+		t.Fatal(err)
+	}
+	db.First(soon, soon.ID)
+	if soon.Used != 2*gb || user.PackTraffic != 6*gb || user.U+user.D != 0 {
+		t.Fatalf("after reset: soon.used = %d, pack_traffic = %d", soon.Used, user.PackTraffic)
+	}
+
+	// 新周期再超出 3G：先到期的流量包到期时承担 1G，剩余 2G 由后到期的流量包承担
+	db.Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{"u": 13 * gb, "pack_traffic": user.PackTraffic})
+	db.Model(soon).Update("expired_at", time.Now().Add(-time.Minute).Unix())
+	if _, err := packs.ExpirePacks(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := repos.User.FindByID(user.ID)
+	db.First(soon, soon.ID)
+	if soon.Status != model.TrafficPackExpired || soon.Used != 3*gb {
+		t.Errorf("expired pack: status = %d, used = %d", soon.Status, soon.Used)
+	}
+	// 剩余可用 = 后到期流量包 5G + 本周期已由过期流量包承担的 1G
+	if got.PackTraffic != 6*gb || !got.HasTraffic() {
+		t.Errorf("after expiry: pack_traffic = %d", got.PackTraffic)
+	}
+	got.U = 17 * gb
+	if got.HasTraffic() {
+		t.Error("user still has traffic after exhausting plan and packs")
+	}
+}
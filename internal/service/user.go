@@ -2,17 +2,23 @@ package service
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"dashgo/internal/model"
 	"dashgo/internal/repository"
 	"dashgo/pkg/cache"
 	"dashgo/pkg/utils"
+
+	"gorm.io/gorm"
 )
 
 type UserService struct {
-	userRepo *repository.UserRepository
-	cache    *cache.Client
+	userRepo   *repository.UserRepository
+	cache      *cache.Client
+	planRepo   *repository.PlanRepository
+	settingSvc *SettingService
+	waitlist   *WaitlistService
 }
 
 func NewUserService(userRepo *repository.UserRepository, cache *cache.Client) *UserService {
@@ -22,6 +28,17 @@ func NewUserService(userRepo *repository.UserRepository, cache *cache.Client) *U
 	}
 }
 
+// SetTrialServices 设置注册试用依赖
+func (s *UserService) SetTrialServices(planRepo *repository.PlanRepository, settingSvc *SettingService) {
+	s.planRepo = planRepo
+	s.settingSvc = settingSvc
+}
+
+// SetWaitlistService 设置候补服务（试用套餐不占用为候补用户保留的名额）
+func (s *UserService) SetWaitlistService(waitlist *WaitlistService) {
+	s.waitlist = waitlist
+}
+
 // GetUsersCached 获取用户列表（带缓存告
 func (s *UserService) GetUsersCached(page, pageSize int) ([]model.User, int64, error) {
 	cacheKey := cache.UserListPageKey(page, pageSize)
@@ -167,14 +184,12 @@ func (s *UserService) UpdateTraffic(userID int64, u, d int64) error {
 }
 
 // TrafficFetch 批量处理流量上报（带流控检查）
-func (s *UserService) TrafficFetch(server *model.Server, trafficData map[int64][2]int64) error {
-	// 计算倍率
-	rate := server.Rate
-	if rate <= 0 {
-		rate = 1
-	}
+// rate 为节点当前生效倍率（含时段倍率）
+func (s *UserService) TrafficFetch(server *model.Server, rate float64, trafficData map[int64][2]int64) (map[int64][2]int64, error) {
+	rate = model.NormalizeRate(rate)
 
-	// 应用倍率并检查流量限告
+	// 应用倍率并检查流量限告，返回成功计费的用户流量（已乘倍率）
+	charged := make(map[int64][2]int64, len(trafficData))
 	for userID, traffic := range trafficData {
 		u := int64(float64(traffic[0]) * rate)
 		d := int64(float64(traffic[1]) * rate)
@@ -183,6 +198,7 @@ func (s *UserService) TrafficFetch(server *model.Server, trafficData map[int64][
 		if err := s.userRepo.UpdateTraffic(userID, u, d); err != nil {
 			continue
 		}
+		charged[userID] = [2]int64{u, d}
 
 		// 检查用户是否超流量
 		user, err := s.userRepo.FindByID(userID)
@@ -191,7 +207,7 @@ func (s *UserService) TrafficFetch(server *model.Server, trafficData map[int64][
 		}
 
 		// 流控检查：如果超流量，标记用户（可选：自动封禁或只是记录）
-		if user.TransferEnable > 0 && (user.U+user.D) >= user.TransferEnable {
+		if user.TransferEnable > 0 && (user.U+user.D) >= user.TotalTraffic() {
 			// 超流量处理：这里可以选择自动封禁或发送通知
 			// 方案1：自动封禁（激进）
 			// user.Banned = true
@@ -205,7 +221,7 @@ func (s *UserService) TrafficFetch(server *model.Server, trafficData map[int64][
 		}
 	}
 
-	return nil
+	return charged, nil
 }
 
 // ResetToken 重置用户 Token
@@ -238,6 +254,17 @@ func (s *UserService) ResetUUID(userID int64) (string, error) {
 	return user.UUID, nil
 }
 
+// SetAutoRenew 开启或关闭自动续费
+func (s *UserService) SetAutoRenew(userID int64, enabled bool) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return errors.New("user not found")
+	}
+
+	user.AutoRenew = enabled
+	return s.userRepo.Update(user)
+}
+
 // ChangePassword 修改密码
 func (s *UserService) ChangePassword(userID int64, oldPassword, newPassword string) error {
 	user, err := s.userRepo.FindByID(userID)
@@ -269,9 +296,11 @@ func (s *UserService) GetUserInfo(user *model.User) map[string]interface{} {
 		"plan_id":         user.PlanID,
 		"group_id":        user.GroupID,
 		"transfer_enable": user.TransferEnable,
+		"pack_traffic":    user.PackTraffic,
 		"u":               user.U,
 		"d":               user.D,
 		"expired_at":      user.ExpiredAt,
+		"auto_renew":      user.AutoRenew,
 		"is_admin":        user.IsAdmin,
 		"is_staff":        user.IsStaff,
 		"created_at":      user.CreatedAt,
@@ -407,7 +436,8 @@ func (s *UserService) GetByEmail(email string) (*model.User, error) {
 }
 
 // RegisterWithIP 告IP 记录的用户注告
-func (s *UserService) RegisterWithIP(email, password string, inviteUserID *int64, ip string) (*model.User, error) {
+// emailVerified 表示注册时已通过邮箱验证码校验，用于判断是否发放试用
+func (s *UserService) RegisterWithIP(email, password string, inviteUserID *int64, ip string, emailVerified bool) (*model.User, error) {
 	// 检查邮箱是否已存在
 	existing, _ := s.userRepo.FindByEmail(email)
 	if existing != nil {
@@ -430,14 +460,109 @@ func (s *UserService) RegisterWithIP(email, password string, inviteUserID *int64
 		CreatedAt:    time.Now().Unix(),
 		UpdatedAt:    time.Now().Unix(),
 	}
+	s.applyTrial(user, s.trialConfig(), ip, emailVerified)
 
-	if err := s.userRepo.Create(user); err != nil {
+	if err := s.createUser(user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
+// createUser 创建用户，领取试用套餐时在同一事务中占用套餐名额
+func (s *UserService) createUser(user *model.User) error {
+	return s.userRepo.Transaction(func(tx *gorm.DB) error {
+		if err := s.userRepo.WithTx(tx).Create(user); err != nil {
+			return err
+		}
+		if user.TrialAt == nil || user.PlanID == nil {
+			return nil
+		}
+		return s.planRepo.WithTx(tx).IncrementSoldCount(*user.PlanID)
+	})
+}
+
+// TrialConfig 注册试用配置
+type TrialConfig struct {
+	PlanID        int64
+	Days          int
+	Traffic       int64 // GB，0 表示使用套餐流量
+	RequireVerify bool
+	DomainLimit   int // 每个邮箱域名每天最多发放数量，0 不限
+}
+
+// trialConfig 读取注册试用配置，未开启时返回 nil
+func (s *UserService) trialConfig() *TrialConfig {
+	if s.settingSvc == nil || !s.settingSvc.GetBool(SettingRegisterTrial, false) {
+		return nil
+	}
+	return &TrialConfig{
+		PlanID:        int64(s.settingSvc.GetInt(SettingRegisterTrialPlanID, 0)),
+		Days:          s.settingSvc.GetInt(SettingRegisterTrialDays, 1),
+		Traffic:       int64(s.settingSvc.GetInt(SettingRegisterTrialTraffic, 0)),
+		RequireVerify: s.settingSvc.GetBool(SettingRegisterTrialVerify, false),
+		DomainLimit:   s.settingSvc.GetInt(SettingRegisterTrialDomainLimit, 0),
+	}
+}
+
+// applyTrial 为新用户发放试用套餐，不满足条件时静默跳过，不影响注册
+// 限制：同一注册 IP 仅首个账号可领取；同一邮箱域名每天发放数量受限
+func (s *UserService) applyTrial(user *model.User, cfg *TrialConfig, ip string, emailVerified bool) bool {
+	if cfg == nil || cfg.PlanID <= 0 || cfg.Days <= 0 || s.planRepo == nil {
+		return false
+	}
+	if cfg.RequireVerify && !emailVerified {
+		return false
+	}
+	if ip != "" {
+		if count, err := s.userRepo.CountByRegisterIP(ip); err != nil || count > 0 {
+			return false
+		}
+	}
+	if cfg.DomainLimit > 0 {
+		domain := emailDomain(user.Email)
+		if domain == "" {
+			return false
+		}
+		since := time.Now().Add(-24 * time.Hour).Unix()
+		count, err := s.userRepo.CountTrialByEmailDomain(domain, since)
+		if err != nil || count >= int64(cfg.DomainLimit) {
+			return false
+		}
+	}
+
+	plan, err := s.planRepo.FindByID(cfg.PlanID)
+	if err != nil {
+		return false
+	}
+	// 试用与新购相同占用名额，之后购买同一套餐按续费处理
+	if s.waitlist != nil {
+		if !s.waitlist.CanPurchase(plan, 0) {
+			return false
+		}
+	} else if !plan.CanPurchase() {
+		return false
+	}
+	applyPlan(user, plan)
+	if cfg.Traffic > 0 {
+		user.TransferEnable = cfg.Traffic * 1024 * 1024 * 1024
+	}
+	now := time.Now().Unix()
+	expiredAt := now + int64(cfg.Days)*86400
+	user.ExpiredAt = &expiredAt
+	user.TrialAt = &now
+	return true
+}
+
+// emailDomain 获取邮箱域名（小写）
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
 // CountByRegisterIP 统计 IP 注册数量
 func (s *UserService) CountByRegisterIP(ip string) (int64, error) {
 	return s.userRepo.CountByRegisterIP(ip)
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestRegisterTrialLimits(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{})
+
+	plan := &model.Plan{Name: "trial", TransferEnable: 100}
+	db.Create(plan)
+
+	repos := repository.NewRepositories(db)
+	users := NewUserService(repos.User, nil)
+	users.SetTrialServices(repos.Plan, nil)
+	cfg := &TrialConfig{PlanID: plan.ID, Days: 3, Traffic: 5, RequireVerify: true, DomainLimit: 1}
+
+	register := func(email, ip string, verified bool) *model.User {
+		user := &model.User{Email: email, UUID: email, Token: email, RegisterIP: &ip}
+		users.applyTrial(user, cfg, ip, verified)
+		if err := users.createUser(user); err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+
+	// 未验证邮箱不发放试用
+	if u := register("a@example.com", "10.0.0.1", false); u.TrialAt != nil {
+		t.Error("trial granted without email verification")
+	}
+	// 同一 IP 已有注册记录时不再发放
+	if u := register("b@example.com", "10.0.0.1", true); u.TrialAt != nil {
+		t.Error("trial granted twice for the same register IP")
+	}
+
+	alice := register("alice@Example.com", "10.0.0.2", true)
+	if alice.TrialAt == nil || alice.PlanID == nil || *alice.PlanID != plan.ID {
+		t.Fatalf("trial not granted: %+v", alice)
+	}
+	if alice.TransferEnable != 5*1024*1024*1024 || *alice.ExpiredAt-*alice.TrialAt != 3*86400 {
+		t.Errorf("trial quota: transfer = %d, duration = %d", alice.TransferEnable, *alice.ExpiredAt-*alice.TrialAt)
+	}
+	// 同一邮箱域名每天限额
+	if u := register("bob@example.com", "10.0.0.3", true); u.TrialAt != nil {
+		t.Error("email domain limit not enforced")
+	}
+
+	// 试用占用套餐名额，名额用完后不再发放
+	got, _ := repos.Plan.FindByID(plan.ID)
+	if got.SoldCount != 1 {
+		t.Errorf("sold_count = %d, want 1", got.SoldCount)
+	}
+	capacity := 1
+	db.Model(plan).Update("capacity_limit", &capacity)
+	if u := register("carol@other.com", "10.0.0.4", true); u.TrialAt != nil {
+		t.Error("trial granted beyond plan capacity")
+	}
+
+	// 转化统计：有付费订单的试用用户计为已转化
+	db.Create(&model.Order{UserID: alice.ID, PlanID: plan.ID, TradeNo: "T1", TotalAmount: 1000, Status: model.OrderStatusCompleted})
+	trial, converted, err := repos.User.CountTrialConversion(0, time.Now().Add(time.Minute).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trial != 1 || converted != 1 {
+		t.Errorf("trial = %d, converted = %d", trial, converted)
+	}
+}
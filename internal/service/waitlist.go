@@ -0,0 +1,232 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// releaseBatchSize 不限量套餐每次最多通知的候补人数，其余由下一次定时任务继续通知
+const releaseBatchSize = 1000
+
+// WaitlistService 售罄套餐候补服务
+// 套餐释放名额（售出数减少或上限提高）时，按加入顺序通知候补用户并保留名额，
+// 保留期内其他用户不能占用该名额，超时未购买则顺延给下一位
+type WaitlistService struct {
+	waitlistRepo *repository.PlanWaitlistRepository
+	planRepo     *repository.PlanRepository
+	userRepo     *repository.UserRepository
+	mailService  *MailService
+	tgService    *TelegramService
+	settingSvc   *SettingService
+}
+
+func NewWaitlistService(waitlistRepo *repository.PlanWaitlistRepository, planRepo *repository.PlanRepository, userRepo *repository.UserRepository, mailService *MailService, tgService *TelegramService) *WaitlistService {
+	return &WaitlistService{
+		waitlistRepo: waitlistRepo,
+		planRepo:     planRepo,
+		userRepo:     userRepo,
+		mailService:  mailService,
+		tgService:    tgService,
+	}
+}
+
+// SetSettingService 设置 SettingService 依赖（保留时长）
+func (s *WaitlistService) SetSettingService(settingSvc *SettingService) {
+	s.settingSvc = settingSvc
+}
+
+// reserveSeconds 名额保留时长，默认 24 小时
+func (s *WaitlistService) reserveSeconds() int64 {
+	hours := 24
+	if s.settingSvc != nil {
+		hours = s.settingSvc.GetInt(SettingWaitlistReserveHours, 24)
+	}
+	if hours <= 0 {
+		hours = 24
+	}
+	return int64(hours) * 3600
+}
+
+// CanPurchase 检查用户是否可以占用套餐名额，为其他候补用户保留的名额不可占用
+func (s *WaitlistService) CanPurchase(plan *model.Plan, userID int64) bool {
+	if plan.CapacityLimit == nil || *plan.CapacityLimit <= 0 {
+		return true
+	}
+	reserved, err := s.waitlistRepo.CountReserved(plan.ID, userID, time.Now().Unix())
+	if err != nil {
+		return plan.CanPurchase()
+	}
+	return int64(plan.SoldCount)+reserved < int64(*plan.CapacityLimit)
+}
+
+// Join 加入售罄套餐的候补队列，已在队列中时返回原记录
+func (s *WaitlistService) Join(userID, planID int64) (*model.PlanWaitlist, error) {
+	plan, err := s.planRepo.FindByID(planID)
+	if err != nil {
+		return nil, errors.New("plan not found")
+	}
+	if entry, err := s.waitlistRepo.FindOpen(planID, userID); err == nil {
+		return entry, nil
+	}
+	if !plan.Sell {
+		return nil, errors.New("plan is not for sale")
+	}
+	if s.CanPurchase(plan, userID) {
+		return nil, errors.New("plan is available for purchase")
+	}
+
+	entry := &model.PlanWaitlist{
+		PlanID: planID,
+		UserID: userID,
+		Status: model.WaitlistWaiting,
+	}
+	if err := s.waitlistRepo.Create(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Leave 退出候补队列，放弃的保留名额顺延给下一位
+func (s *WaitlistService) Leave(userID, planID int64) error {
+	entry, err := s.waitlistRepo.FindOpen(planID, userID)
+	if err != nil {
+		return errors.New("not on the waitlist")
+	}
+	reserved := entry.Status == model.WaitlistReserved
+	entry.Status = model.WaitlistCancelled
+	if err := s.waitlistRepo.Update(entry); err != nil {
+		return err
+	}
+	if reserved {
+		s.Release(planID)
+	}
+	return nil
+}
+
+// MarkPurchased 用户购买套餐后结束其候补记录（在订单完成事务中调用）
+func (s *WaitlistService) MarkPurchased(tx *gorm.DB, planID, userID int64) error {
+	waitlistRepo := s.waitlistRepo.WithTx(tx)
+	entry, err := waitlistRepo.FindOpen(planID, userID)
+	if err != nil {
+		return nil
+	}
+	entry.Status = model.WaitlistPurchased
+	return waitlistRepo.Update(entry)
+}
+
+// Release 将套餐空闲名额按加入顺序保留给候补用户并发送通知，返回本次通知人数
+// 套餐不再限量时分批通知全部候补用户；通知在事务提交后发送，避免长时间持有行锁
+func (s *WaitlistService) Release(planID int64) (int, error) {
+	plan, entries, reservedUntil, err := s.reserve(planID)
+	for i := range entries {
+		s.notify(entries[i].UserID, plan, reservedUntil)
+	}
+	return len(entries), err
+}
+
+// reserve 锁定套餐行后保留空闲名额，返回本次获得保留名额的候补记录
+// 行锁保证多实例同时释放时不会把同一名额保留给多个候补用户
+func (s *WaitlistService) reserve(planID int64) (*model.Plan, []model.PlanWaitlist, int64, error) {
+	var plan *model.Plan
+	var entries []model.PlanWaitlist
+	var reservedUntil int64
+	err := s.planRepo.Transaction(func(tx *gorm.DB) error {
+		waitlistRepo := s.waitlistRepo.WithTx(tx)
+		var err error
+		plan, err = s.planRepo.WithTx(tx).FindByIDForUpdate(planID)
+		if err != nil {
+			return err
+		}
+		if !plan.Sell {
+			return nil
+		}
+
+		now := time.Now().Unix()
+		free := releaseBatchSize
+		if plan.CapacityLimit != nil && *plan.CapacityLimit > 0 {
+			reserved, err := waitlistRepo.CountReserved(plan.ID, 0, now)
+			if err != nil {
+				return err
+			}
+			free = *plan.CapacityLimit - plan.SoldCount - int(reserved)
+		}
+		if free <= 0 {
+			return nil
+		}
+
+		entries, err = waitlistRepo.FindWaiting(plan.ID, free)
+		if err != nil {
+			return err
+		}
+		reservedUntil = now + s.reserveSeconds()
+		for i := range entries {
+			entry := &entries[i]
+			entry.Status = model.WaitlistReserved
+			entry.NotifiedAt = &now
+			entry.ReservedUntil = &reservedUntil
+			if err := waitlistRepo.Update(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return plan, nil, 0, err
+	}
+	return plan, entries, reservedUntil, nil
+}
+
+// notify 通知候补用户套餐已有名额
+func (s *WaitlistService) notify(userID int64, plan *model.Plan, reservedUntil int64) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return
+	}
+	if s.mailService != nil {
+		if err := s.mailService.SendWaitlistAvailable(user, plan, reservedUntil); err != nil {
+			log.Printf("[Waitlist] Failed to send mail to %s: %v", user.Email, err)
+		}
+	}
+	if s.tgService != nil {
+		if err := s.tgService.NotifyWaitlistAvailable(user, plan, reservedUntil); err != nil {
+			log.Printf("[Waitlist] Failed to send telegram to user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// ProcessExpired 回收超时未购买的保留名额，并为有空闲名额的套餐通知下一批候补用户
+func (s *WaitlistService) ProcessExpired() (int, error) {
+	if _, err := s.waitlistRepo.ExpireReservations(time.Now().Unix()); err != nil {
+		return 0, err
+	}
+	planIDs, err := s.waitlistRepo.GetWaitingPlanIDs()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, planID := range planIDs {
+		n, err := s.Release(planID)
+		if err != nil {
+			log.Printf("[Waitlist] Failed to release plan %d: %v", planID, err)
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// List 分页获取候补队列
+func (s *WaitlistService) List(planID int64, status *int, page, pageSize int) ([]model.PlanWaitlist, int64, error) {
+	return s.waitlistRepo.List(planID, status, page, pageSize)
+}
+
+// GetUserEntries 获取用户的候补记录
+func (s *WaitlistService) GetUserEntries(userID int64) ([]model.PlanWaitlist, error) {
+	return s.waitlistRepo.FindByUserID(userID)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dashgo/internal/config"
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestPlanWaitlistReservation(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Plan{}, &model.Order{}, &model.Coupon{}, &model.UserTrafficPack{}, &model.PlanWaitlist{})
+
+	price, limit := int64(1000), 1
+	plan := &model.Plan{Name: "limited", TransferEnable: 100, MonthPrice: &price, Sell: true, CapacityLimit: &limit}
+	db.Create(plan)
+	other := &model.Plan{Name: "other", TransferEnable: 200, MonthPrice: &price, Sell: true}
+	db.Create(other)
+	alice := &model.User{Email: "alice@example.com", UUID: "u1", Token: "t1"}
+	bob := &model.User{Email: "bob@example.com", UUID: "u2", Token: "t2"}
+	carol := &model.User{Email: "carol@example.com", UUID: "u3", Token: "t3"}
+	db.Create(alice)
+	db.Create(bob)
+	db.Create(carol)
+
+	repos := repository.NewRepositories(db)
+	orders := NewOrderService(repos.Order, repos.User, repos.Plan, repos.Coupon, repos.UserGroup, repos.TrafficPack, repos.UserTrafficPack)
+	plans := NewPlanService(repos.Plan, repos.User)
+	waitlist := NewWaitlistService(repos.PlanWaitlist, repos.Plan, repos.User, NewMailService(config.MailConfig{}), NewTelegramService(config.TelegramConfig{}))
+	orders.SetWaitlistService(waitlist)
+	plans.SetWaitlistService(waitlist)
+	orders.SetPlanService(plans)
+
+	buy := func(user *model.User, plan *model.Plan) error {
+		order, err := orders.CreateOrderWithCoupon(user.ID, plan.ID, model.PeriodMonthly, "", "", false)
+		if err != nil {
+			return err
+		}
+		return orders.CompleteOrder(order.TradeNo, "cb_"+order.TradeNo)
+	}
+
+	// 唯一名额售出后套餐售罄，只能候补
+	if err := buy(alice, plan); err != nil {
+		t.Fatal(err)
+	}
+	if err := buy(bob, plan); err == nil {
+		t.Fatal("sold-out plan purchased")
+	}
+	if _, err := waitlist.Join(bob.ID, plan.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitlist.Join(carol.ID, plan.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 更换套餐释放名额后保留给先加入的候补用户
+	if err := buy(alice, other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.Quote(carol.ID, plan.ID, model.PeriodMonthly, "", "", false); err == nil {
+		t.Error("reserved seat taken by another user")
+	}
+	if _, err := orders.Quote(bob.ID, plan.ID, model.PeriodMonthly, "", "", false); err != nil {
+		t.Errorf("reserved user cannot buy: %v", err)
+	}
+
+	// 保留超时后顺延给下一位
+	db.Model(&model.PlanWaitlist{}).Where("user_id = ?", bob.ID).Update("reserved_until", time.Now().Add(-time.Minute).Unix())
+	if n, err := waitlist.ProcessExpired(); err != nil || n != 1 {
+		t.Fatalf("process expired: notified = %d, err = %v", n, err)
+	}
+	if err := buy(carol, plan); err != nil {
+		t.Fatalf("next waitlisted user cannot buy: %v", err)
+	}
+
+	var entries []model.PlanWaitlist
+	db.Order("id ASC").Find(&entries)
+	if entries[0].Status != model.WaitlistExpired || entries[1].Status != model.WaitlistPurchased {
+		t.Errorf("waitlist statuses = %d, %d", entries[0].Status, entries[1].Status)
+	}
+	got, _ := repos.Plan.FindByID(plan.ID)
+	if got.SoldCount != 1 {
+		t.Errorf("sold_count = %d, want 1", got.SoldCount)
+	}
+}
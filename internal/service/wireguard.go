@@ -0,0 +1,195 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+	"dashgo/pkg/utils"
+)
+
+// 默认 WireGuard 地址池
+const defaultWireGuardCIDR = "10.66.0.0/16"
+
+type WireGuardService struct {
+	peerRepo   *repository.WireGuardPeerRepository
+	settingSvc *SettingService
+	mu         sync.Mutex // 进程内串行分配地址，跨进程由 ip 唯一索引兜底
+}
+
+func NewWireGuardService(peerRepo *repository.WireGuardPeerRepository, settingSvc *SettingService) *WireGuardService {
+	return &WireGuardService{
+		peerRepo:   peerRepo,
+		settingSvc: settingSvc,
+	}
+}
+
+// Pool 获取地址池
+func (s *WireGuardService) Pool() (*net.IPNet, error) {
+	cidr := s.settingSvc.GetString(SettingWireGuardCIDR, defaultWireGuardCIDR)
+	_, pool, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if pool.IP.To4() == nil {
+		return nil, errors.New("wireguard pool must be ipv4")
+	}
+	return pool, nil
+}
+
+// ServerAddress 服务端隧道地址，使用地址池的第一个地址
+func (s *WireGuardService) ServerAddress() (string, error) {
+	pool, err := s.Pool()
+	if err != nil {
+		return "", err
+	}
+	ones, _ := pool.Mask.Size()
+	return fmt.Sprintf("%s/%d", uint32ToIP(ipToUint32(pool.IP)+1), ones), nil
+}
+
+// GetOrCreatePeer 获取用户 peer，不存在时生成密钥并分配地址
+func (s *WireGuardService) GetOrCreatePeer(userID int64) (*model.WireGuardPeer, error) {
+	if peer, err := s.peerRepo.FindByUserID(userID); err == nil {
+		return peer, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 加锁后再查一次，避免并发重复创建
+	if peer, err := s.peerRepo.FindByUserID(userID); err == nil {
+		return peer, nil
+	}
+
+	privateKey, publicKey, err := utils.GenerateWireGuardKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	ip, err := s.allocateIP()
+	if err != nil {
+		return nil, err
+	}
+
+	peer := &model.WireGuardPeer{
+		UserID:     userID,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		IP:         ip,
+	}
+	if err := s.peerRepo.Create(peer); err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+// GetPeers 批量获取用户 peer，缺失的自动创建，地址池耗尽时跳过无法分配的用户
+func (s *WireGuardService) GetPeers(users []model.User) (map[int64]*model.WireGuardPeer, error) {
+	userIDs := make([]int64, 0, len(users))
+	for _, u := range users {
+		userIDs = append(userIDs, u.ID)
+	}
+	peers, err := s.peerRepo.FindByUserIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]*model.WireGuardPeer, len(users))
+	for i := range peers {
+		result[peers[i].UserID] = &peers[i]
+	}
+	for _, u := range users {
+		if _, ok := result[u.ID]; ok {
+			continue
+		}
+		peer, err := s.GetOrCreatePeer(u.ID)
+		if err != nil {
+			log.Printf("[WireGuard] Failed to create peer for user %d: %v", u.ID, err)
+			continue
+		}
+		result[u.ID] = peer
+	}
+	return result, nil
+}
+
+// RotatePeer 轮换用户密钥，保留已分配的地址
+func (s *WireGuardService) RotatePeer(userID int64) error {
+	peer, err := s.peerRepo.FindByUserID(userID)
+	if err != nil {
+		return nil // 用户尚未使用 WireGuard
+	}
+	privateKey, publicKey, err := utils.GenerateWireGuardKeyPair()
+	if err != nil {
+		return err
+	}
+	peer.PrivateKey = privateKey
+	peer.PublicKey = publicKey
+	return s.peerRepo.Update(peer)
+}
+
+// allocateIP 从地址池分配一个未使用的地址（跳过网络地址、服务端地址与广播地址）
+func (s *WireGuardService) allocateIP() (string, error) {
+	pool, err := s.Pool()
+	if err != nil {
+		return "", err
+	}
+	used, err := s.peerRepo.GetAllIPs()
+	if err != nil {
+		return "", err
+	}
+	usedSet := make(map[string]bool, len(used))
+	for _, ip := range used {
+		usedSet[ip] = true
+	}
+
+	ones, bits := pool.Mask.Size()
+	base := ipToUint32(pool.IP)
+	size := uint32(1) << uint(bits-ones)
+	for offset := uint32(2); offset+1 < size; offset++ {
+		ip := uint32ToIP(base + offset).String()
+		if !usedSet[ip] {
+			return ip, nil
+		}
+	}
+	return "", errors.New("wireguard address pool exhausted")
+}
+
+// ensureWireGuardServerKey 确保节点有服务端密钥对
+// 私钥单独保存在 privateKey 中，协议设置只保留公钥，避免随节点信息下发给用户；
+// 协议设置中传入 private_key 时视为导入已有私钥
+func ensureWireGuardServerKey(privateKey *string, ps model.JSONMap) (model.JSONMap, error) {
+	if ps == nil {
+		ps = model.JSONMap{}
+	}
+	if key, _ := ps["private_key"].(string); key != "" {
+		*privateKey = key
+	}
+	delete(ps, "private_key")
+	if *privateKey == "" {
+		key, _, err := utils.GenerateWireGuardKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		*privateKey = key
+	}
+	publicKey, err := utils.WireGuardPublicKey(*privateKey)
+	if err != nil {
+		return nil, errors.New("invalid wireguard private key")
+	}
+	ps["public_key"] = publicKey
+	return ps, nil
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"dashgo/internal/config"
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+	"dashgo/pkg/utils"
+)
+
+func TestWireGuardPeers(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Server{}, &model.WireGuardPeer{}, &model.Setting{})
+
+	repos := repository.NewRepositories(db)
+	settings := NewSettingService(repos.Setting, nil)
+	// /29 地址池去掉网络地址、服务端地址与广播地址后可分配 5 个
+	settings.Set(SettingWireGuardCIDR, "10.9.0.0/29")
+	wireguard := NewWireGuardService(repos.WireGuardPeer, settings)
+
+	if addr, _ := wireguard.ServerAddress(); addr != "10.9.0.1/29" {
+		t.Errorf("server address = %s", addr)
+	}
+
+	var users []*model.User
+	for i := 0; i < 6; i++ {
+		user := &model.User{Email: "user" + string(rune('a'+i)) + "@example.com", UUID: string(rune('a'+i)) + "f6c7a0e-4b1d-4c2e-9a3f-0d1e2f3a4b5c", Token: "t" + string(rune('a'+i))}
+		db.Create(user)
+		users = append(users, user)
+	}
+
+	first, err := wireguard.GetOrCreatePeer(users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.IP != "10.9.0.2" {
+		t.Errorf("first peer ip = %s, want 10.9.0.2", first.IP)
+	}
+	if pub, err := utils.WireGuardPublicKey(first.PrivateKey); err != nil || pub != first.PublicKey {
+		t.Errorf("peer public key does not match private key: %v", err)
+	}
+	if again, _ := wireguard.GetOrCreatePeer(users[0].ID); again.ID != first.ID {
+		t.Error("peer created twice for the same user")
+	}
+
+	for _, user := range users[1:5] {
+		if _, err := wireguard.GetOrCreatePeer(user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := wireguard.GetOrCreatePeer(users[5].ID); err == nil {
+		t.Error("allocated beyond the address pool")
+	}
+
+	// 轮换密钥保留地址
+	if err := wireguard.RotatePeer(users[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ := repos.WireGuardPeer.FindByUserID(users[0].ID)
+	if rotated.IP != first.IP || rotated.PrivateKey == first.PrivateKey {
+		t.Errorf("rotated peer: ip = %s, key changed = %v", rotated.IP, rotated.PrivateKey != first.PrivateKey)
+	}
+
+	// 服务端私钥不随用户节点信息下发
+	servers := NewServerService(repos.Server, repos.User, nil, &config.Config{})
+	servers.SetWireGuardService(wireguard)
+	server := &model.Server{Name: "WG 01", Type: model.ServerTypeWireGuard, Host: "wg.example.com", Port: "51820", ServerPort: 51820, Show: true}
+	if err := servers.CreateServer(server); err != nil {
+		t.Fatal(err)
+	}
+	if server.WireGuardKey == "" || server.ProtocolSettings["public_key"] == nil {
+		t.Fatalf("server key not generated: %+v", server.ProtocolSettings)
+	}
+
+	infos, err := servers.GetAvailableServers(users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(infos)
+	if strings.Contains(string(data), server.WireGuardKey) || strings.Contains(string(data), "private_key") {
+		t.Errorf("subscription leaks wireguard private key: %s", data)
+	}
+
+	// Agent 用户列表附带隧道地址，用于按来源地址统计流量
+	hosts := NewHostService(repos.Host, repos.ServerNode, repos.User, repos.Server, repos.ServerRoute, nil)
+	hosts.SetWireGuardService(wireguard)
+	agentUsers, err := hosts.GetUsersForServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := map[interface{}]interface{}{}
+	for _, u := range agentUsers {
+		addresses[u["name"]] = u["address"]
+	}
+	if addresses[users[0].UUID[:8]] != first.IP || addresses[users[5].UUID[:8]] != nil {
+		t.Errorf("agent user addresses = %v", addresses)
+	}
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// WithdrawService 佣金提现服务
+// 用户申请提现时申请金额从佣金余额转入冻结，管理员线下打款后通过审核，
+// 拒绝或用户取消时解冻退回佣金余额；每次状态变更都会通知用户并写入审计记录
+type WithdrawService struct {
+	withdrawRepo *repository.CommissionWithdrawRepository
+	userRepo     *repository.UserRepository
+	mailService  *MailService
+	tgService    *TelegramService
+	settingSvc   *SettingService
+}
+
+func NewWithdrawService(withdrawRepo *repository.CommissionWithdrawRepository, userRepo *repository.UserRepository, mailService *MailService, tgService *TelegramService) *WithdrawService {
+	return &WithdrawService{
+		withdrawRepo: withdrawRepo,
+		userRepo:     userRepo,
+		mailService:  mailService,
+		tgService:    tgService,
+	}
+}
+
+// SetSettingService 设置 SettingService 依赖（提现方式、最低金额与手续费）
+func (s *WithdrawService) SetSettingService(settingSvc *SettingService) {
+	s.settingSvc = settingSvc
+}
+
+// WithdrawConfig 提现配置
+type WithdrawConfig struct {
+	Methods   []string `json:"methods"`
+	MinAmount int64    `json:"min_amount"`
+	FeeRate   int      `json:"fee_rate"` // 手续费比例（%）
+}
+
+// GetConfig 获取提现配置，未设置提现方式时开放全部方式
+func (s *WithdrawService) GetConfig() *WithdrawConfig {
+	cfg := &WithdrawConfig{}
+	methods := ""
+	if s.settingSvc != nil {
+		methods = s.settingSvc.GetString(SettingCommissionWithdrawMethods, "")
+		cfg.MinAmount = int64(s.settingSvc.GetInt(SettingCommissionWithdrawMin, 0))
+		cfg.FeeRate = s.settingSvc.GetInt(SettingCommissionWithdrawFee, 0)
+	}
+	if methods == "" {
+		methods = strings.Join([]string{model.WithdrawMethodUSDT, model.WithdrawMethodAlipay, model.WithdrawMethodBank}, ",")
+	}
+	for _, m := range strings.Split(methods, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			cfg.Methods = append(cfg.Methods, m)
+		}
+	}
+	if cfg.FeeRate < 0 || cfg.FeeRate > 100 {
+		cfg.FeeRate = 0
+	}
+	return cfg
+}
+
+func (c *WithdrawConfig) allowMethod(method string) bool {
+	for _, m := range c.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Request 申请提现，申请金额从佣金余额转入冻结
+func (s *WithdrawService) Request(userID int64, method, account string, amount int64) (*model.CommissionWithdraw, error) {
+	cfg := s.GetConfig()
+	if !cfg.allowMethod(method) {
+		return nil, errors.New("withdraw method not supported")
+	}
+	account = strings.TrimSpace(account)
+	if account == "" {
+		return nil, errors.New("withdraw account is required")
+	}
+	if amount <= 0 || amount < cfg.MinAmount {
+		return nil, errors.New("withdraw amount below minimum")
+	}
+
+	fee := amount * int64(cfg.FeeRate) / 100
+	withdraw := &model.CommissionWithdraw{
+		UserID:       userID,
+		Method:       method,
+		Account:      account,
+		Amount:       amount,
+		Fee:          fee,
+		ActualAmount: amount - fee,
+		Status:       model.WithdrawStatusPending,
+	}
+
+	err := s.withdrawRepo.Transaction(func(tx *gorm.DB) error {
+		userRepo := s.userRepo.WithTx(tx)
+		user, err := userRepo.FindByIDForUpdate(userID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return errors.New("user not found")
+		}
+		if user.CommissionBalance < amount {
+			return errors.New("insufficient commission balance")
+		}
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"commission_balance": gorm.Expr("commission_balance - ?", amount),
+			"commission_frozen":  gorm.Expr("commission_frozen + ?", amount),
+		}).Error; err != nil {
+			return err
+		}
+
+		withdrawRepo := s.withdrawRepo.WithTx(tx)
+		if err := withdrawRepo.Create(withdraw); err != nil {
+			return err
+		}
+		return withdrawRepo.CreateLog(&model.CommissionWithdrawLog{
+			WithdrawID: withdraw.ID,
+			UserID:     userID,
+			Action:     "request",
+			Status:     withdraw.Status,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(withdraw)
+	return withdraw, nil
+}
+
+// Cancel 用户取消待审核的提现申请
+func (s *WithdrawService) Cancel(userID, id int64) (*model.CommissionWithdraw, error) {
+	return s.process(id, func(w *model.CommissionWithdraw) error {
+		if w.UserID != userID {
+			return errors.New("withdraw not found")
+		}
+		return nil
+	}, model.WithdrawStatusCancelled, "cancel", nil, "")
+}
+
+// Approve 管理员审核通过（已线下打款），扣除冻结金额
+func (s *WithdrawService) Approve(id, operatorID int64, note string) (*model.CommissionWithdraw, error) {
+	return s.process(id, nil, model.WithdrawStatusApproved, "approve", &operatorID, note)
+}
+
+// Reject 管理员拒绝提现，冻结金额退回佣金余额
+func (s *WithdrawService) Reject(id, operatorID int64, note string) (*model.CommissionWithdraw, error) {
+	if strings.TrimSpace(note) == "" {
+		return nil, errors.New("reject reason is required")
+	}
+	return s.process(id, nil, model.WithdrawStatusRejected, "reject", &operatorID, note)
+}
+
+// process 处理待审核的提现申请：通过时扣除冻结金额，拒绝或取消时解冻退回佣金余额
+func (s *WithdrawService) process(id int64, check func(*model.CommissionWithdraw) error, status int, action string, operatorID *int64, note string) (*model.CommissionWithdraw, error) {
+	var withdraw *model.CommissionWithdraw
+	err := s.withdrawRepo.Transaction(func(tx *gorm.DB) error {
+		withdrawRepo := s.withdrawRepo.WithTx(tx)
+		w, err := withdrawRepo.FindByIDForUpdate(id)
+		if err != nil {
+			return errors.New("withdraw not found")
+		}
+		if check != nil {
+			if err := check(w); err != nil {
+				return err
+			}
+		}
+		if w.Status != model.WithdrawStatusPending {
+			return errors.New("withdraw already processed")
+		}
+
+		updates := map[string]interface{}{
+			"commission_frozen": gorm.Expr("commission_frozen - ?", w.Amount),
+		}
+		if status != model.WithdrawStatusApproved {
+			updates["commission_balance"] = gorm.Expr("commission_balance + ?", w.Amount)
+		}
+		if err := tx.Model(&model.User{}).Where("id = ?", w.UserID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().Unix()
+		w.Status = status
+		w.OperatorID = operatorID
+		w.ProcessedAt = &now
+		var notePtr *string
+		if note != "" {
+			notePtr = &note
+			w.AdminNote = notePtr
+		}
+		if err := withdrawRepo.Update(w); err != nil {
+			return err
+		}
+		withdraw = w
+		return withdrawRepo.CreateLog(&model.CommissionWithdrawLog{
+			WithdrawID: w.ID,
+			UserID:     w.UserID,
+			OperatorID: operatorID,
+			Action:     action,
+			Status:     status,
+			Note:       notePtr,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(withdraw)
+	return withdraw, nil
+}
+
+// withdrawStatusText 提现状态说明，用于通知
+func withdrawStatusText(status int) string {
+	switch status {
+	case model.WithdrawStatusApproved:
+		return "已通过"
+	case model.WithdrawStatusRejected:
+		return "已拒绝"
+	case model.WithdrawStatusCancelled:
+		return "已取消"
+	default:
+		return "申请已提交"
+	}
+}
+
+// notify 通知用户提现状态变更
+func (s *WithdrawService) notify(withdraw *model.CommissionWithdraw) {
+	user, err := s.userRepo.FindByID(withdraw.UserID)
+	if err != nil || user == nil {
+		return
+	}
+	if s.mailService != nil {
+		if err := s.mailService.SendWithdrawStatus(user, withdraw); err != nil {
+			log.Printf("[Withdraw] Failed to send mail to %s: %v", user.Email, err)
+		}
+	}
+	if s.tgService != nil {
+		if err := s.tgService.NotifyWithdrawStatus(user, withdraw); err != nil {
+			log.Printf("[Withdraw] Failed to send telegram to user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// List 管理员获取提现申请列表
+func (s *WithdrawService) List(userID int64, status *int, page, pageSize int) ([]model.CommissionWithdraw, int64, error) {
+	return s.withdrawRepo.List(userID, status, page, pageSize)
+}
+
+// GetUserWithdrawals 获取用户的提现申请
+func (s *WithdrawService) GetUserWithdrawals(userID int64, page, pageSize int) ([]model.CommissionWithdraw, int64, error) {
+	return s.withdrawRepo.List(userID, nil, page, pageSize)
+}
+
+// GetLogs 获取提现申请的审计记录
+func (s *WithdrawService) GetLogs(id int64) ([]model.CommissionWithdrawLog, error) {
+	return s.withdrawRepo.FindLogs(id)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+
+	"dashgo/internal/config"
+	"dashgo/internal/model"
+	"dashgo/internal/repository"
+)
+
+func TestCommissionWithdrawReview(t *testing.T) {
+	db := newTestDB(t, &model.User{}, &model.Setting{}, &model.CommissionWithdraw{}, &model.CommissionWithdrawLog{})
+
+	alice := &model.User{Email: "alice@example.com", UUID: "u1", Token: "t1", CommissionBalance: 10000}
+	db.Create(alice)
+
+	repos := repository.NewRepositories(db)
+	settings := NewSettingService(repos.Setting, nil)
+	settings.Set(SettingCommissionWithdrawMethods, "usdt,alipay")
+	settings.Set(SettingCommissionWithdrawMin, "2000")
+	settings.Set(SettingCommissionWithdrawFee, "5")
+
+	withdraws := NewWithdrawService(repos.Withdraw, repos.User, NewMailService(config.MailConfig{}), NewTelegramService(config.TelegramConfig{}))
+	withdraws.SetSettingService(settings)
+
+	balance := func() (int64, int64) {
+		got, _ := repos.User.FindByID(alice.ID)
+		return got.CommissionBalance, got.CommissionFrozen
+	}
+
+	// 未开放的方式、低于最低金额、超过佣金余额均不能申请
+	if _, err := withdraws.Request(alice.ID, model.WithdrawMethodBank, "6222", 5000); err == nil {
+		t.Error("disabled method accepted")
+	}
+	if _, err := withdraws.Request(alice.ID, model.WithdrawMethodUSDT, "TAddr", 1000); err == nil {
+		t.Error("amount below minimum accepted")
+	}
+	if _, err := withdraws.Request(alice.ID, model.WithdrawMethodUSDT, "TAddr", 20000); err == nil {
+		t.Error("amount above commission balance accepted")
+	}
+
+	// 申请后冻结，拒绝时退回佣金余额
+	first, err := withdraws.Request(alice.ID, model.WithdrawMethodUSDT, "TAddr", 6000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Fee != 300 || first.ActualAmount != 5700 {
+		t.Errorf("fee = %d, actual = %d", first.Fee, first.ActualAmount)
+	}
+	if b, f := balance(); b != 4000 || f != 6000 {
+		t.Errorf("after request: balance = %d, frozen = %d", b, f)
+	}
+	if _, err := withdraws.Reject(first.ID, 1, ""); err == nil {
+		t.Error("rejected without reason")
+	}
+	if _, err := withdraws.Reject(first.ID, 1, "invalid address"); err != nil {
+		t.Fatal(err)
+	}
+	if b, f := balance(); b != 10000 || f != 0 {
+		t.Errorf("after reject: balance = %d, frozen = %d", b, f)
+	}
+	if _, err := withdraws.Approve(first.ID, 1, ""); err == nil {
+		t.Error("processed withdraw approved again")
+	}
+
+	// 通过时扣除冻结金额
+	second, err := withdraws.Request(alice.ID, model.WithdrawMethodAlipay, "alice@alipay", 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withdraws.Approve(second.ID, 1, "paid"); err != nil {
+		t.Fatal(err)
+	}
+	if b, f := balance(); b != 2000 || f != 0 {
+		t.Errorf("after approve: balance = %d, frozen = %d", b, f)
+	}
+
+	logs, _ := withdraws.GetLogs(first.ID)
+	if len(logs) != 2 || logs[1].Action != "reject" || logs[1].OperatorID == nil || *logs[1].Note != "invalid address" {
+		t.Errorf("audit logs = %+v", logs)
+	}
+}
+
+func TestCommissionTransferKeepsFrozen(t *testing.T) {
+	db := newTestDB(t, &model.User{})
+
+	alice := &model.User{Email: "alice@example.com", UUID: "u1", Token: "t1", CommissionBalance: 4000, CommissionFrozen: 6000}
+	db.Create(alice)
+
+	repos := repository.NewRepositories(db)
+	invite := NewInviteService(repos.InviteCode, repos.User, repos.CommissionLog, repos.Order)
+
+	for _, amount := range []int64{0, -100, 5000} {
+		if err := invite.WithdrawCommission(alice.ID, amount); err == nil {
+			t.Errorf("transfer of %d accepted", amount)
+		}
+	}
+	if err := invite.WithdrawCommission(alice.ID, 3000); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := repos.User.FindByID(alice.ID)
+	if got.CommissionBalance != 1000 || got.CommissionFrozen != 6000 || got.Balance != 3000 {
+		t.Errorf("balance = %d, commission = %d, frozen = %d", got.Balance, got.CommissionBalance, got.CommissionFrozen)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"crypto/ecdh"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha256"
@@ -152,3 +153,26 @@ func GenerateNumericCode(length int) string {
 	}
 	return string(code)
 }
+
+// GenerateWireGuardKeyPair 生成 WireGuard 密钥对（base64 编码）
+func GenerateWireGuardKeyPair() (privateKey, publicKey string, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Bytes()),
+		base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// WireGuardPublicKey 根据私钥计算 WireGuard 公钥
+func WireGuardPublicKey(privateKey string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", err
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}